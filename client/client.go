@@ -0,0 +1,507 @@
+// Package client is a Go client of the calendar HTTP API.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	retries    int           //additional attempts of idempotent requests
+	backoff    time.Duration //delay before the first retry, doubled after every attempt
+	apiKey     string        //key of the organization, not sent if empty
+	actor      string        //user making changes, not sent if empty
+}
+
+type Option func(*Client)
+
+// WithHTTPClient sets the client used for requests, http.DefaultClient by default.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithRetries sets how many times idempotent requests are repeated after network errors
+// and 5xx responses, 2 times starting after 100ms by default.
+func WithRetries(retries int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.retries = retries
+		c.backoff = backoff
+	}
+}
+
+// WithAPIKey sets the key of the organization on whose behalf requests are made.
+func WithAPIKey(key string) Option {
+	return func(c *Client) {
+		c.apiKey = key
+	}
+}
+
+// WithActor sets the user on whose behalf changes are made, it is recorded in the audit log as the claimed actor.
+func WithActor(user string) Option {
+	return func(c *Client) {
+		c.actor = user
+	}
+}
+
+type versionKey struct{}
+
+// AnyVersion is the version for IfMatch which changes the event whatever its version is.
+const AnyVersion = -1
+
+// IfMatch returns the context of requests which change the event only if it still has the version,
+// like Event.Version of the fetched event. Otherwise they fail with ErrPreconditionFailed.
+// Cancellation, answers to invitations and restoring revisions fail with ErrPreconditionRequired
+// without the version.
+func IfMatch(ctx context.Context, version int) context.Context {
+	return context.WithValue(ctx, versionKey{}, version)
+}
+
+type idempotencyKey struct{}
+
+// WithIdempotencyKey returns the context of POST requests sent with the header "Idempotency-Key".
+// The server answers retries of such a request with its original response, so they are repeated
+// like GET requests. Every logical request needs its own key, e.g. a random UUID.
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKey{}, key)
+}
+
+// New returns a client of the server with the base URL like "http://127.0.0.1:8080".
+func New(baseURL string, options ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		httpClient: http.DefaultClient,
+		retries:    2,
+		backoff:    100 * time.Millisecond,
+	}
+	for _, option := range options {
+		option(c)
+	}
+	return c
+}
+
+// do sends the request and decodes the response into result if it isn't nil.
+func (c *Client) do(ctx context.Context, method string, path string, query url.Values, request interface{}, result interface{}) error {
+	var body []byte
+	if request != nil {
+		var err error
+		body, err = json.Marshal(request)
+		if err != nil {
+			return err
+		}
+	}
+	target := c.baseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	attempts := 1
+	if key, _ := ctx.Value(idempotencyKey{}).(string); method == http.MethodGet || method == http.MethodDelete ||
+		method == http.MethodPost && key != "" {
+		attempts += c.retries
+	}
+	backoff := c.backoff
+	var err error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			timer := time.NewTimer(backoff)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			case <-timer.C:
+			}
+			backoff *= 2
+		}
+		var retry bool
+		retry, err = c.attempt(ctx, method, target, body, result)
+		if !retry {
+			return err
+		}
+	}
+	return err
+}
+
+// attempt sends the request once and reports whether it may be repeated.
+func (c *Client) attempt(ctx context.Context, method string, target string, body []byte, result interface{}) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	if body != nil {
+		req.Header.Set("content-type", "application/json")
+	}
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+	if c.actor != "" {
+		req.Header.Set("X-Actor", c.actor)
+	}
+	if key, _ := ctx.Value(idempotencyKey{}).(string); key != "" && method == http.MethodPost {
+		req.Header.Set("Idempotency-Key", key)
+	}
+	if version, ok := ctx.Value(versionKey{}).(int); ok && method != http.MethodGet {
+		tag := `"` + strconv.Itoa(version) + `"`
+		if version == AnyVersion {
+			tag = "*"
+		}
+		req.Header.Set("If-Match", tag)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return true, err
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		var message struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(respBody, &message) != nil || message.Error == "" {
+			message.Error = http.StatusText(resp.StatusCode)
+		}
+		return resp.StatusCode >= http.StatusInternalServerError,
+			&Error{StatusCode: resp.StatusCode, Message: message.Error}
+	}
+	if result == nil {
+		return false, nil
+	}
+	if err := json.Unmarshal(respBody, result); err != nil {
+		return false, fmt.Errorf("calendar: unable to decode response: %w", err)
+	}
+	if reader, ok := result.(headerReader); ok {
+		reader.readHeader(resp.Header)
+	}
+	return false, nil
+}
+
+// headerReader is implemented by results which take a part of the response from its headers.
+type headerReader interface {
+	readHeader(header http.Header)
+}
+
+// CreateUser creates a user and returns its id.
+func (c *Client) CreateUser(ctx context.Context, info UserInfo) (string, error) {
+	var response struct {
+		ID string `json:"id"`
+	}
+	err := c.do(ctx, http.MethodPost, "/v2/users", nil, map[string]UserInfo{"info": info}, &response)
+	return response.ID, err
+}
+
+// GetUser returns the user by id.
+func (c *Client) GetUser(ctx context.Context, id string) (User, error) {
+	var user User
+	err := c.do(ctx, http.MethodGet, "/v2/users/"+url.PathEscape(id), nil, nil, &user)
+	return user, err
+}
+
+// UpdateUser replaces the profile of the user and returns the updated user.
+func (c *Client) UpdateUser(ctx context.Context, id string, info UserInfo) (User, error) {
+	var user User
+	err := c.do(ctx, http.MethodPut, "/v2/users/"+url.PathEscape(id), nil, info, &user)
+	return user, err
+}
+
+// DeactivateUser deactivates the user and removes it from events which aren't finished.
+func (c *Client) DeactivateUser(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/v2/users/"+url.PathEscape(id), nil, nil, nil)
+}
+
+// UserQuery describes the search of users.
+type UserQuery struct {
+	Query              string //prefix of name, word of name or email, all users if empty
+	Limit              int    //page size, server default if zero
+	PageToken          string //token of the page, the first page if empty
+	IncludeDeactivated bool   //list deactivated users too
+}
+
+// ListUsers returns a page of users sorted by name and the token of the next page, empty for the last page.
+func (c *Client) ListUsers(ctx context.Context, users UserQuery) ([]User, string, error) {
+	query := url.Values{}
+	if users.Query != "" {
+		query.Set("query", users.Query)
+	}
+	if users.Limit != 0 {
+		query.Set("limit", strconv.Itoa(users.Limit))
+	}
+	if users.PageToken != "" {
+		query.Set("page_token", users.PageToken)
+	}
+	if users.IncludeDeactivated {
+		query.Set("include_deactivated", "true")
+	}
+	var response struct {
+		Users         []User `json:"users"`
+		NextPageToken string `json:"next_page_token"`
+	}
+	err := c.do(ctx, http.MethodGet, "/v2/users", query, nil, &response)
+	return response.Users, response.NextPageToken, err
+}
+
+// CreateGroup creates a group of users and nested groups and returns its id.
+// The group id can be used instead of user ids when inviting or searching for a slot.
+func (c *Client) CreateGroup(ctx context.Context, info GroupInfo, members []string) (string, error) {
+	var response struct {
+		ID string `json:"id"`
+	}
+	request := struct {
+		Info    GroupInfo `json:"info"`
+		Members []string  `json:"members"`
+	}{info, members}
+	err := c.do(ctx, http.MethodPost, "/v2/groups", nil, request, &response)
+	return response.ID, err
+}
+
+// GetGroup returns the group by id.
+func (c *Client) GetGroup(ctx context.Context, id string) (Group, error) {
+	var group Group
+	err := c.do(ctx, http.MethodGet, "/v2/groups/"+url.PathEscape(id), nil, nil, &group)
+	return group, err
+}
+
+// UpdateGroup replaces info and members of the group.
+func (c *Client) UpdateGroup(ctx context.Context, id string, info GroupInfo, members []string) (Group, error) {
+	var group Group
+	request := struct {
+		Info    GroupInfo `json:"info"`
+		Members []string  `json:"members"`
+	}{info, members}
+	err := c.do(ctx, http.MethodPut, "/v2/groups/"+url.PathEscape(id), nil, request, &group)
+	return group, err
+}
+
+// DeleteGroup deletes the group. Meetings keep members invited through it.
+func (c *Client) DeleteGroup(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/v2/groups/"+url.PathEscape(id), nil, nil, nil)
+}
+
+// CreateCalendar creates a calendar of the user and returns its id.
+func (c *Client) CreateCalendar(ctx context.Context, owner string, info CalendarInfo) (string, error) {
+	var response struct {
+		ID string `json:"id"`
+	}
+	err := c.do(ctx, http.MethodPost, "/v2/users/"+url.PathEscape(owner)+"/calendars", nil, info, &response)
+	return response.ID, err
+}
+
+// CreateGroupCalendar creates a calendar shared by members of the group and returns its id.
+func (c *Client) CreateGroupCalendar(ctx context.Context, group string, info CalendarInfo) (string, error) {
+	var response struct {
+		ID string `json:"id"`
+	}
+	err := c.do(ctx, http.MethodPost, "/v2/groups/"+url.PathEscape(group)+"/calendars", nil, info, &response)
+	return response.ID, err
+}
+
+// GetCalendar returns the calendar by id.
+func (c *Client) GetCalendar(ctx context.Context, id string) (Calendar, error) {
+	var calendar Calendar
+	err := c.do(ctx, http.MethodGet, "/v2/calendars/"+url.PathEscape(id), nil, nil, &calendar)
+	return calendar, err
+}
+
+// UpdateCalendar replaces info of the calendar.
+func (c *Client) UpdateCalendar(ctx context.Context, id string, info CalendarInfo) (Calendar, error) {
+	var calendar Calendar
+	err := c.do(ctx, http.MethodPut, "/v2/calendars/"+url.PathEscape(id), nil, info, &calendar)
+	return calendar, err
+}
+
+// DeleteCalendar deletes the calendar, its meetings move to default calendars of attendees.
+func (c *Client) DeleteCalendar(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/v2/calendars/"+url.PathEscape(id), nil, nil, nil)
+}
+
+// ListCalendars returns calendars of the user and of groups containing the user sorted by name.
+func (c *Client) ListCalendars(ctx context.Context, user string) ([]Calendar, error) {
+	var calendars []Calendar
+	err := c.do(ctx, http.MethodGet, "/v2/users/"+url.PathEscape(user)+"/calendars", nil, nil, &calendars)
+	return calendars, err
+}
+
+// ListGroupCalendars returns calendars of the group sorted by name.
+func (c *Client) ListGroupCalendars(ctx context.Context, group string) ([]Calendar, error) {
+	var calendars []Calendar
+	err := c.do(ctx, http.MethodGet, "/v2/groups/"+url.PathEscape(group)+"/calendars", nil, nil, &calendars)
+	return calendars, err
+}
+
+// CreateEvent creates the event and returns its id with overlapping events of attendees.
+// In strict mode the event is refused with ErrConflict if participants are busy.
+func (c *Client) CreateEvent(ctx context.Context, event Event, strict bool) (string, []Conflict, error) {
+	request := struct {
+		Event
+		Strict bool `json:"strict,omitempty"`
+	}{Event: event, Strict: strict}
+	var response struct {
+		ID       string     `json:"id"`
+		Warnings []Conflict `json:"warnings"`
+	}
+	err := c.do(ctx, http.MethodPost, "/v2/events", nil, request, &response)
+	return response.ID, response.Warnings, err
+}
+
+// GetEvent returns the event by id.
+func (c *Client) GetEvent(ctx context.Context, id string) (Event, error) {
+	var event Event
+	err := c.do(ctx, http.MethodGet, "/v2/events/"+url.PathEscape(id), nil, nil, &event)
+	return event, err
+}
+
+// CancelEvent removes the event from calendars of all attendees.
+func (c *Client) CancelEvent(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/v2/events/"+url.PathEscape(id), nil, nil, nil)
+}
+
+// Accept accepts the invitation and returns overlapping events of the user.
+// In strict mode the invitation isn't accepted with ErrConflict if the user is busy.
+func (c *Client) Accept(ctx context.Context, user string, event string, strict bool) ([]Conflict, error) {
+	request := map[string]interface{}{"user": user, "status": "accepted", "strict": strict}
+	var response struct {
+		Warnings []Conflict `json:"warnings"`
+	}
+	err := c.do(ctx, http.MethodPost, "/v2/events/"+url.PathEscape(event)+"/responses", nil, request, &response)
+	return response.Warnings, err
+}
+
+// Reject declines the invitation.
+func (c *Client) Reject(ctx context.Context, user string, event string) error {
+	request := map[string]interface{}{"user": user, "status": "declined"}
+	return c.do(ctx, http.MethodPost, "/v2/events/"+url.PathEscape(event)+"/responses", nil, request, nil)
+}
+
+// EventHistory returns revisions of the event in order of changes with fields changed by each of them.
+func (c *Client) EventHistory(ctx context.Context, id string) ([]EventRevision, error) {
+	var revisions []EventRevision
+	err := c.do(ctx, http.MethodGet, "/v2/events/"+url.PathEscape(id)+"/revisions", nil, nil, &revisions)
+	return revisions, err
+}
+
+// RestoreEvent makes the event as it was in the revision, the restored state becomes its new revision.
+func (c *Client) RestoreEvent(ctx context.Context, id string, revision int) (Event, error) {
+	request := map[string]interface{}{"revision": revision}
+	var event Event
+	err := c.do(ctx, http.MethodPost, "/v2/events/"+url.PathEscape(id)+"/revisions", nil, request, &event)
+	return event, err
+}
+
+// ListEvents returns occurrences of user events within the interval.
+func (c *Client) ListEvents(ctx context.Context, user string, from time.Time, to time.Time) ([]Event, error) {
+	return c.ListCalendarEvents(ctx, user, "", from, to)
+}
+
+// ListCalendarEvents returns occurrences of events of the user's calendar within the interval,
+// all events of the user if calendar is empty. Pages of the server are requested one by one.
+func (c *Client) ListCalendarEvents(ctx context.Context, user string, calendar string, from time.Time, to time.Time) ([]Event, error) {
+	query := url.Values{}
+	if calendar != "" {
+		query.Set("calendar", calendar)
+	}
+	query.Set("from", from.Format(time.RFC3339Nano))
+	query.Set("to", to.Format(time.RFC3339Nano))
+	query.Set("limit", strconv.Itoa(eventsPageSize))
+	var events []Event
+	for {
+		var page eventsPage
+		if err := c.do(ctx, http.MethodGet, "/v2/users/"+url.PathEscape(user)+"/events", query, nil, &page); err != nil {
+			return nil, err
+		}
+		events = append(events, page.events...)
+		if page.nextPageToken == "" {
+			return events, nil
+		}
+		query.Set("page_token", page.nextPageToken)
+	}
+}
+
+// eventsPageSize is the largest page of occurrences the server returns.
+const eventsPageSize = 500
+
+// eventsPage is a page of occurrences with the token of the next page from the header Next-Page-Token.
+type eventsPage struct {
+	events        []Event
+	nextPageToken string
+}
+
+func (p *eventsPage) UnmarshalJSON(data []byte) error {
+	return json.Unmarshal(data, &p.events)
+}
+
+func (p *eventsPage) readHeader(header http.Header) {
+	p.nextPageToken = header.Get("Next-Page-Token")
+}
+
+// SlotQuery describes the search of a free slot.
+type SlotQuery struct {
+	Users      []string      //users who have to be free
+	Duration   time.Duration //duration of the slot
+	From       time.Time     //start of search, now if zero
+	ValidUntil time.Time     //last interesting time
+	SlotOptions
+}
+
+// FindSlot returns the start of the nearest slot in which all users are free.
+func (c *Client) FindSlot(ctx context.Context, slot SlotQuery) (time.Time, error) {
+	query := url.Values{"users": slot.Users}
+	query.Set("duration", slot.Duration.String())
+	query.Set("valid_until", slot.ValidUntil.Format(time.RFC3339Nano))
+	if !slot.From.IsZero() {
+		query.Set("from", slot.From.Format(time.RFC3339Nano))
+	}
+	for name, value := range map[string]time.Duration{
+		"granularity":   slot.Granularity,
+		"buffer_before": slot.BufferBefore,
+		"buffer_after":  slot.BufferAfter,
+	} {
+		if value != 0 {
+			query.Set(name, value.String())
+		}
+	}
+	var response struct {
+		Begin time.Time `json:"begin"`
+	}
+	err := c.do(ctx, http.MethodGet, "/v2/slots", query, nil, &response)
+	return response.Begin, err
+}
+
+// AuditQuery describes the search in the audit log.
+type AuditQuery struct {
+	User  string    //only changes made by the user or of the user
+	Event string    //only changes of the event
+	From  time.Time //from what moment, from the beginning if zero
+	To    time.Time //to what moment, till now if zero
+}
+
+// AuditLog returns changes in order they were made.
+func (c *Client) AuditLog(ctx context.Context, audit AuditQuery) ([]AuditRecord, error) {
+	query := url.Values{}
+	if audit.User != "" {
+		query.Set("user", audit.User)
+	}
+	if audit.Event != "" {
+		query.Set("event", audit.Event)
+	}
+	if !audit.From.IsZero() {
+		query.Set("from", audit.From.Format(time.RFC3339Nano))
+	}
+	if !audit.To.IsZero() {
+		query.Set("to", audit.To.Format(time.RFC3339Nano))
+	}
+	var records []AuditRecord
+	err := c.do(ctx, http.MethodGet, "/v2/audit-log", query, nil, &records)
+	return records, err
+}
@@ -0,0 +1,521 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nivanov045/calendar/internal"
+	"github.com/nivanov045/calendar/internal/api"
+	"github.com/nivanov045/calendar/internal/idempotency"
+	"github.com/nivanov045/calendar/internal/service"
+	"github.com/nivanov045/calendar/internal/storage"
+	"github.com/nivanov045/calendar/internal/tenant"
+)
+
+func newServer(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(api.New(service.New(storage.New(), nil, nil)).Router())
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestClient(t *testing.T) {
+	c := New(newServer(t).URL)
+	ctx := context.Background()
+
+	organizer, err := c.CreateUser(ctx, UserInfo{Name: "organizer"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	guest, err := c.CreateUser(ctx, UserInfo{Name: "guest", Email: "guest@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := c.GetUser(ctx, guest)
+	if err != nil || user.Info.Email != "guest@example.com" {
+		t.Fatalf("GetUser() = %v, %v", user, err)
+	}
+
+	start := time.Date(2022, 9, 5, 10, 0, 0, 0, time.UTC)
+	id, warnings, err := c.CreateEvent(ctx, Event{
+		Organizer:    organizer,
+		Participants: []string{organizer},
+		Candidates:   []string{guest},
+		Start:        start,
+		Finish:       start.Add(time.Hour),
+		RepeatType:   Daily,
+		Info:         EventInfo{Name: "standup"},
+	}, false)
+	if err != nil || len(warnings) != 0 {
+		t.Fatalf("CreateEvent() = %v, %v", warnings, err)
+	}
+	event, err := c.GetEvent(ctx, id)
+	if err != nil || event.Info.Name != "standup" {
+		t.Fatalf("GetEvent() = %v, %v", event, err)
+	}
+
+	if _, err := c.Accept(IfMatch(ctx, event.Version), guest, id, false); err != nil {
+		t.Fatal(err)
+	}
+	events, err := c.ListEvents(ctx, guest, start, start.Add(72*time.Hour))
+	if err != nil || len(events) != 3 {
+		t.Fatalf("ListEvents() = %d events, %v, want 3", len(events), err)
+	}
+	if events, err := c.ListEvents(ctx, guest, start, start.Add(600*24*time.Hour)); err != nil || len(events) != 600 {
+		t.Fatalf("ListEvents() of two pages = %d events, %v, want 600", len(events), err)
+	}
+
+	begin, err := c.FindSlot(ctx, SlotQuery{
+		Users:       []string{organizer, guest},
+		Duration:    30 * time.Minute,
+		From:        start,
+		ValidUntil:  start.Add(24 * time.Hour),
+		SlotOptions: SlotOptions{BufferAfter: 15 * time.Minute},
+	})
+	if err != nil || !begin.Equal(start.Add(75*time.Minute)) {
+		t.Fatalf("FindSlot() = %v, %v", begin, err)
+	}
+
+	if _, _, err := c.CreateEvent(ctx, Event{
+		Participants: []string{guest},
+		Start:        start,
+		Finish:       start.Add(time.Hour),
+	}, true); !errors.Is(err, ErrConflict) {
+		t.Errorf("CreateEvent() in strict mode error = %v, want ErrConflict", err)
+	}
+
+	if err := c.CancelEvent(IfMatch(ctx, AnyVersion), id); err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.GetEvent(ctx, id)
+	var apiErr *Error
+	if !errors.Is(err, ErrNotFound) || !errors.As(err, &apiErr) || apiErr.Message != "unexisted event" {
+		t.Errorf("GetEvent() of cancelled event error = %v, want ErrNotFound", err)
+	}
+	if err := c.Reject(IfMatch(ctx, AnyVersion), guest, id); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Reject() error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestClientUsers(t *testing.T) {
+	c := New(newServer(t).URL)
+	ctx := context.Background()
+
+	var ids []string
+	for _, name := range []string{"Ivan Petrov", "Anna Smirnova", "Petr Ivanov"} {
+		id, err := c.CreateUser(ctx, UserInfo{Name: name})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	user, err := c.UpdateUser(ctx, ids[0], UserInfo{Name: "Ivan Petrov", TimeZone: "Europe/Berlin"})
+	if err != nil || user.Info.TimeZone != "Europe/Berlin" {
+		t.Fatalf("UpdateUser() = %v, %v", user, err)
+	}
+	if _, err := c.UpdateUser(ctx, ids[0], UserInfo{TimeZone: "Mars/Olympus"}); !errors.Is(err, ErrBadRequest) {
+		t.Errorf("UpdateUser() with wrong time zone error = %v, want %v", err, ErrBadRequest)
+	}
+	if err := c.DeactivateUser(ctx, ids[2]); err != nil {
+		t.Fatal(err)
+	}
+
+	users, next, err := c.ListUsers(ctx, UserQuery{Query: "iv", Limit: 1, IncludeDeactivated: true})
+	if err != nil || len(users) != 1 || users[0].ID != ids[0] || next == "" {
+		t.Fatalf("ListUsers() = %v, %q, %v", users, next, err)
+	}
+	users, next, err = c.ListUsers(ctx, UserQuery{Query: "iv", Limit: 1, IncludeDeactivated: true, PageToken: next})
+	if err != nil || len(users) != 1 || !users[0].Deactivated || next != "" {
+		t.Fatalf("ListUsers() = %v, %q, %v", users, next, err)
+	}
+	users, _, err = c.ListUsers(ctx, UserQuery{Query: "iv"})
+	if err != nil || len(users) != 1 || users[0].ID != ids[0] {
+		t.Fatalf("ListUsers() = %v, %v", users, err)
+	}
+}
+
+func TestClientGroups(t *testing.T) {
+	c := New(newServer(t).URL)
+	ctx := context.Background()
+
+	organizer, err := c.CreateUser(ctx, UserInfo{Name: "organizer"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	member, err := c.CreateUser(ctx, UserInfo{Name: "member"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	group, err := c.CreateGroup(ctx, GroupInfo{Name: "team"}, []string{member})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parent, err := c.CreateGroup(ctx, GroupInfo{Name: "department"}, []string{group})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.UpdateGroup(ctx, group, GroupInfo{Name: "team"}, []string{parent}); !errors.Is(err, ErrBadRequest) {
+		t.Errorf("UpdateGroup() with cycle error = %v, want %v", err, ErrBadRequest)
+	}
+
+	start := time.Date(2022, 9, 5, 10, 0, 0, 0, time.UTC)
+	id, _, err := c.CreateEvent(ctx, Event{
+		Participants: []string{organizer},
+		Candidates:   []string{parent},
+		Start:        start,
+		Finish:       start.Add(time.Hour),
+	}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	event, err := c.GetEvent(ctx, id)
+	if err != nil || len(event.Candidates) != 1 || event.Candidates[0] != member || event.InvitedVia[member] != parent {
+		t.Fatalf("GetEvent() = %v, %v", event, err)
+	}
+
+	if err := c.DeleteGroup(ctx, parent); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.GetGroup(ctx, parent); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetGroup() after delete error = %v, want %v", err, ErrNotFound)
+	}
+	if got, err := c.GetGroup(ctx, group); err != nil || got.Info.Name != "team" {
+		t.Errorf("GetGroup() = %v, %v", got, err)
+	}
+}
+
+func TestClientCalendars(t *testing.T) {
+	c := New(newServer(t).URL)
+	ctx := context.Background()
+
+	user, err := c.CreateUser(ctx, UserInfo{Name: "user"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.CreateCalendar(ctx, user, CalendarInfo{Name: "work", Visibility: "secret"}); !errors.Is(err, ErrBadRequest) {
+		t.Errorf("CreateCalendar() with wrong visibility error = %v, want %v", err, ErrBadRequest)
+	}
+	personal, err := c.CreateCalendar(ctx, user, CalendarInfo{Name: "personal", Visibility: Private})
+	if err != nil {
+		t.Fatal(err)
+	}
+	calendar, err := c.UpdateCalendar(ctx, personal, CalendarInfo{Name: "personal", Color: "#0b8043", Visibility: Private})
+	if err != nil || calendar.Owner != user || calendar.Info.Color != "#0b8043" {
+		t.Fatalf("UpdateCalendar() = %v, %v", calendar, err)
+	}
+
+	start := time.Date(2022, 9, 5, 10, 0, 0, 0, time.UTC)
+	for _, event := range []Event{
+		{Participants: []string{user}, Start: start, Finish: start.Add(time.Hour), Calendar: personal},
+		{Participants: []string{user}, Start: start.Add(time.Hour), Finish: start.Add(2 * time.Hour)},
+	} {
+		if _, _, err := c.CreateEvent(ctx, event, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	events, err := c.ListCalendarEvents(ctx, user, personal, start, start.Add(24*time.Hour))
+	if err != nil || len(events) != 1 || events[0].Visibility != Private {
+		t.Fatalf("ListCalendarEvents() = %v, %v", events, err)
+	}
+
+	if err := c.DeleteCalendar(ctx, personal); err != nil {
+		t.Fatal(err)
+	}
+	calendars, err := c.ListCalendars(ctx, user)
+	if err != nil || len(calendars) != 0 {
+		t.Fatalf("ListCalendars() = %v, %v", calendars, err)
+	}
+	if _, err := c.GetCalendar(ctx, personal); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetCalendar() after delete error = %v, want %v", err, ErrNotFound)
+	}
+
+	team, err := c.CreateGroup(ctx, GroupInfo{Name: "team"}, []string{user})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.CreateGroupCalendar(ctx, team, CalendarInfo{Name: "releases", Editors: []string{"unknown"}}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("CreateGroupCalendar() with unexisted editor error = %v, want %v", err, ErrNotFound)
+	}
+	releases, err := c.CreateGroupCalendar(ctx, team, CalendarInfo{Name: "releases", Editors: []string{user}, BusyForMembers: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	calendars, err = c.ListGroupCalendars(ctx, team)
+	if err != nil || len(calendars) != 1 || calendars[0].ID != releases || calendars[0].Owner != team {
+		t.Fatalf("ListGroupCalendars() = %v, %v", calendars, err)
+	}
+	calendars, err = c.ListCalendars(ctx, user)
+	if err != nil || len(calendars) != 1 || calendars[0].ID != releases {
+		t.Fatalf("ListCalendars() of member = %v, %v", calendars, err)
+	}
+}
+
+func TestClientOrganizations(t *testing.T) {
+	tenants, err := tenant.New([]tenant.Entry{
+		{Organization: internal.Organization{ID: "sales", Settings: internal.OrganizationSettings{TimeZone: "Europe/Berlin"}}, APIKeys: []string{"sales-key"}},
+		{Organization: internal.Organization{ID: "hr"}, APIKeys: []string{"hr-key"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	serv := service.New(storage.New(), nil, nil, service.WithTenants(func(internal.Organization) service.Scope {
+		return service.Scope{Storage: storage.New()}
+	}))
+	server := httptest.NewServer(api.New(serv, api.WithTenants(tenants)).Router())
+	defer server.Close()
+	ctx := context.Background()
+
+	if _, err := New(server.URL).CreateUser(ctx, UserInfo{Name: "anonymous"}); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("CreateUser() without key error = %v, want %v", err, ErrUnauthorized)
+	}
+	if _, err := New(server.URL, WithAPIKey("unknown")).CreateUser(ctx, UserInfo{Name: "anonymous"}); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("CreateUser() with unknown key error = %v, want %v", err, ErrUnauthorized)
+	}
+	sales := New(server.URL, WithAPIKey("sales-key"))
+	hr := New(server.URL, WithAPIKey("hr-key"))
+	id, err := sales.CreateUser(ctx, UserInfo{Name: "seller"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user, err := sales.GetUser(ctx, id); err != nil || user.Info.TimeZone != "Europe/Berlin" {
+		t.Errorf("GetUser() = %+v, %v, want time zone of the organization", user, err)
+	}
+	if _, err := hr.GetUser(ctx, id); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetUser() of another organization error = %v, want %v", err, ErrNotFound)
+	}
+	if users, _, err := hr.ListUsers(ctx, UserQuery{}); err != nil || len(users) != 0 {
+		t.Errorf("ListUsers() of another organization = %v, %v, want none", users, err)
+	}
+}
+
+func TestClientAuditLog(t *testing.T) {
+	tenants, err := tenant.New([]tenant.Entry{{Organization: internal.Organization{ID: "sales"}, APIKeys: []string{"sales-key"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(api.New(service.New(storage.New(), nil, nil), api.WithTenants(tenants)).Router())
+	defer server.Close()
+	c := New(server.URL, WithAPIKey("sales-key"))
+	ctx := context.Background()
+
+	user, err := c.CreateUser(ctx, UserInfo{Name: "user"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2022, 9, 5, 10, 0, 0, 0, time.UTC)
+	id, _, err := c.CreateEvent(ctx, Event{Participants: []string{user}, Start: start, Finish: start.Add(time.Hour)}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := New(server.URL, WithAPIKey("sales-key"), WithActor(user)).CancelEvent(IfMatch(ctx, 1), id); err != nil {
+		t.Fatal(err)
+	}
+	records, err := c.AuditLog(ctx, AuditQuery{Event: id})
+	if err != nil || len(records) != 2 {
+		t.Fatalf("AuditLog() = %v, %v, want 2 records", records, err)
+	}
+	caller := tenant.KeyID("sales-key")
+	if cancelled := records[1]; cancelled.Action != "cancel_event" || cancelled.Actor != caller ||
+		cancelled.ClaimedActor != user || cancelled.RequestID == "" {
+		t.Errorf("AuditLog() record = %+v, want cancel_event by %s for %s with request id", cancelled, caller, user)
+	}
+	if records, err := c.AuditLog(ctx, AuditQuery{Event: id, From: time.Now().Add(time.Hour)}); err != nil || len(records) != 0 {
+		t.Errorf("AuditLog() in the future = %v, %v, want none", records, err)
+	}
+}
+
+func TestClientEventHistory(t *testing.T) {
+	server := newServer(t)
+	c := New(server.URL)
+	ctx := context.Background()
+
+	organizer, err := c.CreateUser(ctx, UserInfo{Name: "organizer"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	guest, err := c.CreateUser(ctx, UserInfo{Name: "guest"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2022, 9, 5, 10, 0, 0, 0, time.UTC)
+	id, _, err := c.CreateEvent(ctx, Event{Participants: []string{organizer}, Candidates: []string{guest}, Start: start, Finish: start.Add(time.Hour)}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Reject(IfMatch(ctx, 1), guest, id); err != nil {
+		t.Fatal(err)
+	}
+	revisions, err := c.EventHistory(ctx, id)
+	if err != nil || len(revisions) != 2 || len(revisions[1].Changes) != 2 || revisions[1].Changes[0].Field != "candidates" {
+		t.Fatalf("EventHistory() = %+v, %v, want creation and rejection", revisions, err)
+	}
+	restored, err := c.RestoreEvent(IfMatch(ctx, 2), id, 1)
+	if err != nil || !restored.IsAttendee(guest) {
+		t.Errorf("RestoreEvent() = %+v, %v, want the guest invited again", restored, err)
+	}
+	if _, err := c.RestoreEvent(IfMatch(ctx, AnyVersion), id, 5); !errors.Is(err, ErrNotFound) {
+		t.Errorf("RestoreEvent() of unexisted revision error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestClientIfMatch(t *testing.T) {
+	server := newServer(t)
+	c := New(server.URL)
+	ctx := context.Background()
+
+	organizer, err := c.CreateUser(ctx, UserInfo{Name: "organizer"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	guest, err := c.CreateUser(ctx, UserInfo{Name: "guest"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2022, 9, 5, 10, 0, 0, 0, time.UTC)
+	id, _, err := c.CreateEvent(ctx, Event{Participants: []string{organizer}, Candidates: []string{guest}, Start: start, Finish: start.Add(time.Hour)}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	event, err := c.GetEvent(ctx, id)
+	if err != nil || event.Version != 1 {
+		t.Fatalf("GetEvent() = %+v, %v, want version 1", event, err)
+	}
+	if _, err := c.Accept(IfMatch(ctx, event.Version), guest, id, false); err != nil {
+		t.Fatalf("Accept() of the fetched version error = %v", err)
+	}
+	if err := c.CancelEvent(ctx, id); !errors.Is(err, ErrPreconditionRequired) {
+		t.Errorf("CancelEvent() without version error = %v, want ErrPreconditionRequired", err)
+	}
+	if err := c.CancelEvent(IfMatch(ctx, event.Version), id); !errors.Is(err, ErrPreconditionFailed) {
+		t.Errorf("CancelEvent() of the outdated version error = %v, want ErrPreconditionFailed", err)
+	}
+	if err := c.CancelEvent(IfMatch(ctx, event.Version+1), id); err != nil {
+		t.Errorf("CancelEvent() of the current version error = %v", err)
+	}
+
+	id, _, err = c.CreateEvent(ctx, Event{Participants: []string{organizer}, Start: start, Finish: start.Add(time.Hour)}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.Get(server.URL + "/v2/events/" + id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if tag := resp.Header.Get("ETag"); tag != `"1"` {
+		t.Errorf("ETag = %s, want \"1\"", tag)
+	}
+	req, err := http.NewRequest(http.MethodDelete, server.URL+"/v2/events/"+id, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("If-Match", "1")
+	if resp, err := http.DefaultClient.Do(req); err != nil || resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("DELETE with unquoted If-Match = %v, %v, want 400", resp, err)
+	} else {
+		resp.Body.Close()
+	}
+}
+
+func TestClientRetries(t *testing.T) {
+	real := newServer(t)
+	var calls int32
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		http.Redirect(w, r, real.URL+r.URL.String(), http.StatusTemporaryRedirect)
+	}))
+	defer flaky.Close()
+
+	c := New(flaky.URL, WithRetries(2, time.Millisecond))
+	_, err := c.GetUser(context.Background(), "unknown")
+	if !errors.Is(err, ErrNotFound) || atomic.LoadInt32(&calls) != 3 {
+		t.Errorf("GetUser() error = %v after %d calls, want ErrNotFound after 3", err, calls)
+	}
+
+	atomic.StoreInt32(&calls, 0)
+	_, err = c.CreateUser(context.Background(), UserInfo{Name: "user"})
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusServiceUnavailable || atomic.LoadInt32(&calls) != 1 {
+		t.Errorf("CreateUser() error = %v after %d calls, want 503 without retries", err, calls)
+	}
+}
+
+func TestClientIdempotencyKey(t *testing.T) {
+	real := httptest.NewServer(api.New(service.New(storage.New(), nil, nil), api.WithIdempotency(idempotency.New(time.Hour))).Router())
+	defer real.Close()
+	//the second request, which creates the event, is processed, but its response is lost like after a timeout
+	var calls int32
+	lossy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		req, _ := http.NewRequest(r.Method, real.URL+r.URL.String(), bytes.NewReader(body))
+		req.Header = r.Header.Clone()
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer resp.Body.Close()
+		if atomic.AddInt32(&calls, 1) == 2 {
+			w.WriteHeader(http.StatusGatewayTimeout)
+			return
+		}
+		for name, values := range resp.Header {
+			w.Header()[name] = values
+		}
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+	}))
+	defer lossy.Close()
+
+	c := New(lossy.URL, WithRetries(2, time.Millisecond))
+	ctx := context.Background()
+	user, err := c.CreateUser(ctx, UserInfo{Name: "user"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2022, 9, 5, 10, 0, 0, 0, time.UTC)
+	event := Event{Participants: []string{user}, Start: start, Finish: start.Add(time.Hour)}
+	id, _, err := c.CreateEvent(WithIdempotencyKey(ctx, "k-1"), event, false)
+	if err != nil || atomic.LoadInt32(&calls) != 3 {
+		t.Fatalf("CreateEvent() = %v, %v after %d calls, want the retry answered", id, err, calls)
+	}
+	if again, _, err := c.CreateEvent(WithIdempotencyKey(ctx, "k-1"), event, false); err != nil || again != id {
+		t.Errorf("CreateEvent() with the same key = %v, %v, want %v", again, err, id)
+	}
+	if events, err := c.ListEvents(ctx, user, start, start.Add(time.Hour)); err != nil || len(events) != 1 {
+		t.Errorf("ListEvents() = %v, %v, want one event", events, err)
+	}
+
+	event.Info.Name = "another"
+	_, _, err = c.CreateEvent(WithIdempotencyKey(ctx, "k-1"), event, false)
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnprocessableEntity {
+		t.Errorf("CreateEvent() with the same key and another event error = %v, want 422", err)
+	}
+}
+
+func TestClientContext(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	c := New(server.URL, WithRetries(10, time.Second))
+	_, err := c.GetEvent(ctx, "event")
+	if !errors.Is(err, context.DeadlineExceeded) || atomic.LoadInt32(&calls) != 1 {
+		t.Errorf("GetEvent() error = %v after %d calls, want deadline exceeded after 1", err, calls)
+	}
+}
@@ -0,0 +1,46 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+var (
+	ErrBadRequest           = errors.New("bad request")
+	ErrNotFound             = errors.New("not found")
+	ErrConflict             = errors.New("conflict with existing events")
+	ErrUnauthorized         = errors.New("unauthorized")
+	ErrPreconditionFailed   = errors.New("precondition failed")
+	ErrPreconditionRequired = errors.New("precondition required")
+)
+
+// Error is returned when the server answers with an error status.
+// It matches ErrBadRequest, ErrNotFound, ErrConflict, ErrUnauthorized, ErrPreconditionFailed and
+// ErrPreconditionRequired with errors.Is.
+type Error struct {
+	StatusCode int    //HTTP status of the response
+	Message    string //error description of the server
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("calendar: %d %s", e.StatusCode, e.Message)
+}
+
+func (e *Error) Is(target error) bool {
+	switch target {
+	case ErrBadRequest:
+		return e.StatusCode == http.StatusBadRequest
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrConflict:
+		return e.StatusCode == http.StatusConflict
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized
+	case ErrPreconditionFailed:
+		return e.StatusCode == http.StatusPreconditionFailed
+	case ErrPreconditionRequired:
+		return e.StatusCode == http.StatusPreconditionRequired
+	}
+	return false
+}
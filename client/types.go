@@ -0,0 +1,37 @@
+package client
+
+import "github.com/nivanov045/calendar/internal"
+
+// Entities have the same shape as in the API.
+type (
+	User          = internal.User
+	UserInfo      = internal.CustomUserInfo
+	Group         = internal.Group
+	GroupInfo     = internal.CustomGroupInfo
+	Calendar      = internal.Calendar
+	CalendarInfo  = internal.CustomCalendarInfo
+	Visibility    = internal.Visibility
+	Event         = internal.Event
+	EventInfo     = internal.CustomEventInfo
+	Reminder      = internal.Reminder
+	RepeatType    = internal.RepeatType
+	Conflict      = internal.Conflict
+	SlotOptions   = internal.SlotOptions
+	AuditRecord   = internal.AuditRecord
+	AuditAction   = internal.AuditAction
+	FieldChange   = internal.FieldChange
+	EventRevision = internal.EventRevision
+)
+
+const (
+	Once     = internal.Once
+	Daily    = internal.Daily
+	Weekly   = internal.Weekly
+	Yearly   = internal.Yearly
+	Workdays = internal.Workdays
+)
+
+const (
+	Public  = internal.Public
+	Private = internal.Private
+)
@@ -0,0 +1,484 @@
+// Command calctl manages the calendar from the terminal through the HTTP API.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/nivanov045/calendar/client"
+)
+
+const usage = `Usage: calctl [-server URL] [-key KEY] [-json] <command> [flags] [arguments]
+
+Commands:
+  user create -name NAME [-email EMAIL]
+  user show ID
+  calendar create -user USER -name NAME [-color COLOR] [-private] [-transparent]
+  calendar list -user USER
+  event create -organizer USER -start TIME -duration DURATION [-participants USERS] [-invite USERS]
+               [-name NAME] [-description TEXT] [-repeat once|daily|weekly|yearly|workdays]
+               [-calendar CALENDAR] [-strict]
+  event show ID
+  event cancel -version VERSION ID
+  agenda -user USER [-calendar CALENDAR] [-week]
+  accept -user USER -version VERSION [-strict] EVENT
+  decline -user USER -version VERSION EVENT
+  slot -users USERS -duration DURATION [-from TIME] [-until TIME] [-granularity DURATION] [-buffer DURATION]
+
+Times are written like "tomorrow 10:00", "friday", "in 2h", "2022-09-05 10:00" or in RFC 3339,
+durations like "30m", "1h30m" or "2d". Lists of users are separated by commas.
+Changes of events are applied only to the version shown by "event show", -version -1 applies them
+to any version.
+`
+
+var repeatTypes = map[string]client.RepeatType{
+	"once":     client.Once,
+	"daily":    client.Daily,
+	"weekly":   client.Weekly,
+	"yearly":   client.Yearly,
+	"workdays": client.Workdays,
+}
+
+var errUsage = errors.New("wrong usage, run calctl -help")
+
+type cli struct {
+	client *client.Client
+	out    io.Writer
+	errOut io.Writer
+	json   bool      //print results as JSON instead of text
+	now    time.Time //moment relative times are counted from
+}
+
+func main() {
+	if err := run(context.Background(), os.Args[1:], os.Stdout, os.Stderr, time.Now()); err != nil {
+		fmt.Fprintln(os.Stderr, "calctl:", err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, args []string, out io.Writer, errOut io.Writer, now time.Time) error {
+	flags := flag.NewFlagSet("calctl", flag.ContinueOnError)
+	flags.SetOutput(errOut)
+	flags.Usage = func() { fmt.Fprint(errOut, usage) }
+	server := os.Getenv("CALENDAR_SERVER")
+	if server == "" {
+		server = "http://127.0.0.1:8080"
+	}
+	flags.StringVar(&server, "server", server, "address of the calendar, CALENDAR_SERVER by default")
+	apiKey := flags.String("key", os.Getenv("CALENDAR_API_KEY"), "API key of the organization, CALENDAR_API_KEY by default")
+	asJSON := flags.Bool("json", false, "print results as JSON")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	c := &cli{client: client.New(server, client.WithAPIKey(*apiKey)), out: out, errOut: errOut, json: *asJSON, now: now}
+
+	args = flags.Args()
+	if len(args) == 0 {
+		return errUsage
+	}
+	switch command := strings.Join(args[:min(2, len(args))], " "); {
+	case command == "user create":
+		return c.createUser(ctx, args[2:])
+	case command == "user show":
+		return c.showUser(ctx, args[2:])
+	case command == "calendar create":
+		return c.createCalendar(ctx, args[2:])
+	case command == "calendar list":
+		return c.listCalendars(ctx, args[2:])
+	case command == "event create":
+		return c.createEvent(ctx, args[2:])
+	case command == "event show":
+		return c.showEvent(ctx, args[2:])
+	case command == "event cancel":
+		return c.cancelEvent(ctx, args[2:])
+	case args[0] == "agenda":
+		return c.agenda(ctx, args[1:])
+	case args[0] == "accept":
+		return c.accept(ctx, args[1:])
+	case args[0] == "decline":
+		return c.decline(ctx, args[1:])
+	case args[0] == "slot":
+		return c.slot(ctx, args[1:])
+	}
+	return errUsage
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// newFlags returns the flag set of the command which reports errors like the main one.
+func (c *cli) newFlags(name string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(c.errOut)
+	return flags
+}
+
+// versionFlag defines the required flag with the version of the event which the change is applied to.
+// Zero means the flag isn't set, as versions start from one.
+func versionFlag(flags *flag.FlagSet) *int {
+	return flags.Int("version", 0, "change only this version of the event, -1 for any version")
+}
+
+// oneArgument parses flags and returns the only positional argument.
+func oneArgument(flags *flag.FlagSet, args []string) (string, error) {
+	if err := flags.Parse(args); err != nil {
+		return "", err
+	}
+	if flags.NArg() != 1 {
+		return "", errUsage
+	}
+	return flags.Arg(0), nil
+}
+
+// splitList splits comma separated values, skipping empty ones.
+func splitList(value string) []string {
+	var result []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// print writes the value as JSON in JSON mode and the text otherwise.
+func (c *cli) print(value interface{}, text string) error {
+	if c.json {
+		encoder := json.NewEncoder(c.out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(value)
+	}
+	_, err := fmt.Fprintln(c.out, text)
+	return err
+}
+
+func (c *cli) printWarnings(warnings []client.Conflict) {
+	for _, warning := range warnings {
+		fmt.Fprintf(c.out, "warning: %s is busy with %s from %s to %s\n", warning.User, warning.Event,
+			formatTime(warning.Start), formatTime(warning.Finish))
+	}
+}
+
+func formatTime(t time.Time) string {
+	return t.Local().Format("Mon 02 Jan 15:04")
+}
+
+func (c *cli) createUser(ctx context.Context, args []string) error {
+	flags := c.newFlags("user create")
+	name := flags.String("name", "", "name of the user")
+	email := flags.String("email", "", "email for invitations")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *name == "" {
+		return errUsage
+	}
+	id, err := c.client.CreateUser(ctx, client.UserInfo{Name: *name, Email: *email})
+	if err != nil {
+		return err
+	}
+	return c.print(map[string]string{"id": id}, id)
+}
+
+func (c *cli) showUser(ctx context.Context, args []string) error {
+	id, err := oneArgument(c.newFlags("user show"), args)
+	if err != nil {
+		return err
+	}
+	user, err := c.client.GetUser(ctx, id)
+	if err != nil {
+		return err
+	}
+	text := user.Info.Name
+	if user.Info.Email != "" {
+		text += " <" + user.Info.Email + ">"
+	}
+	return c.print(user, text)
+}
+
+func (c *cli) createCalendar(ctx context.Context, args []string) error {
+	flags := c.newFlags("calendar create")
+	user := flags.String("user", "", "owner of the calendar")
+	name := flags.String("name", "", "name of the calendar")
+	color := flags.String("color", "", "color like #4285f4")
+	private := flags.Bool("private", false, "make new events private")
+	transparent := flags.Bool("transparent", false, "don't count events as busy time")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *user == "" || *name == "" || flags.NArg() != 0 {
+		return errUsage
+	}
+	info := client.CalendarInfo{Name: *name, Color: *color, Transparent: *transparent}
+	if *private {
+		info.Visibility = client.Private
+	}
+	id, err := c.client.CreateCalendar(ctx, *user, info)
+	if err != nil {
+		return err
+	}
+	return c.print(map[string]string{"id": id}, id)
+}
+
+func (c *cli) listCalendars(ctx context.Context, args []string) error {
+	flags := c.newFlags("calendar list")
+	user := flags.String("user", "", "owner of calendars")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *user == "" || flags.NArg() != 0 {
+		return errUsage
+	}
+	calendars, err := c.client.ListCalendars(ctx, *user)
+	if err != nil {
+		return err
+	}
+	if c.json {
+		return c.print(calendars, "")
+	}
+	if len(calendars) == 0 {
+		return c.print(nil, "no calendars")
+	}
+	w := tabwriter.NewWriter(c.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tCOLOR\tVISIBILITY\tID")
+	for _, calendar := range calendars {
+		visibility := calendar.Info.Visibility
+		if visibility == "" {
+			visibility = client.Public
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", calendar.Info.Name, calendar.Info.Color, visibility, calendar.ID)
+	}
+	return w.Flush()
+}
+
+func (c *cli) createEvent(ctx context.Context, args []string) error {
+	flags := c.newFlags("event create")
+	organizer := flags.String("organizer", "", "user who creates the event")
+	start := flags.String("start", "", "start time")
+	duration := flags.String("duration", "1h", "duration")
+	participants := flags.String("participants", "", "users who take part without invitation")
+	invite := flags.String("invite", "", "invited users")
+	name := flags.String("name", "", "name of the event")
+	description := flags.String("description", "", "description of the event")
+	repeat := flags.String("repeat", "once", "repetition: once, daily, weekly, yearly or workdays")
+	calendar := flags.String("calendar", "", "calendar of the organizer containing the event")
+	strict := flags.Bool("strict", false, "refuse the event if participants are busy")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *organizer == "" || *start == "" || flags.NArg() != 0 {
+		return errUsage
+	}
+	begin, err := parseTime(*start, c.now)
+	if err != nil {
+		return err
+	}
+	length, err := parseDuration(*duration)
+	if err != nil {
+		return err
+	}
+	repeatType, ok := repeatTypes[*repeat]
+	if !ok {
+		return fmt.Errorf("wrong repetition %q", *repeat)
+	}
+	event := client.Event{
+		Organizer:    *organizer,
+		Participants: []string{*organizer},
+		Candidates:   splitList(*invite),
+		Start:        begin,
+		Finish:       begin.Add(length),
+		RepeatType:   repeatType,
+		Info:         client.EventInfo{Name: *name, Description: *description},
+		Calendar:     *calendar,
+	}
+	for _, participant := range splitList(*participants) {
+		if participant != *organizer {
+			event.Participants = append(event.Participants, participant)
+		}
+	}
+	id, warnings, err := c.client.CreateEvent(ctx, event, *strict)
+	if err != nil {
+		return err
+	}
+	if c.json {
+		return c.print(map[string]interface{}{"id": id, "warnings": warnings}, "")
+	}
+	c.printWarnings(warnings)
+	return c.print(nil, id)
+}
+
+func (c *cli) showEvent(ctx context.Context, args []string) error {
+	id, err := oneArgument(c.newFlags("event show"), args)
+	if err != nil {
+		return err
+	}
+	event, err := c.client.GetEvent(ctx, id)
+	if err != nil {
+		return err
+	}
+	if c.json {
+		return c.print(event, "")
+	}
+	w := tabwriter.NewWriter(c.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Name:\t%s\n", event.Info.Name)
+	if event.Info.Description != "" {
+		fmt.Fprintf(w, "Description:\t%s\n", event.Info.Description)
+	}
+	fmt.Fprintf(w, "Start:\t%s\n", formatTime(event.Start))
+	fmt.Fprintf(w, "Finish:\t%s\n", formatTime(event.Finish))
+	for name, repeatType := range repeatTypes {
+		if repeatType == event.RepeatType {
+			fmt.Fprintf(w, "Repeat:\t%s\n", name)
+		}
+	}
+	fmt.Fprintf(w, "Organizer:\t%s\n", event.Organizer)
+	fmt.Fprintf(w, "Participants:\t%s\n", strings.Join(event.Participants, ", "))
+	fmt.Fprintf(w, "Invited:\t%s\n", strings.Join(event.Candidates, ", "))
+	fmt.Fprintf(w, "Version:\t%d\n", event.Version)
+	return w.Flush()
+}
+
+func (c *cli) cancelEvent(ctx context.Context, args []string) error {
+	flags := c.newFlags("event cancel")
+	version := versionFlag(flags)
+	id, err := oneArgument(flags, args)
+	if err != nil {
+		return err
+	}
+	if *version == 0 {
+		return errUsage
+	}
+	if err := c.client.CancelEvent(client.IfMatch(ctx, *version), id); err != nil {
+		return err
+	}
+	return c.print(struct{}{}, "cancelled")
+}
+
+func (c *cli) agenda(ctx context.Context, args []string) error {
+	flags := c.newFlags("agenda")
+	user := flags.String("user", "", "owner of the agenda")
+	calendar := flags.String("calendar", "", "show only events of the user's calendar")
+	week := flags.Bool("week", false, "show this week instead of today")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *user == "" || flags.NArg() != 0 {
+		return errUsage
+	}
+	from, to := startOfDay(c.now), startOfDay(c.now).AddDate(0, 0, 1)
+	if *week {
+		from = startOfWeek(c.now)
+		to = from.AddDate(0, 0, 7)
+	}
+	events, err := c.client.ListCalendarEvents(ctx, *user, *calendar, from, to)
+	if err != nil {
+		return err
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Start.Before(events[j].Start)
+	})
+	if c.json {
+		return c.print(events, "")
+	}
+	if len(events) == 0 {
+		return c.print(nil, "no events")
+	}
+	w := tabwriter.NewWriter(c.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "START\tFINISH\tNAME\tID")
+	for _, event := range events {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", formatTime(event.Start), formatTime(event.Finish), event.Info.Name, event.ID)
+	}
+	return w.Flush()
+}
+
+func (c *cli) accept(ctx context.Context, args []string) error {
+	flags := c.newFlags("accept")
+	user := flags.String("user", "", "invited user")
+	strict := flags.Bool("strict", false, "refuse if the user is busy")
+	version := versionFlag(flags)
+	event, err := oneArgument(flags, args)
+	if err != nil {
+		return err
+	}
+	if *user == "" || *version == 0 {
+		return errUsage
+	}
+	warnings, err := c.client.Accept(client.IfMatch(ctx, *version), *user, event, *strict)
+	if err != nil {
+		return err
+	}
+	if c.json {
+		return c.print(map[string]interface{}{"warnings": warnings}, "")
+	}
+	c.printWarnings(warnings)
+	return c.print(nil, "accepted")
+}
+
+func (c *cli) decline(ctx context.Context, args []string) error {
+	flags := c.newFlags("decline")
+	user := flags.String("user", "", "invited user")
+	version := versionFlag(flags)
+	event, err := oneArgument(flags, args)
+	if err != nil {
+		return err
+	}
+	if *user == "" || *version == 0 {
+		return errUsage
+	}
+	if err := c.client.Reject(client.IfMatch(ctx, *version), *user, event); err != nil {
+		return err
+	}
+	return c.print(struct{}{}, "declined")
+}
+
+func (c *cli) slot(ctx context.Context, args []string) error {
+	flags := c.newFlags("slot")
+	users := flags.String("users", "", "users who have to be free")
+	duration := flags.String("duration", "1h", "duration of the slot")
+	from := flags.String("from", "now", "start of the search")
+	until := flags.String("until", "in 7d", "end of the search")
+	granularity := flags.String("granularity", "0s", "alignment of the slot start")
+	buffer := flags.String("buffer", "0s", "free time required around existing events")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *users == "" || flags.NArg() != 0 {
+		return errUsage
+	}
+	query := client.SlotQuery{Users: splitList(*users)}
+	var err error
+	if query.Duration, err = parseDuration(*duration); err != nil {
+		return err
+	}
+	if query.From, err = parseTime(*from, c.now); err != nil {
+		return err
+	}
+	if query.ValidUntil, err = parseTime(*until, c.now); err != nil {
+		return err
+	}
+	if query.Granularity, err = parseDuration(*granularity); err != nil {
+		return err
+	}
+	if query.BufferBefore, err = parseDuration(*buffer); err != nil {
+		return err
+	}
+	query.BufferAfter = query.BufferBefore
+	begin, err := c.client.FindSlot(ctx, query)
+	if err != nil {
+		return err
+	}
+	return c.print(map[string]time.Time{"begin": begin}, formatTime(begin)+" - "+formatTime(begin.Add(query.Duration)))
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nivanov045/calendar/internal/api"
+	"github.com/nivanov045/calendar/internal/service"
+	"github.com/nivanov045/calendar/internal/storage"
+)
+
+func Test_run(t *testing.T) {
+	server := httptest.NewServer(api.New(service.New(storage.New(), nil, nil)).Router())
+	defer server.Close()
+	now := time.Date(2022, 9, 7, 8, 0, 0, 0, time.Local)
+	calctl := func(args ...string) string {
+		var out bytes.Buffer
+		err := run(context.Background(), append([]string{"-server", server.URL}, args...), &out, io.Discard, now)
+		if err != nil {
+			t.Fatalf("calctl %v: %v", args, err)
+		}
+		return strings.TrimSpace(out.String())
+	}
+
+	organizer := calctl("user", "create", "-name", "Anna")
+	guest := calctl("user", "create", "-name", "Boris", "-email", "boris@example.com")
+	if got := calctl("user", "show", guest); got != "Boris <boris@example.com>" {
+		t.Errorf("user show = %q", got)
+	}
+
+	event := calctl("event", "create", "-organizer", organizer, "-invite", guest,
+		"-start", "today 10:00", "-duration", "30m", "-name", "Planning", "-repeat", "daily")
+	if got := calctl("event", "show", event); !strings.Contains(got, "Planning") || !strings.Contains(got, "daily") {
+		t.Errorf("event show = %q", got)
+	}
+
+	if got := calctl("agenda", "-user", guest); got != "no events" {
+		t.Errorf("agenda before accepting = %q", got)
+	}
+	calctl("accept", "-user", guest, "-version", "1", event)
+	if got := calctl("agenda", "-user", guest); !strings.Contains(got, "Planning") {
+		t.Errorf("agenda = %q", got)
+	}
+	var week []map[string]interface{}
+	if err := json.Unmarshal([]byte(calctl("-json", "agenda", "-user", guest, "-week")), &week); err != nil {
+		t.Fatal(err)
+	}
+	// Wednesday through Sunday
+	if len(week) != 5 {
+		t.Errorf("agenda of the week has %d events, want 5", len(week))
+	}
+
+	var slot struct {
+		Begin time.Time `json:"begin"`
+	}
+	if err := json.Unmarshal([]byte(calctl("-json", "slot", "-users", organizer+","+guest,
+		"-duration", "1h", "-from", "today 9:30", "-until", "tomorrow")), &slot); err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2022, 9, 7, 10, 30, 0, 0, time.Local); !slot.Begin.Equal(want) {
+		t.Errorf("slot begins at %v, want %v", slot.Begin, want)
+	}
+
+	onCall := calctl("calendar", "create", "-user", organizer, "-name", "on-call", "-color", "#d50000", "-transparent")
+	if got := calctl("calendar", "list", "-user", organizer); !strings.Contains(got, "on-call") || !strings.Contains(got, onCall) {
+		t.Errorf("calendar list = %q", got)
+	}
+	calctl("event", "create", "-organizer", organizer, "-start", "today 12:00", "-name", "Duty", "-calendar", onCall)
+	if got := calctl("agenda", "-user", organizer, "-calendar", onCall); !strings.Contains(got, "Duty") || strings.Contains(got, "Planning") {
+		t.Errorf("agenda of calendar = %q", got)
+	}
+
+	retro := calctl("event", "create", "-organizer", organizer, "-invite", guest, "-start", "friday 17:00", "-name", "Retro")
+	if err := run(context.Background(), []string{"-server", server.URL, "decline", "-user", guest, retro}, io.Discard, io.Discard, now); err != errUsage {
+		t.Errorf("decline without version error = %v, want %v", err, errUsage)
+	}
+	calctl("decline", "-user", guest, "-version", "1", retro)
+	if got := calctl("event", "show", retro); strings.Contains(got, guest) {
+		t.Errorf("event show after decline = %q", got)
+	}
+	calctl("event", "cancel", "-version", "-1", event)
+
+	err := run(context.Background(), []string{"-server", server.URL, "event", "show", event}, io.Discard, io.Discard, now)
+	if err == nil {
+		t.Error("event show of cancelled event succeeded")
+	}
+	if err := run(context.Background(), []string{"unknown"}, io.Discard, io.Discard, now); err != errUsage {
+		t.Errorf("unknown command error = %v, want %v", err, errUsage)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var weekdays = map[string]time.Weekday{
+	"sunday":    time.Sunday,
+	"monday":    time.Monday,
+	"tuesday":   time.Tuesday,
+	"wednesday": time.Wednesday,
+	"thursday":  time.Thursday,
+	"friday":    time.Friday,
+	"saturday":  time.Saturday,
+}
+
+// parseDuration accepts Go durations like "1h30m" and days like "2d".
+func parseDuration(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if strings.HasSuffix(value, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(value, "d"))
+		if err != nil {
+			return 0, fmt.Errorf("wrong duration %q", value)
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("wrong duration %q", value)
+	}
+	return duration, nil
+}
+
+// startOfDay returns midnight of the day of t in its location.
+func startOfDay(t time.Time) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+}
+
+// parseTime understands RFC 3339, "2006-01-02 15:04", "now", "in 2h", and a day
+// ("today", "tomorrow", "yesterday", a weekday or "2006-01-02") optionally followed by "15:04".
+// A day without time means its midnight, a time without day means today.
+func parseTime(value string, now time.Time) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if parsed, err := time.Parse(time.RFC3339, value); err == nil {
+		return parsed, nil
+	}
+	value = strings.ToLower(value)
+	if value == "now" {
+		return now, nil
+	}
+	if strings.HasPrefix(value, "in ") {
+		duration, err := parseDuration(strings.TrimPrefix(value, "in "))
+		if err != nil {
+			return time.Time{}, err
+		}
+		return now.Add(duration), nil
+	}
+	fields := strings.Fields(value)
+	if len(fields) == 0 || len(fields) > 2 {
+		return time.Time{}, fmt.Errorf("wrong time %q", value)
+	}
+	day := startOfDay(now)
+	clock := fields[len(fields)-1]
+	if len(fields) == 2 || !strings.Contains(clock, ":") {
+		var err error
+		day, err = parseDay(fields[0], now)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if len(fields) == 1 {
+			return day, nil
+		}
+	}
+	parsed, err := time.Parse("15:04", clock)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("wrong time %q", value)
+	}
+	return day.Add(time.Duration(parsed.Hour())*time.Hour + time.Duration(parsed.Minute())*time.Minute), nil
+}
+
+// parseDay returns midnight of the named day, weekdays are looked up from tomorrow on.
+func parseDay(value string, now time.Time) (time.Time, error) {
+	today := startOfDay(now)
+	switch value {
+	case "today":
+		return today, nil
+	case "tomorrow":
+		return today.AddDate(0, 0, 1), nil
+	case "yesterday":
+		return today.AddDate(0, 0, -1), nil
+	}
+	if weekday, ok := weekdays[value]; ok {
+		days := (int(weekday)-int(now.Weekday())+6)%7 + 1
+		return today.AddDate(0, 0, days), nil
+	}
+	parsed, err := time.ParseInLocation("2006-01-02", value, now.Location())
+	if err != nil {
+		return time.Time{}, errors.New("wrong day " + strconv.Quote(value))
+	}
+	return parsed, nil
+}
+
+// startOfWeek returns midnight of Monday of the week of t.
+func startOfWeek(t time.Time) time.Time {
+	return startOfDay(t).AddDate(0, 0, -(int(t.Weekday())+6)%7)
+}
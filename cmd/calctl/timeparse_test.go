@@ -0,0 +1,52 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_parseTime(t *testing.T) {
+	// Wednesday
+	now := time.Date(2022, 9, 7, 15, 30, 0, 0, time.UTC)
+	tests := []struct {
+		value   string
+		want    time.Time
+		wantErr bool
+	}{
+		{value: "now", want: now},
+		{value: "in 2h", want: now.Add(2 * time.Hour)},
+		{value: "in 1d", want: now.Add(24 * time.Hour)},
+		{value: "today", want: time.Date(2022, 9, 7, 0, 0, 0, 0, time.UTC)},
+		{value: "tomorrow 10:00", want: time.Date(2022, 9, 8, 10, 0, 0, 0, time.UTC)},
+		{value: "Yesterday 9:05", want: time.Date(2022, 9, 6, 9, 5, 0, 0, time.UTC)},
+		{value: "18:00", want: time.Date(2022, 9, 7, 18, 0, 0, 0, time.UTC)},
+		{value: "friday 11:30", want: time.Date(2022, 9, 9, 11, 30, 0, 0, time.UTC)},
+		{value: "wednesday", want: time.Date(2022, 9, 14, 0, 0, 0, 0, time.UTC)},
+		{value: "2022-10-01 08:00", want: time.Date(2022, 10, 1, 8, 0, 0, 0, time.UTC)},
+		{value: "2022-10-01T08:00:00Z", want: time.Date(2022, 10, 1, 8, 0, 0, 0, time.UTC)},
+		{value: "someday", wantErr: true},
+		{value: "tomorrow 25:00", wantErr: true},
+		{value: "in a while", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseTime(tt.value, now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseTime() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !got.Equal(tt.want) {
+				t.Errorf("parseTime() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_startOfWeek(t *testing.T) {
+	monday := time.Date(2022, 9, 5, 0, 0, 0, 0, time.UTC)
+	for day := 0; day < 7; day++ {
+		now := monday.AddDate(0, 0, day).Add(13 * time.Hour)
+		if got := startOfWeek(now); !got.Equal(monday) {
+			t.Errorf("startOfWeek(%v) = %v, want %v", now, got, monday)
+		}
+	}
+}
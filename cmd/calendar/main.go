@@ -1,14 +1,27 @@
 package main
 
 import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"github.com/rs/zerolog/pkgerrors"
 
+	"github.com/nivanov045/calendar/internal"
 	"github.com/nivanov045/calendar/internal/api"
 	"github.com/nivanov045/calendar/internal/config"
+	"github.com/nivanov045/calendar/internal/idempotency"
+	"github.com/nivanov045/calendar/internal/imip"
+	"github.com/nivanov045/calendar/internal/pubsub"
+	"github.com/nivanov045/calendar/internal/reminder"
+	"github.com/nivanov045/calendar/internal/rpc"
 	"github.com/nivanov045/calendar/internal/service"
 	"github.com/nivanov045/calendar/internal/storage"
+	"github.com/nivanov045/calendar/internal/tenant"
+	"github.com/nivanov045/calendar/internal/webhook"
 )
 
 func main() {
@@ -20,11 +33,60 @@ func main() {
 		log.Panic().Err(err).Stack()
 	}
 
-	myStorage := storage.New()
+	// background work of all scopes stops when the server is interrupted
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// every organization has its own storage, webhooks, streams and reminders
+	newScope := func(internal.Organization) service.Scope {
+		webhooks := webhook.New(cfg.WebhookAttempts, cfg.WebhookBackoff)
+
+		changes := pubsub.New(cfg.StreamHistory)
+
+		myStorage := storage.New(
+			storage.WithNotifier(webhooks),
+			storage.WithNotifier(changes),
+			storage.WithTombstoneRetention(cfg.TombstoneRetention),
+			storage.WithRevisionRetention(cfg.RevisionRetention),
+		)
+		if cfg.SMTPAddress != "" {
+			myStorage.AddNotifier(imip.New(myStorage, cfg.SMTPAddress, cfg.SMTPFrom, cfg.SMTPUsername, cfg.SMTPPassword))
+		}
+
+		scheduler := reminder.New(myStorage, reminder.NewLogNotifier(), cfg.ReminderInterval, cfg.ReminderLookahead)
+		scopeCtx, stopScope := context.WithCancel(ctx)
+		go scheduler.Run(scopeCtx)
+
+		return service.Scope{Storage: myStorage, Webhooks: webhooks, Changes: changes, Stop: stopScope}
+	}
+
+	serviceOptions := []service.Option{service.WithReminderLookahead(cfg.ReminderLookahead)}
+	apiOptions := []api.Option{api.WithIdempotency(idempotency.New(cfg.IdempotencyRetention))}
+	var rpcOptions []rpc.Option
+	if cfg.Organizations != "" {
+		tenants, err := tenant.Load(cfg.Organizations)
+		if err != nil {
+			log.Panic().Err(err).Stack()
+		}
+		serviceOptions = append(serviceOptions, service.WithTenants(newScope))
+		apiOptions = append(apiOptions, api.WithTenants(tenants))
+		rpcOptions = append(rpcOptions, rpc.WithTenants(tenants))
+	}
+
+	scope := newScope(internal.Organization{})
+	defer scope.Stop()
+	serv := service.New(scope.Storage, scope.Webhooks, scope.Changes, serviceOptions...)
+	defer serv.Close()
 
-	serv := service.New(myStorage)
+	go func() {
+		log.Panic().Err(rpc.New(serv, rpcOptions...).Run(cfg.GRPCAddress)).Stack()
+	}()
 
-	myapi := api.New(serv)
+	myapi := api.New(serv, apiOptions...)
+	go func() {
+		log.Panic().Err(myapi.Run(cfg.Address)).Stack()
+	}()
 
-	log.Panic().Err(myapi.Run(cfg.Address)).Stack()
+	<-ctx.Done()
+	log.Info().Msg("shutting down")
 }
@@ -1,208 +1,548 @@
 package api
 
 import (
+	"encoding/json"
+	"errors"
 	"io/ioutil"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/go-chi/chi"
 	"github.com/go-chi/chi/middleware"
 	"github.com/rs/zerolog/log"
+
+	"github.com/nivanov045/calendar/internal"
+	"github.com/nivanov045/calendar/internal/audit"
+	"github.com/nivanov045/calendar/internal/tenant"
+	"github.com/nivanov045/calendar/internal/webhook"
 )
 
 type api struct {
-	service Service
+	service     Service
+	tenants     Tenants
+	idempotency Idempotency
 }
 
-func New(service Service) *api {
-	return &api{service: service}
+type Option func(*api)
+
+// WithTenants makes every request except the OpenAPI document authenticate with the API key of an organization
+// in the header "Authorization: Bearer <key>".
+func WithTenants(tenants Tenants) Option {
+	return func(a *api) {
+		a.tenants = tenants
+	}
+}
+
+// WithIdempotency makes POST requests with the header "Idempotency-Key" saved in the store,
+// retries with the same key and body get the original response.
+func WithIdempotency(idempotency Idempotency) Option {
+	return func(a *api) {
+		a.idempotency = idempotency
+	}
+}
+
+func New(service Service, options ...Option) *api {
+	a := &api{service: service}
+	for _, option := range options {
+		option(a)
+	}
+	return a
 }
 
 func (a *api) Run(address string) error {
+	return http.ListenAndServe(address, a.Router())
+}
+
+// Router returns the handler with all routes of the API.
+func (a *api) Router() chi.Router {
 	r := chi.NewRouter()
 
 	r.Use(middleware.RequestID)
 	r.Use(middleware.RealIP)
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
+	r.Use(withActor)
+
+	r.Get("/openapi.json", openAPIHandler)
+
+	r.Group(a.routeV1)
 
+	r.Route("/v2", a.routeV2)
+
+	return r
+}
+
+// routeV1 adds routes of the first version of the API.
+func (a *api) routeV1(r chi.Router) {
+	r.Use(a.authenticate)
+	r.Use(a.idempotent)
 	r.Post("/create-user/", a.createUserHandler)
+	r.Get("/user-details/", a.getUserDetailsHandler)
+	r.Post("/update-user/", a.updateUserHandler)
+	r.Post("/deactivate-user/", a.deactivateUserHandler)
+	r.Get("/users/", a.listUsersHandler)
+	r.Post("/create-group/", a.createGroupHandler)
+	r.Get("/group-details/", a.getGroupDetailsHandler)
+	r.Post("/update-group/", a.updateGroupHandler)
+	r.Post("/delete-group/", a.deleteGroupHandler)
+	r.Post("/create-calendar/", a.createCalendarHandler)
+	r.Get("/calendar-details/", a.getCalendarDetailsHandler)
+	r.Post("/update-calendar/", a.updateCalendarHandler)
+	r.Post("/delete-calendar/", a.deleteCalendarHandler)
+	r.Get("/calendars/", a.listCalendarsHandler)
 	r.Post("/create-event-with-users/", a.createEventWithUsersHandler)
 	r.Get("/event-details/", a.getEventDetailsHandler)
+	r.Post("/cancel-event/", a.cancelEventHandler)
 	r.Post("/accept-invitation/", a.acceptInvitationHandler)
 	r.Post("/reject-invitation/", a.rejectInvitationHandler)
 	r.Get("/events/", a.getEventsHandler)
 	r.Get("/find-slot/", a.findSlotHandler)
+	r.Post("/book-slot/", a.bookSlotHandler)
+	r.Post("/create-webhook/", a.createWebhookHandler)
+	r.Post("/delete-webhook/", a.deleteWebhookHandler)
+	r.Get("/webhook-deliveries/", a.getWebhookDeliveriesHandler)
+	r.Post("/itip/", a.processITIPHandler)
+	r.Get("/counter-proposals/", a.getCounterProposalsHandler)
+	r.Get("/audit-log/", a.getAuditLogHandler)
+	r.Get("/event-history/", a.getEventHistoryHandler)
+	r.Post("/restore-event/", a.restoreEventHandler)
+	r.Get("/sync/", a.syncHandler)
+	r.Get("/stream/", a.streamHandler)
+	r.Get("/ws/", a.webSocketHandler)
+}
 
-	return http.ListenAndServe(address, r)
+// withActor passes the request with the user from the header "X-Actor" who the client says makes it,
+// for the audit log.
+func withActor(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if actor := r.Header.Get("X-Actor"); actor != "" {
+			r = r.WithContext(audit.WithClaimedActor(r.Context(), actor))
+		}
+		next.ServeHTTP(w, r)
+	})
 }
 
-func (a *api) createUserHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("content-type", "application/json")
+// authenticate passes the request on behalf of the organization of its API key, if organizations are set.
+func (a *api) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if a.tenants == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		key := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		organization, err := a.tenants.Authenticate(key)
+		if err != nil {
+			respondV2(w, 0, nil, err)
+			return
+		}
+		ctx := audit.WithCaller(tenant.NewContext(r.Context(), organization), tenant.KeyID(key))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// eventTag returns the ETag of the version of an event.
+func eventTag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// ifMatch sets version to the version of the event from the header "If-Match", the header takes precedence over
+// the version in the body and "*" matches any version.
+func ifMatch(r *http.Request, version *int) error {
+	tag := r.Header.Get("If-Match")
+	switch {
+	case tag == "":
+		return nil
+	case tag == "*":
+		*version = internal.AnyVersion
+		return nil
+	case len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"':
+		return errors.New("wrong query")
+	}
+	parsed, err := strconv.Atoi(tag[1 : len(tag)-1])
+	if err != nil || parsed <= 0 {
+		return errors.New("wrong query")
+	}
+	*version = parsed
+	return nil
+}
+
+// decode reads the JSON body of the request into v.
+func decode(r *http.Request, v interface{}) error {
 	defer r.Body.Close()
 	requestBody, err := ioutil.ReadAll(r.Body)
 	if err != nil {
 		log.Error().Err(err).Stack()
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte("{}"))
-		return
+		return errors.New("wrong query")
 	}
-	resp, err := a.service.CreateUser(requestBody)
-	if err != nil {
+	if err := json.Unmarshal(requestBody, v); err != nil {
 		log.Error().Err(err).Stack()
-		if err.Error() == "wrong query" {
-			w.WriteHeader(http.StatusBadRequest)
-		} else {
-			w.WriteHeader(http.StatusNotFound)
-		}
-		w.Write([]byte("{}"))
-		return
+		return errors.New("wrong query")
 	}
-	w.WriteHeader(http.StatusOK)
-	w.Write(resp)
+	return nil
 }
 
-func (a *api) createEventWithUsersHandler(w http.ResponseWriter, r *http.Request) {
+// respond writes the response of the service as JSON or "{}" with the status of the error.
+func respond(w http.ResponseWriter, resp interface{}, err error) {
 	w.Header().Set("content-type", "application/json")
-	defer r.Body.Close()
-	requestBody, err := ioutil.ReadAll(r.Body)
 	if err != nil {
 		log.Error().Err(err).Stack()
-		w.WriteHeader(http.StatusBadRequest)
+		w.WriteHeader(statusOf(err))
 		w.Write([]byte("{}"))
 		return
 	}
-	resp, err := a.service.CreateEventWithUsers(requestBody)
-	if err != nil {
-		log.Error().Err(err).Stack()
-		if err.Error() == "wrong query" || err.Error() == "wrong repeat type" {
-			w.WriteHeader(http.StatusBadRequest)
-		} else {
-			w.WriteHeader(http.StatusNotFound)
+	marshal := []byte("{}")
+	if resp != nil {
+		marshal, err = json.Marshal(resp)
+		if err != nil {
+			log.Error().Err(err).Stack()
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("{}"))
+			return
 		}
-		w.Write([]byte("{}"))
-		return
 	}
 	w.WriteHeader(http.StatusOK)
-	w.Write(resp)
+	w.Write(marshal)
+}
+
+func (a *api) createUserHandler(w http.ResponseWriter, r *http.Request) {
+	var request internal.CreateUserRequest
+	if err := decode(r, &request); err != nil {
+		respond(w, nil, err)
+		return
+	}
+	resp, err := a.service.CreateUser(r.Context(), request)
+	respond(w, resp, err)
+}
+
+func (a *api) getUserDetailsHandler(w http.ResponseWriter, r *http.Request) {
+	var request internal.UserRequest
+	if err := decode(r, &request); err != nil {
+		respond(w, nil, err)
+		return
+	}
+	resp, err := a.service.GetUser(r.Context(), request)
+	respond(w, resp, err)
+}
+
+func (a *api) updateUserHandler(w http.ResponseWriter, r *http.Request) {
+	var request internal.UpdateUserRequest
+	if err := decode(r, &request); err != nil {
+		respond(w, nil, err)
+		return
+	}
+	resp, err := a.service.UpdateUser(r.Context(), request)
+	respond(w, resp, err)
+}
+
+func (a *api) deactivateUserHandler(w http.ResponseWriter, r *http.Request) {
+	var request internal.UserRequest
+	if err := decode(r, &request); err != nil {
+		respond(w, nil, err)
+		return
+	}
+	respond(w, nil, a.service.DeactivateUser(r.Context(), request))
+}
+
+func (a *api) listUsersHandler(w http.ResponseWriter, r *http.Request) {
+	var request internal.ListUsersRequest
+	if err := decode(r, &request); err != nil {
+		respond(w, nil, err)
+		return
+	}
+	resp, err := a.service.ListUsers(r.Context(), request)
+	respond(w, resp, err)
+}
+
+func (a *api) createGroupHandler(w http.ResponseWriter, r *http.Request) {
+	var request internal.CreateGroupRequest
+	if err := decode(r, &request); err != nil {
+		respond(w, nil, err)
+		return
+	}
+	resp, err := a.service.CreateGroup(r.Context(), request)
+	respond(w, resp, err)
+}
+
+func (a *api) getGroupDetailsHandler(w http.ResponseWriter, r *http.Request) {
+	var request internal.GroupRequest
+	if err := decode(r, &request); err != nil {
+		respond(w, nil, err)
+		return
+	}
+	resp, err := a.service.GetGroup(r.Context(), request)
+	respond(w, resp, err)
+}
+
+func (a *api) updateGroupHandler(w http.ResponseWriter, r *http.Request) {
+	var request internal.UpdateGroupRequest
+	if err := decode(r, &request); err != nil {
+		respond(w, nil, err)
+		return
+	}
+	resp, err := a.service.UpdateGroup(r.Context(), request)
+	respond(w, resp, err)
+}
+
+func (a *api) deleteGroupHandler(w http.ResponseWriter, r *http.Request) {
+	var request internal.GroupRequest
+	if err := decode(r, &request); err != nil {
+		respond(w, nil, err)
+		return
+	}
+	respond(w, nil, a.service.DeleteGroup(r.Context(), request))
+}
+
+func (a *api) createCalendarHandler(w http.ResponseWriter, r *http.Request) {
+	var request internal.CreateCalendarRequest
+	if err := decode(r, &request); err != nil {
+		respond(w, nil, err)
+		return
+	}
+	resp, err := a.service.CreateCalendar(r.Context(), request)
+	respond(w, resp, err)
+}
+
+func (a *api) getCalendarDetailsHandler(w http.ResponseWriter, r *http.Request) {
+	var request internal.CalendarRequest
+	if err := decode(r, &request); err != nil {
+		respond(w, nil, err)
+		return
+	}
+	resp, err := a.service.GetCalendar(r.Context(), request)
+	respond(w, resp, err)
+}
+
+func (a *api) updateCalendarHandler(w http.ResponseWriter, r *http.Request) {
+	var request internal.UpdateCalendarRequest
+	if err := decode(r, &request); err != nil {
+		respond(w, nil, err)
+		return
+	}
+	resp, err := a.service.UpdateCalendar(r.Context(), request)
+	respond(w, resp, err)
+}
+
+func (a *api) deleteCalendarHandler(w http.ResponseWriter, r *http.Request) {
+	var request internal.CalendarRequest
+	if err := decode(r, &request); err != nil {
+		respond(w, nil, err)
+		return
+	}
+	respond(w, nil, a.service.DeleteCalendar(r.Context(), request))
+}
+
+func (a *api) listCalendarsHandler(w http.ResponseWriter, r *http.Request) {
+	var request internal.UserRequest
+	if err := decode(r, &request); err != nil {
+		respond(w, nil, err)
+		return
+	}
+	resp, err := a.service.ListCalendars(r.Context(), request)
+	respond(w, resp, err)
+}
+
+func (a *api) createEventWithUsersHandler(w http.ResponseWriter, r *http.Request) {
+	var request internal.CreateEventRequest
+	if err := decode(r, &request); err != nil {
+		respond(w, nil, err)
+		return
+	}
+	resp, err := a.service.CreateEventWithUsers(r.Context(), request)
+	respond(w, resp, err)
 }
 
 func (a *api) getEventDetailsHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("content-type", "application/json")
-	defer r.Body.Close()
-	requestBody, err := ioutil.ReadAll(r.Body)
-	if err != nil {
-		log.Error().Err(err).Stack()
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte("{}"))
+	var request internal.EventRequest
+	if err := decode(r, &request); err != nil {
+		respond(w, nil, err)
 		return
 	}
-	resp, err := a.service.GetEventDetails(requestBody)
-	if err != nil {
-		log.Error().Err(err).Stack()
-		if err.Error() == "wrong query" || err.Error() == "unable to get event" {
-			w.WriteHeader(http.StatusBadRequest)
-		} else {
-			w.WriteHeader(http.StatusNotFound)
-		}
-		w.Write([]byte("{}"))
+	resp, err := a.service.GetEventDetails(r.Context(), request)
+	if err == nil {
+		w.Header().Set("ETag", eventTag(resp.Version))
+	}
+	respond(w, resp, err)
+}
+
+func (a *api) cancelEventHandler(w http.ResponseWriter, r *http.Request) {
+	var request internal.EventRequest
+	if err := decode(r, &request); err != nil {
+		respond(w, nil, err)
 		return
 	}
-	w.WriteHeader(http.StatusOK)
-	w.Write(resp)
+	if err := ifMatch(r, &request.Version); err != nil {
+		respond(w, nil, err)
+		return
+	}
+	respond(w, nil, a.service.CancelEvent(r.Context(), request))
 }
 
 func (a *api) acceptInvitationHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("content-type", "application/json")
-	defer r.Body.Close()
-	requestBody, err := ioutil.ReadAll(r.Body)
-	if err != nil {
-		log.Error().Err(err).Stack()
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte("{}"))
+	var request internal.InvitationRequest
+	if err := decode(r, &request); err != nil {
+		respond(w, nil, err)
 		return
 	}
-	if err := a.service.AcceptInvitation(requestBody); err == nil {
-		w.WriteHeader(http.StatusOK)
-	} else {
-		log.Error().Err(err).Stack()
-		if err.Error() == "wrong query" {
-			w.WriteHeader(http.StatusBadRequest)
-		} else {
-			w.WriteHeader(http.StatusNotFound)
-		}
+	if err := ifMatch(r, &request.Version); err != nil {
+		respond(w, nil, err)
+		return
 	}
-	w.Write([]byte("{}"))
+	resp, err := a.service.AcceptInvitation(r.Context(), request)
+	respond(w, resp, err)
 }
 
 func (a *api) rejectInvitationHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("content-type", "application/json")
-	defer r.Body.Close()
-	requestBody, err := ioutil.ReadAll(r.Body)
-	if err != nil {
-		log.Error().Err(err).Stack()
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte("{}"))
+	var request internal.InvitationRequest
+	if err := decode(r, &request); err != nil {
+		respond(w, nil, err)
 		return
 	}
-	if err := a.service.RejectInvitation(requestBody); err == nil {
-		w.WriteHeader(http.StatusOK)
-	} else {
-		log.Error().Err(err).Stack()
-		if err.Error() == "wrong query" {
-			w.WriteHeader(http.StatusBadRequest)
-		} else {
-			w.WriteHeader(http.StatusNotFound)
-		}
+	if err := ifMatch(r, &request.Version); err != nil {
+		respond(w, nil, err)
+		return
 	}
-	w.Write([]byte("{}"))
+	respond(w, nil, a.service.RejectInvitation(r.Context(), request))
 }
 
 func (a *api) getEventsHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("content-type", "application/json")
+	var request internal.EventsRequest
+	if err := decode(r, &request); err != nil {
+		respond(w, nil, err)
+		return
+	}
+	resp, err := a.service.GetEvents(r.Context(), request)
+	if resp.NextPageToken != "" {
+		w.Header().Set("Next-Page-Token", resp.NextPageToken)
+	}
+	respond(w, resp.Events, err)
+}
+
+func (a *api) findSlotHandler(w http.ResponseWriter, r *http.Request) {
+	var request internal.FindSlotRequest
+	if err := decode(r, &request); err != nil {
+		respond(w, nil, err)
+		return
+	}
+	resp, err := a.service.FindSlot(r.Context(), request)
+	respond(w, resp, err)
+}
+
+func (a *api) bookSlotHandler(w http.ResponseWriter, r *http.Request) {
+	var request internal.BookSlotRequest
+	if err := decode(r, &request); err != nil {
+		respond(w, nil, err)
+		return
+	}
+	resp, err := a.service.BookSlot(r.Context(), request)
+	respond(w, resp, err)
+}
+
+func (a *api) createWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	var request webhook.Subscription
+	if err := decode(r, &request); err != nil {
+		respond(w, nil, err)
+		return
+	}
+	resp, err := a.service.CreateWebhook(r.Context(), request)
+	respond(w, resp, err)
+}
+
+func (a *api) deleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	var request internal.DeleteWebhookRequest
+	if err := decode(r, &request); err != nil {
+		respond(w, nil, err)
+		return
+	}
+	respond(w, nil, a.service.DeleteWebhook(r.Context(), request))
+}
+
+func (a *api) getWebhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 	requestBody, err := ioutil.ReadAll(r.Body)
 	if err != nil {
 		log.Error().Err(err).Stack()
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte("{}"))
+		respond(w, nil, errors.New("wrong query"))
 		return
 	}
-	resp, err := a.service.GetEvents(requestBody)
-	if err != nil {
-		if err.Error() == "wrong query" {
-			w.WriteHeader(http.StatusBadRequest)
-		} else {
-			w.WriteHeader(http.StatusNotFound)
+	var request internal.DeliveriesRequest
+	if len(requestBody) != 0 {
+		if err := json.Unmarshal(requestBody, &request); err != nil {
+			log.Error().Err(err).Stack()
+			respond(w, nil, errors.New("wrong query"))
+			return
 		}
-		w.Write([]byte("{}"))
-		return
 	}
-	w.WriteHeader(http.StatusOK)
-	w.Write(resp)
+	resp, err := a.service.GetWebhookDeliveries(r.Context(), request)
+	respond(w, resp, err)
 }
 
-func (a *api) findSlotHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("content-type", "application/json")
+func (a *api) processITIPHandler(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 	requestBody, err := ioutil.ReadAll(r.Body)
 	if err != nil {
 		log.Error().Err(err).Stack()
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte("{}"))
+		respond(w, nil, errors.New("wrong query"))
 		return
 	}
-	resp, err := a.service.FindSlot(requestBody)
-	if err != nil {
-		if err.Error() == "wrong query" {
-			w.WriteHeader(http.StatusBadRequest)
-		} else {
-			w.WriteHeader(http.StatusNotFound)
-		}
-		w.Write([]byte("{}"))
+	respond(w, nil, a.service.ProcessITIP(r.Context(), string(requestBody)))
+}
+
+func (a *api) getCounterProposalsHandler(w http.ResponseWriter, r *http.Request) {
+	var request internal.EventRequest
+	if err := decode(r, &request); err != nil {
+		respond(w, nil, err)
 		return
 	}
-	w.WriteHeader(http.StatusOK)
-	w.Write(resp)
+	resp, err := a.service.GetCounterProposals(r.Context(), request)
+	respond(w, resp, err)
+}
+
+func (a *api) getAuditLogHandler(w http.ResponseWriter, r *http.Request) {
+	var request internal.AuditRequest
+	if err := decode(r, &request); err != nil {
+		respond(w, nil, err)
+		return
+	}
+	resp, err := a.service.GetAuditLog(r.Context(), request)
+	respond(w, resp, err)
+}
+
+func (a *api) getEventHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	var request internal.EventRequest
+	if err := decode(r, &request); err != nil {
+		respond(w, nil, err)
+		return
+	}
+	resp, err := a.service.GetEventHistory(r.Context(), request)
+	respond(w, resp, err)
+}
+
+func (a *api) restoreEventHandler(w http.ResponseWriter, r *http.Request) {
+	var request internal.RestoreEventRequest
+	if err := decode(r, &request); err != nil {
+		respond(w, nil, err)
+		return
+	}
+	if err := ifMatch(r, &request.Version); err != nil {
+		respond(w, nil, err)
+		return
+	}
+	resp, err := a.service.RestoreEventRevision(r.Context(), request)
+	if err == nil {
+		w.Header().Set("ETag", eventTag(resp.Version))
+	}
+	respond(w, resp, err)
+}
+
+func (a *api) syncHandler(w http.ResponseWriter, r *http.Request) {
+	var request internal.SyncRequest
+	if err := decode(r, &request); err != nil {
+		respond(w, nil, err)
+		return
+	}
+	resp, err := a.service.Sync(r.Context(), request)
+	respond(w, resp, err)
 }
 
 //TODO: Add tests.
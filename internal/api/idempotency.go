@@ -0,0 +1,89 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/nivanov045/calendar/internal/idempotency"
+	"github.com/nivanov045/calendar/internal/tenant"
+)
+
+// recorder passes the response to the client and keeps a copy of it.
+type recorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *recorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *recorder) Write(data []byte) (int, error) {
+	r.body.Write(data)
+	return r.ResponseWriter.Write(data)
+}
+
+// idempotent answers a POST request with the header "Idempotency-Key" by the response to the first request
+// with the key, if the method, the path and the body are the same. Keys of organizations don't collide.
+// Responses with 5xx statuses aren't saved, so such requests may be retried.
+func (a *api) idempotent(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		if a.idempotency == nil || key == "" || r.Method != http.MethodPost {
+			next.ServeHTTP(w, r)
+			return
+		}
+		body, err := ioutil.ReadAll(r.Body)
+		r.Body.Close()
+		if err != nil {
+			log.Error().Err(err).Stack()
+			respondV2(w, 0, nil, errors.New("wrong query"))
+			return
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		organization, _ := tenant.FromContext(r.Context())
+		key = organization.ID + "/" + key
+		hash := sha256.Sum256(append([]byte(r.Method+" "+r.URL.RequestURI()+"\n"), body...))
+
+		saved, err := a.idempotency.Begin(key, hex.EncodeToString(hash[:]))
+		if err != nil {
+			respondV2(w, 0, nil, err)
+			return
+		}
+		if saved != nil {
+			for name, values := range saved.Header {
+				w.Header()[name] = values
+			}
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(saved.Status)
+			w.Write(saved.Body)
+			return
+		}
+
+		finished := false
+		defer func() {
+			if !finished {
+				a.idempotency.Abort(key)
+			}
+		}()
+		response := &recorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(response, r)
+		if response.status >= http.StatusInternalServerError {
+			return
+		}
+		a.idempotency.Finish(key, idempotency.Response{
+			Status: response.status,
+			Header: w.Header().Clone(),
+			Body:   response.body.Bytes(),
+		})
+		finished = true
+	})
+}
@@ -1,11 +1,56 @@
 package api
 
+import (
+	"context"
+
+	"github.com/nivanov045/calendar/internal"
+	"github.com/nivanov045/calendar/internal/idempotency"
+	"github.com/nivanov045/calendar/internal/pubsub"
+	"github.com/nivanov045/calendar/internal/webhook"
+)
+
 type Service interface {
-	CreateUser(body []byte) ([]byte, error)
-	CreateEventWithUsers(body []byte) ([]byte, error)
-	GetEventDetails(body []byte) ([]byte, error)
-	AcceptInvitation(body []byte) error
-	RejectInvitation(body []byte) error
-	GetEvents(body []byte) ([]byte, error)
-	FindSlot(body []byte) ([]byte, error)
+	CreateUser(ctx context.Context, request internal.CreateUserRequest) (internal.IDResponse, error)
+	GetUser(ctx context.Context, request internal.UserRequest) (internal.User, error)
+	UpdateUser(ctx context.Context, request internal.UpdateUserRequest) (internal.User, error)
+	DeactivateUser(ctx context.Context, request internal.UserRequest) error
+	ListUsers(ctx context.Context, request internal.ListUsersRequest) (internal.UsersResponse, error)
+	CreateGroup(ctx context.Context, request internal.CreateGroupRequest) (internal.IDResponse, error)
+	GetGroup(ctx context.Context, request internal.GroupRequest) (internal.Group, error)
+	UpdateGroup(ctx context.Context, request internal.UpdateGroupRequest) (internal.Group, error)
+	DeleteGroup(ctx context.Context, request internal.GroupRequest) error
+	CreateCalendar(ctx context.Context, request internal.CreateCalendarRequest) (internal.IDResponse, error)
+	GetCalendar(ctx context.Context, request internal.CalendarRequest) (internal.Calendar, error)
+	UpdateCalendar(ctx context.Context, request internal.UpdateCalendarRequest) (internal.Calendar, error)
+	DeleteCalendar(ctx context.Context, request internal.CalendarRequest) error
+	ListCalendars(ctx context.Context, request internal.UserRequest) ([]internal.Calendar, error)
+	ListGroupCalendars(ctx context.Context, request internal.GroupRequest) ([]internal.Calendar, error)
+	CreateEventWithUsers(ctx context.Context, request internal.CreateEventRequest) (internal.CreateEventResponse, error)
+	GetEventDetails(ctx context.Context, request internal.EventRequest) (internal.Event, error)
+	CancelEvent(ctx context.Context, request internal.EventRequest) error
+	AcceptInvitation(ctx context.Context, request internal.InvitationRequest) (internal.WarningsResponse, error)
+	RejectInvitation(ctx context.Context, request internal.InvitationRequest) error
+	GetEvents(ctx context.Context, request internal.EventsRequest) (internal.EventsResponse, error)
+	FindSlot(ctx context.Context, request internal.FindSlotRequest) (internal.FindSlotResponse, error)
+	BookSlot(ctx context.Context, request internal.BookSlotRequest) (internal.BookSlotResponse, error)
+	CreateWebhook(ctx context.Context, subscription webhook.Subscription) (internal.CreateWebhookResponse, error)
+	DeleteWebhook(ctx context.Context, request internal.DeleteWebhookRequest) error
+	GetWebhookDeliveries(ctx context.Context, request internal.DeliveriesRequest) ([]webhook.Delivery, error)
+	ProcessITIP(ctx context.Context, calendar string) error
+	GetAuditLog(ctx context.Context, request internal.AuditRequest) ([]internal.AuditRecord, error)
+	GetEventHistory(ctx context.Context, request internal.EventRequest) ([]internal.EventRevision, error)
+	RestoreEventRevision(ctx context.Context, request internal.RestoreEventRequest) (internal.Event, error)
+	GetCounterProposals(ctx context.Context, request internal.EventRequest) ([]internal.CounterProposal, error)
+	Sync(ctx context.Context, request internal.SyncRequest) (internal.SyncResponse, error)
+	SubscribeChanges(ctx context.Context, user string, lastID uint64) (<-chan pubsub.Message, func(), error)
+}
+
+type Tenants interface {
+	Authenticate(key string) (internal.Organization, error)
+}
+
+type Idempotency interface {
+	Begin(key string, fingerprint string) (*idempotency.Response, error)
+	Finish(key string, response idempotency.Response)
+	Abort(key string)
 }
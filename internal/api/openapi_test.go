@@ -0,0 +1,310 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+
+	"github.com/nivanov045/calendar/internal"
+	"github.com/nivanov045/calendar/internal/webhook"
+)
+
+type document struct {
+	Paths      map[string]map[string]operation `json:"paths"`
+	Components struct {
+		Schemas map[string]schema `json:"schemas"`
+	} `json:"components"`
+}
+
+type operation struct {
+	RequestBody *struct {
+		Content map[string]mediaType `json:"content"`
+	} `json:"requestBody"`
+	Responses map[string]struct {
+		Content map[string]mediaType `json:"content"`
+	} `json:"responses"`
+}
+
+type mediaType struct {
+	Schema  schema      `json:"schema"`
+	Example interface{} `json:"example"`
+}
+
+type schema struct {
+	Ref                  string            `json:"$ref"`
+	Type                 string            `json:"type"`
+	Format               string            `json:"format"`
+	Properties           map[string]schema `json:"properties"`
+	AdditionalProperties *schema           `json:"additionalProperties"`
+	Required             []string          `json:"required"`
+	Items                *schema           `json:"items"`
+	Enum                 []interface{}     `json:"enum"`
+}
+
+func loadDocument(t *testing.T) document {
+	var doc document
+	if err := json.Unmarshal(openAPI, &doc); err != nil {
+		t.Fatalf("openapi.json is not valid: %v", err)
+	}
+	return doc
+}
+
+// validate checks the value against the subset of JSON Schema used in the document.
+func (d document) validate(s schema, value interface{}, path string) error {
+	if s.Ref != "" {
+		resolved, ok := d.Components.Schemas[strings.TrimPrefix(s.Ref, "#/components/schemas/")]
+		if !ok {
+			return fmt.Errorf("%s: unknown reference %s", path, s.Ref)
+		}
+		return d.validate(resolved, value, path)
+	}
+	if len(s.Enum) > 0 {
+		found := false
+		for _, option := range s.Enum {
+			if reflect.DeepEqual(option, value) {
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s: %v is not in enum", path, value)
+		}
+	}
+	switch s.Type {
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s: object expected", path)
+		}
+		for _, name := range s.Required {
+			if _, ok := object[name]; !ok {
+				return fmt.Errorf("%s: %s is required", path, name)
+			}
+		}
+		if s.AdditionalProperties != nil {
+			for name, field := range object {
+				if err := d.validate(*s.AdditionalProperties, field, path+"."+name); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		if s.Properties == nil {
+			return nil
+		}
+		for name, field := range object {
+			property, ok := s.Properties[name]
+			if !ok {
+				return fmt.Errorf("%s: unknown property %s", path, name)
+			}
+			if err := d.validate(property, field, path+"."+name); err != nil {
+				return err
+			}
+		}
+	case "array":
+		array, ok := value.([]interface{})
+		if !ok {
+			return fmt.Errorf("%s: array expected", path)
+		}
+		for i, item := range array {
+			if err := d.validate(*s.Items, item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("%s: string expected", path)
+		}
+		if s.Format == "date-time" {
+			if _, err := time.Parse(time.RFC3339, str); err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+		}
+	case "integer":
+		number, ok := value.(float64)
+		if !ok || number != float64(int64(number)) {
+			return fmt.Errorf("%s: integer expected", path)
+		}
+	case "number":
+		if _, ok := value.(float64); !ok {
+			return fmt.Errorf("%s: number expected", path)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("%s: boolean expected", path)
+		}
+	case "":
+		// schema without type accepts any value
+	default:
+		return fmt.Errorf("%s: unknown type %q", path, s.Type)
+	}
+	return nil
+}
+
+func TestOpenAPIDocumentsAllRoutes(t *testing.T) {
+	doc := loadDocument(t)
+	documented := map[string]bool{}
+	err := chi.Walk(New(nil).Router(), func(method string, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		route = strings.Replace(route, "/*/", "/", -1)
+		documented[method+" "+route] = true
+		if _, ok := doc.Paths[route][strings.ToLower(method)]; !ok {
+			t.Errorf("%s %s is not documented", method, route)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for path, operations := range doc.Paths {
+		for method := range operations {
+			if method == "parameters" {
+				continue
+			}
+			if !documented[strings.ToUpper(method)+" "+path] {
+				t.Errorf("%s %s is documented but not routed", strings.ToUpper(method), path)
+			}
+		}
+	}
+}
+
+func TestOpenAPIExamplesMatchSchemas(t *testing.T) {
+	doc := loadDocument(t)
+	check := func(where string, media mediaType) {
+		if media.Example == nil {
+			return
+		}
+		if err := doc.validate(media.Schema, media.Example, where); err != nil {
+			t.Error(err)
+		}
+	}
+	for path, operations := range doc.Paths {
+		for method, op := range operations {
+			if op.RequestBody != nil {
+				for contentType, media := range op.RequestBody.Content {
+					if contentType == "application/json" {
+						check(method+" "+path+" request", media)
+					}
+				}
+			}
+			for status, response := range op.Responses {
+				for contentType, media := range response.Content {
+					if contentType != "text/calendar" {
+						check(method+" "+path+" "+status, media)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestOpenAPISchemasMatchEntities(t *testing.T) {
+	doc := loadDocument(t)
+	tests := []struct {
+		schema string
+		value  interface{}
+	}{
+		{"User", internal.User{}},
+		{"UserInfo", internal.CustomUserInfo{}},
+		{"Event", internal.Event{}},
+		{"EventInfo", internal.CustomEventInfo{}},
+		{"Reminder", internal.Reminder{}},
+		{"Conflict", internal.Conflict{}},
+		{"Change", internal.Change{}},
+		{"CounterProposal", internal.CounterProposal{}},
+		{"Delivery", webhook.Delivery{}},
+		{"CreateUserRequest", internal.CreateUserRequest{}},
+		{"IDResponse", internal.IDResponse{}},
+		{"UserRequest", internal.UserRequest{}},
+		{"UpdateUserRequest", internal.UpdateUserRequest{}},
+		{"ListUsersRequest", internal.ListUsersRequest{}},
+		{"UsersResponse", internal.UsersResponse{}},
+		{"Group", internal.Group{}},
+		{"GroupInfo", internal.CustomGroupInfo{}},
+		{"CreateGroupRequest", internal.CreateGroupRequest{}},
+		{"GroupRequest", internal.GroupRequest{}},
+		{"UpdateGroupRequest", internal.UpdateGroupRequest{}},
+		{"Calendar", internal.Calendar{}},
+		{"CalendarInfo", internal.CustomCalendarInfo{}},
+		{"CreateCalendarRequest", internal.CreateCalendarRequest{}},
+		{"CalendarRequest", internal.CalendarRequest{}},
+		{"UpdateCalendarRequest", internal.UpdateCalendarRequest{}},
+		{"CreateEventRequest", internal.CreateEventRequest{}},
+		{"CreateEventResponse", internal.CreateEventResponse{}},
+		{"EventRequest", internal.EventRequest{}},
+		{"InvitationRequest", internal.InvitationRequest{}},
+		{"WarningsResponse", internal.WarningsResponse{}},
+		{"EventsRequest", internal.EventsRequest{}},
+		{"FindSlotRequest", internal.FindSlotRequest{}},
+		{"FindSlotResponse", internal.FindSlotResponse{}},
+		{"BookSlotRequest", internal.BookSlotRequest{}},
+		{"BookSlotResponse", internal.BookSlotResponse{}},
+		{"CreateWebhookResponse", internal.CreateWebhookResponse{}},
+		{"DeleteWebhookRequest", internal.DeleteWebhookRequest{}},
+		{"DeliveriesRequest", internal.DeliveriesRequest{}},
+		{"SyncRequest", internal.SyncRequest{}},
+		{"SyncResponse", internal.SyncResponse{}},
+		{"AuditRecord", internal.AuditRecord{}},
+		{"FieldChange", internal.FieldChange{}},
+		{"AuditRequest", internal.AuditRequest{}},
+		{"EventRevision", internal.EventRevision{}},
+		{"RestoreEventRequest", internal.RestoreEventRequest{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.schema, func(t *testing.T) {
+			fields := jsonFields(reflect.TypeOf(tt.value))
+			var properties []string
+			for name := range doc.Components.Schemas[tt.schema].Properties {
+				properties = append(properties, name)
+			}
+			sort.Strings(fields)
+			sort.Strings(properties)
+			if !reflect.DeepEqual(fields, properties) {
+				t.Errorf("schema properties = %v, want %v", properties, fields)
+			}
+		})
+	}
+}
+
+// jsonFields returns JSON names of the struct fields including fields of embedded structs.
+func jsonFields(value reflect.Type) []string {
+	var fields []string
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if field.Anonymous && name == "" {
+			fields = append(fields, jsonFields(field.Type)...)
+		} else if name != "" && name != "-" {
+			fields = append(fields, name)
+		}
+	}
+	return fields
+}
+
+func TestOpenAPIHandler(t *testing.T) {
+	server := httptest.NewServer(New(nil).Router())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/openapi.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("content-type") != "application/json" {
+		t.Fatalf("GET /openapi.json = %d %s", resp.StatusCode, resp.Header.Get("content-type"))
+	}
+	var doc map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc["openapi"] != "3.1.0" {
+		t.Errorf("openapi = %v, want 3.1.0", doc["openapi"])
+	}
+}
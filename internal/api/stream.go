@@ -0,0 +1,144 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/rs/zerolog/log"
+
+	"github.com/nivanov045/calendar/internal/pubsub"
+)
+
+// keepAliveInterval is how often idle streams are pinged to keep proxies from closing them.
+const keepAliveInterval = 30 * time.Second
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+}
+
+// subscribe starts the change stream of the user. The last received id is taken
+// from Last-Event-ID header or last_event_id query parameter.
+func (a *api) subscribe(w http.ResponseWriter, r *http.Request, user string) (<-chan pubsub.Message, func(), bool) {
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("last_event_id")
+	}
+	var lastID uint64
+	if lastEventID != "" {
+		var err error
+		lastID, err = strconv.ParseUint(lastEventID, 10, 64)
+		if err != nil {
+			log.Error().Err(err).Stack()
+			w.WriteHeader(http.StatusBadRequest)
+			return nil, nil, false
+		}
+	}
+	messages, cancel, err := a.service.SubscribeChanges(r.Context(), user, lastID)
+	if err != nil {
+		log.Error().Err(err).Stack()
+		w.WriteHeader(http.StatusNotFound)
+		return nil, nil, false
+	}
+	return messages, cancel, true
+}
+
+func (a *api) streamHandler(w http.ResponseWriter, r *http.Request) {
+	a.stream(w, r, r.URL.Query().Get("user"))
+}
+
+func (a *api) webSocketHandler(w http.ResponseWriter, r *http.Request) {
+	a.webSocket(w, r, r.URL.Query().Get("user"))
+}
+
+// stream sends changes of the user as Server-Sent Events.
+func (a *api) stream(w http.ResponseWriter, r *http.Request, user string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	messages, cancel, ok := a.subscribe(w, r, user)
+	if !ok {
+		return
+	}
+	defer cancel()
+	w.Header().Set("content-type", "text/event-stream")
+	w.Header().Set("cache-control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	ticker := time.NewTicker(keepAliveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+			fmt.Fprint(w, ": ping\n\n")
+		case message, ok := <-messages:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(message)
+			if err != nil {
+				log.Error().Err(err).Stack()
+				return
+			}
+			eventType := string(message.Change.Type)
+			if message.Reset {
+				eventType = "reset"
+			}
+			fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", message.ID, eventType, data)
+		}
+		flusher.Flush()
+	}
+}
+
+// webSocket sends changes of the user as WebSocket JSON messages.
+func (a *api) webSocket(w http.ResponseWriter, r *http.Request, user string) {
+	messages, cancel, ok := a.subscribe(w, r, user)
+	if !ok {
+		return
+	}
+	defer cancel()
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Error().Err(err).Stack()
+		return
+	}
+	defer conn.Close()
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+	ticker := time.NewTicker(keepAliveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-closed:
+			return
+		case <-ticker.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(time.Second)); err != nil {
+				return
+			}
+		case message, ok := <-messages:
+			if !ok {
+				conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "lagging behind"))
+				return
+			}
+			if err := conn.WriteJSON(message); err != nil {
+				log.Error().Err(err).Stack()
+				return
+			}
+		}
+	}
+}
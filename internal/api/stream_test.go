@@ -0,0 +1,143 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/nivanov045/calendar/internal"
+	"github.com/nivanov045/calendar/internal/pubsub"
+	"github.com/nivanov045/calendar/internal/service"
+	"github.com/nivanov045/calendar/internal/storage"
+)
+
+// newStreamServer returns the server keeping the last two changes for resuming and the id of its user.
+// Every invitation makes two changes: creation of the event and invitation of the user.
+func newStreamServer(t *testing.T) (*httptest.Server, string) {
+	changes := pubsub.New(2)
+	server := httptest.NewServer(New(service.New(storage.New(storage.WithNotifier(changes)), nil, changes)).Router())
+	resp, body := call(t, http.MethodPost, server.URL+"/v2/users", `{"info": {"name": "ivan"}}`)
+	var created internal.IDResponse
+	if err := json.Unmarshal(body, &created); resp.StatusCode != http.StatusCreated || err != nil {
+		t.Fatalf("POST /v2/users = %d %s", resp.StatusCode, body)
+	}
+	return server, created.ID
+}
+
+// invite creates an event inviting the user.
+func invite(t *testing.T, server *httptest.Server, user string) {
+	start := time.Date(2022, 9, 5, 10, 0, 0, 0, time.UTC)
+	event, _ := json.Marshal(internal.CreateEventRequest{Event: internal.Event{
+		Candidates: []string{user}, Start: start, Finish: start.Add(time.Hour),
+	}})
+	if resp, body := call(t, http.MethodPost, server.URL+"/v2/events", string(event)); resp.StatusCode != http.StatusCreated {
+		t.Fatalf("POST /v2/events = %d %s", resp.StatusCode, body)
+	}
+}
+
+// readEvent returns the id and the type of the next Server-Sent Event.
+func readEvent(t *testing.T, reader *bufio.Reader) (string, string) {
+	var id, eventType string
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading stream: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "" && eventType != "":
+			return id, eventType
+		case strings.HasPrefix(line, "id: "):
+			id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			eventType = strings.TrimPrefix(line, "event: ")
+		}
+	}
+}
+
+func TestStream(t *testing.T) {
+	server, user := newStreamServer(t)
+	defer server.Close()
+	invite(t, server, user)
+	invite(t, server, user)
+	invite(t, server, user)
+
+	tests := []struct {
+		name        string
+		lastEventID string
+		wantID      string
+		wantType    string
+	}{
+		{name: "Resume from history", lastEventID: "4", wantID: "5", wantType: string(internal.EventCreated)},
+		{name: "Resume from lost history", lastEventID: "1", wantID: "6", wantType: "reset"},
+		{name: "Resume from id unknown after a restart", lastEventID: "100", wantID: "6", wantType: "reset"},
+		{name: "New subscription", wantID: "7", wantType: string(internal.EventCreated)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, server.URL+"/v2/users/"+user+"/stream", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.lastEventID != "" {
+				req.Header.Set("Last-Event-ID", tt.lastEventID)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusOK || resp.Header.Get("content-type") != "text/event-stream" {
+				t.Fatalf("GET stream = %d %s", resp.StatusCode, resp.Header.Get("content-type"))
+			}
+			if tt.lastEventID == "" {
+				invite(t, server, user)
+			}
+			if id, eventType := readEvent(t, bufio.NewReader(resp.Body)); id != tt.wantID || eventType != tt.wantType {
+				t.Errorf("stream event = %s %s, want %s %s", id, eventType, tt.wantID, tt.wantType)
+			}
+		})
+	}
+
+	resp, err := http.Get(server.URL + "/v2/users/" + user + "/stream?last_event_id=x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("GET stream with wrong id = %d, want %d", resp.StatusCode, http.StatusBadRequest)
+	}
+}
+
+func TestWebSocket(t *testing.T) {
+	server, user := newStreamServer(t)
+	defer server.Close()
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/v2/users/" + user + "/ws"
+
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	invite(t, server, user)
+	var message pubsub.Message
+	if err := conn.ReadJSON(&message); err != nil || message.ID != 1 || message.Change.Type != internal.EventCreated {
+		t.Errorf("ReadJSON() = %+v, %v, want created event 1", message, err)
+	}
+
+	resumed, _, err := websocket.DefaultDialer.Dial(url+"?last_event_id=100", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resumed.Close()
+	var reset pubsub.Message
+	if err := resumed.ReadJSON(&reset); err != nil || !reset.Reset || reset.ID != 2 {
+		t.Errorf("ReadJSON() after unknown id = %+v, %v, want reset to 2", reset, err)
+	}
+}
@@ -0,0 +1,541 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/rs/zerolog/log"
+
+	"github.com/nivanov045/calendar/internal"
+	"github.com/nivanov045/calendar/internal/webhook"
+)
+
+// routeV2 registers resource-oriented routes. They take ids from the path and filters from the query
+// and share the service with v1 routes.
+func (a *api) routeV2(r chi.Router) {
+	r.Use(a.authenticate)
+	r.Use(a.idempotent)
+	r.Post("/users", a.createUserV2Handler)
+	r.Get("/users", a.listUsersV2Handler)
+	r.Get("/users/{id}", a.getUserV2Handler)
+	r.Put("/users/{id}", a.updateUserV2Handler)
+	r.Delete("/users/{id}", a.deactivateUserV2Handler)
+	r.Get("/users/{id}/events", a.getUserEventsV2Handler)
+	r.Get("/users/{id}/sync", a.syncV2Handler)
+	r.Get("/users/{id}/stream", a.streamV2Handler)
+	r.Get("/users/{id}/ws", a.webSocketV2Handler)
+	r.Post("/users/{id}/calendars", a.createCalendarV2Handler)
+	r.Get("/users/{id}/calendars", a.listCalendarsV2Handler)
+	r.Post("/groups", a.createGroupV2Handler)
+	r.Get("/groups/{id}", a.getGroupV2Handler)
+	r.Put("/groups/{id}", a.updateGroupV2Handler)
+	r.Delete("/groups/{id}", a.deleteGroupV2Handler)
+	r.Post("/groups/{id}/calendars", a.createCalendarV2Handler)
+	r.Get("/groups/{id}/calendars", a.listGroupCalendarsV2Handler)
+	r.Get("/calendars/{id}", a.getCalendarV2Handler)
+	r.Put("/calendars/{id}", a.updateCalendarV2Handler)
+	r.Delete("/calendars/{id}", a.deleteCalendarV2Handler)
+	r.Post("/events", a.createEventV2Handler)
+	r.Get("/events/{id}", a.getEventV2Handler)
+	r.Delete("/events/{id}", a.cancelEventV2Handler)
+	r.Post("/events/{id}/responses", a.respondV2Handler)
+	r.Get("/events/{id}/counter-proposals", a.getCounterProposalsV2Handler)
+	r.Get("/events/{id}/revisions", a.getEventHistoryV2Handler)
+	r.Post("/events/{id}/revisions", a.restoreEventV2Handler)
+	r.Get("/audit-log", a.getAuditLogV2Handler)
+	r.Get("/slots", a.findSlotV2Handler)
+	r.Post("/bookings", a.bookSlotV2Handler)
+	r.Post("/webhooks", a.createWebhookV2Handler)
+	r.Delete("/webhooks/{id}", a.deleteWebhookV2Handler)
+	r.Get("/webhooks/deliveries", a.getWebhookDeliveriesV2Handler)
+	r.Post("/itip", a.processITIPV2Handler)
+}
+
+// statusOf maps service errors to HTTP statuses.
+func statusOf(err error) int {
+	switch err.Error() {
+	case "wrong query", "wrong repeat type", "deactivated user", "group cycle", "wrong calendar", "wrong revision":
+		return http.StatusBadRequest
+	case "conflict with existing events", "idempotency key in use":
+		return http.StatusConflict
+	case "sync token expired":
+		return http.StatusGone
+	case "version mismatch":
+		return http.StatusPreconditionFailed
+	case "version required":
+		return http.StatusPreconditionRequired
+	case "idempotency key reused":
+		return http.StatusUnprocessableEntity
+	case "unauthorized":
+		return http.StatusUnauthorized
+	}
+	return http.StatusNotFound
+}
+
+// respondV2 writes the response of the service as JSON or the error as {"error": "..."}.
+func respondV2(w http.ResponseWriter, status int, resp interface{}, err error) {
+	w.Header().Set("content-type", "application/json")
+	if err != nil {
+		log.Error().Err(err).Stack()
+		type response struct {
+			Error string `json:"error"` //description of the error
+		}
+		marshal, marshalErr := json.Marshal(response{Error: err.Error()})
+		if marshalErr != nil {
+			log.Error().Err(marshalErr).Stack()
+		}
+		w.WriteHeader(statusOf(err))
+		w.Write(marshal)
+		return
+	}
+	marshal := []byte("{}")
+	if resp != nil {
+		marshal, err = json.Marshal(resp)
+		if err != nil {
+			log.Error().Err(err).Stack()
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"error":"unable to encode response"}`))
+			return
+		}
+	}
+	w.WriteHeader(status)
+	w.Write(marshal)
+}
+
+// readBody returns the request body, "{}" if it is empty.
+func readBody(r *http.Request) ([]byte, error) {
+	defer r.Body.Close()
+	requestBody, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		log.Error().Err(err).Stack()
+		return nil, errors.New("wrong query")
+	}
+	if len(requestBody) == 0 {
+		return []byte("{}"), nil
+	}
+	return requestBody, nil
+}
+
+// decodeV2 reads the JSON body of the request into v, the empty body is an empty object.
+func decodeV2(r *http.Request, v interface{}) error {
+	requestBody, err := readBody(r)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(requestBody, v); err != nil {
+		log.Error().Err(err).Stack()
+		return errors.New("wrong query")
+	}
+	return nil
+}
+
+// queryTime parses optional RFC 3339 time from the query.
+func queryTime(r *http.Request, name string) (*time.Time, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return nil, nil
+	}
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		log.Error().Err(err).Stack()
+		return nil, errors.New("wrong query")
+	}
+	return &parsed, nil
+}
+
+// queryInt parses optional integer from the query.
+func queryInt(r *http.Request, name string) (*int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return nil, nil
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		log.Error().Err(err).Stack()
+		return nil, errors.New("wrong query")
+	}
+	return &parsed, nil
+}
+
+// queryDuration parses optional duration like "30m" from the query.
+func queryDuration(r *http.Request, name string) (*time.Duration, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return nil, nil
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		log.Error().Err(err).Stack()
+		return nil, errors.New("wrong query")
+	}
+	return &parsed, nil
+}
+
+func (a *api) createUserV2Handler(w http.ResponseWriter, r *http.Request) {
+	var request internal.CreateUserRequest
+	if err := decodeV2(r, &request); err != nil {
+		respondV2(w, 0, nil, err)
+		return
+	}
+	resp, err := a.service.CreateUser(r.Context(), request)
+	respondV2(w, http.StatusCreated, resp, err)
+}
+
+func (a *api) getUserV2Handler(w http.ResponseWriter, r *http.Request) {
+	resp, err := a.service.GetUser(r.Context(), internal.UserRequest{User: chi.URLParam(r, "id")})
+	respondV2(w, http.StatusOK, resp, err)
+}
+
+func (a *api) updateUserV2Handler(w http.ResponseWriter, r *http.Request) {
+	request := internal.UpdateUserRequest{User: chi.URLParam(r, "id")}
+	if err := decodeV2(r, &request.Info); err != nil {
+		respondV2(w, 0, nil, err)
+		return
+	}
+	resp, err := a.service.UpdateUser(r.Context(), request)
+	respondV2(w, http.StatusOK, resp, err)
+}
+
+func (a *api) deactivateUserV2Handler(w http.ResponseWriter, r *http.Request) {
+	err := a.service.DeactivateUser(r.Context(), internal.UserRequest{User: chi.URLParam(r, "id")})
+	respondV2(w, http.StatusOK, nil, err)
+}
+
+func (a *api) listUsersV2Handler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	request := internal.ListUsersRequest{
+		Query:              query.Get("query"),
+		PageToken:          query.Get("page_token"),
+		IncludeDeactivated: query.Get("include_deactivated") == "true",
+	}
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil {
+			log.Error().Err(err).Stack()
+			respondV2(w, 0, nil, errors.New("wrong query"))
+			return
+		}
+		request.Limit = limit
+	}
+	resp, err := a.service.ListUsers(r.Context(), request)
+	respondV2(w, http.StatusOK, resp, err)
+}
+
+func (a *api) getUserEventsV2Handler(w http.ResponseWriter, r *http.Request) {
+	from, err := queryTime(r, "from")
+	if err != nil {
+		respondV2(w, 0, nil, err)
+		return
+	}
+	to, err := queryTime(r, "to")
+	if err != nil {
+		respondV2(w, 0, nil, err)
+		return
+	}
+	if from == nil || to == nil {
+		respondV2(w, 0, nil, errors.New("wrong query"))
+		return
+	}
+	query := r.URL.Query()
+	request := internal.EventsRequest{
+		User:      chi.URLParam(r, "id"),
+		From:      *from,
+		To:        *to,
+		Calendar:  query.Get("calendar"),
+		PageToken: query.Get("page_token"),
+		Status:    internal.ResponseStatus(query.Get("status")),
+		Organized: query.Get("organized") == "true",
+		Query:     query.Get("query"),
+	}
+	limit, err := queryInt(r, "limit")
+	if err != nil {
+		respondV2(w, 0, nil, err)
+		return
+	}
+	if limit != nil {
+		request.Limit = *limit
+	}
+	repeatType, err := queryInt(r, "repeat_type")
+	if err != nil {
+		respondV2(w, 0, nil, err)
+		return
+	}
+	if repeatType != nil {
+		value := internal.RepeatType(*repeatType)
+		request.RepeatType = &value
+	}
+	resp, err := a.service.GetEvents(r.Context(), request)
+	if resp.NextPageToken != "" {
+		w.Header().Set("Next-Page-Token", resp.NextPageToken)
+	}
+	respondV2(w, http.StatusOK, resp.Events, err)
+}
+
+func (a *api) syncV2Handler(w http.ResponseWriter, r *http.Request) {
+	resp, err := a.service.Sync(r.Context(), internal.SyncRequest{
+		User:      chi.URLParam(r, "id"),
+		SyncToken: r.URL.Query().Get("sync_token"),
+	})
+	respondV2(w, http.StatusOK, resp, err)
+}
+
+func (a *api) streamV2Handler(w http.ResponseWriter, r *http.Request) {
+	a.stream(w, r, chi.URLParam(r, "id"))
+}
+
+func (a *api) webSocketV2Handler(w http.ResponseWriter, r *http.Request) {
+	a.webSocket(w, r, chi.URLParam(r, "id"))
+}
+
+func (a *api) createGroupV2Handler(w http.ResponseWriter, r *http.Request) {
+	var request internal.CreateGroupRequest
+	if err := decodeV2(r, &request); err != nil {
+		respondV2(w, 0, nil, err)
+		return
+	}
+	resp, err := a.service.CreateGroup(r.Context(), request)
+	respondV2(w, http.StatusCreated, resp, err)
+}
+
+func (a *api) getGroupV2Handler(w http.ResponseWriter, r *http.Request) {
+	resp, err := a.service.GetGroup(r.Context(), internal.GroupRequest{Group: chi.URLParam(r, "id")})
+	respondV2(w, http.StatusOK, resp, err)
+}
+
+func (a *api) updateGroupV2Handler(w http.ResponseWriter, r *http.Request) {
+	var body internal.CreateGroupRequest
+	if err := decodeV2(r, &body); err != nil {
+		respondV2(w, 0, nil, err)
+		return
+	}
+	resp, err := a.service.UpdateGroup(r.Context(), internal.UpdateGroupRequest{
+		Group:   chi.URLParam(r, "id"),
+		Info:    body.Info,
+		Members: body.Members,
+	})
+	respondV2(w, http.StatusOK, resp, err)
+}
+
+func (a *api) deleteGroupV2Handler(w http.ResponseWriter, r *http.Request) {
+	err := a.service.DeleteGroup(r.Context(), internal.GroupRequest{Group: chi.URLParam(r, "id")})
+	respondV2(w, http.StatusOK, nil, err)
+}
+
+func (a *api) createCalendarV2Handler(w http.ResponseWriter, r *http.Request) {
+	request := internal.CreateCalendarRequest{Owner: chi.URLParam(r, "id")}
+	if err := decodeV2(r, &request.Info); err != nil {
+		respondV2(w, 0, nil, err)
+		return
+	}
+	resp, err := a.service.CreateCalendar(r.Context(), request)
+	respondV2(w, http.StatusCreated, resp, err)
+}
+
+func (a *api) listCalendarsV2Handler(w http.ResponseWriter, r *http.Request) {
+	resp, err := a.service.ListCalendars(r.Context(), internal.UserRequest{User: chi.URLParam(r, "id")})
+	respondV2(w, http.StatusOK, resp, err)
+}
+
+func (a *api) listGroupCalendarsV2Handler(w http.ResponseWriter, r *http.Request) {
+	resp, err := a.service.ListGroupCalendars(r.Context(), internal.GroupRequest{Group: chi.URLParam(r, "id")})
+	respondV2(w, http.StatusOK, resp, err)
+}
+
+func (a *api) getCalendarV2Handler(w http.ResponseWriter, r *http.Request) {
+	resp, err := a.service.GetCalendar(r.Context(), internal.CalendarRequest{Calendar: chi.URLParam(r, "id")})
+	respondV2(w, http.StatusOK, resp, err)
+}
+
+func (a *api) updateCalendarV2Handler(w http.ResponseWriter, r *http.Request) {
+	request := internal.UpdateCalendarRequest{Calendar: chi.URLParam(r, "id")}
+	if err := decodeV2(r, &request.Info); err != nil {
+		respondV2(w, 0, nil, err)
+		return
+	}
+	resp, err := a.service.UpdateCalendar(r.Context(), request)
+	respondV2(w, http.StatusOK, resp, err)
+}
+
+func (a *api) deleteCalendarV2Handler(w http.ResponseWriter, r *http.Request) {
+	err := a.service.DeleteCalendar(r.Context(), internal.CalendarRequest{Calendar: chi.URLParam(r, "id")})
+	respondV2(w, http.StatusOK, nil, err)
+}
+
+func (a *api) createEventV2Handler(w http.ResponseWriter, r *http.Request) {
+	var request internal.CreateEventRequest
+	if err := decodeV2(r, &request); err != nil {
+		respondV2(w, 0, nil, err)
+		return
+	}
+	resp, err := a.service.CreateEventWithUsers(r.Context(), request)
+	respondV2(w, http.StatusCreated, resp, err)
+}
+
+func (a *api) getEventV2Handler(w http.ResponseWriter, r *http.Request) {
+	resp, err := a.service.GetEventDetails(r.Context(), internal.EventRequest{Event: chi.URLParam(r, "id")})
+	if err == nil {
+		w.Header().Set("ETag", eventTag(resp.Version))
+	}
+	respondV2(w, http.StatusOK, resp, err)
+}
+
+func (a *api) cancelEventV2Handler(w http.ResponseWriter, r *http.Request) {
+	request := internal.EventRequest{Event: chi.URLParam(r, "id")}
+	if err := ifMatch(r, &request.Version); err != nil {
+		respondV2(w, 0, nil, err)
+		return
+	}
+	respondV2(w, http.StatusOK, nil, a.service.CancelEvent(r.Context(), request))
+}
+
+func (a *api) respondV2Handler(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		internal.InvitationRequest
+		Status string `json:"status"` //accepted or declined
+	}
+	if err := decodeV2(r, &request); err != nil {
+		respondV2(w, 0, nil, err)
+		return
+	}
+	request.Event = chi.URLParam(r, "id")
+	if err := ifMatch(r, &request.Version); err != nil {
+		respondV2(w, 0, nil, err)
+		return
+	}
+	switch request.Status {
+	case "accepted":
+		resp, err := a.service.AcceptInvitation(r.Context(), request.InvitationRequest)
+		respondV2(w, http.StatusOK, resp, err)
+	case "declined":
+		err := a.service.RejectInvitation(r.Context(), request.InvitationRequest)
+		respondV2(w, http.StatusOK, nil, err)
+	default:
+		respondV2(w, 0, nil, errors.New("wrong query"))
+	}
+}
+
+func (a *api) getCounterProposalsV2Handler(w http.ResponseWriter, r *http.Request) {
+	resp, err := a.service.GetCounterProposals(r.Context(), internal.EventRequest{Event: chi.URLParam(r, "id")})
+	respondV2(w, http.StatusOK, resp, err)
+}
+
+func (a *api) getEventHistoryV2Handler(w http.ResponseWriter, r *http.Request) {
+	resp, err := a.service.GetEventHistory(r.Context(), internal.EventRequest{Event: chi.URLParam(r, "id")})
+	respondV2(w, http.StatusOK, resp, err)
+}
+
+// restoreEventV2Handler restores the revision from the body {"revision": 2} as a new revision of the event.
+func (a *api) restoreEventV2Handler(w http.ResponseWriter, r *http.Request) {
+	var request internal.RestoreEventRequest
+	if err := decodeV2(r, &request); err != nil {
+		respondV2(w, 0, nil, err)
+		return
+	}
+	request.Event = chi.URLParam(r, "id")
+	if err := ifMatch(r, &request.Version); err != nil {
+		respondV2(w, 0, nil, err)
+		return
+	}
+	resp, err := a.service.RestoreEventRevision(r.Context(), request)
+	if err == nil {
+		w.Header().Set("ETag", eventTag(resp.Version))
+	}
+	respondV2(w, http.StatusCreated, resp, err)
+}
+
+func (a *api) getAuditLogV2Handler(w http.ResponseWriter, r *http.Request) {
+	request := internal.AuditRequest{User: r.URL.Query().Get("user"), Event: r.URL.Query().Get("event")}
+	for name, value := range map[string]*time.Time{"from": &request.From, "to": &request.To} {
+		parsed, err := queryTime(r, name)
+		if err != nil {
+			respondV2(w, 0, nil, err)
+			return
+		}
+		if parsed != nil {
+			*value = *parsed
+		}
+	}
+	resp, err := a.service.GetAuditLog(r.Context(), request)
+	respondV2(w, http.StatusOK, resp, err)
+}
+
+func (a *api) findSlotV2Handler(w http.ResponseWriter, r *http.Request) {
+	request := internal.FindSlotRequest{Users: r.URL.Query()["users"]}
+	for name, field := range map[string]*time.Time{"from": &request.From, "valid_until": &request.ValidUntil} {
+		value, err := queryTime(r, name)
+		if err != nil {
+			respondV2(w, 0, nil, err)
+			return
+		}
+		if value != nil {
+			*field = *value
+		}
+	}
+	for name, field := range map[string]*time.Duration{
+		"duration":      &request.Duration,
+		"granularity":   &request.Granularity,
+		"buffer_before": &request.BufferBefore,
+		"buffer_after":  &request.BufferAfter,
+	} {
+		value, err := queryDuration(r, name)
+		if err != nil {
+			respondV2(w, 0, nil, err)
+			return
+		}
+		if value != nil {
+			*field = *value
+		}
+	}
+	resp, err := a.service.FindSlot(r.Context(), request)
+	respondV2(w, http.StatusOK, resp, err)
+}
+
+func (a *api) bookSlotV2Handler(w http.ResponseWriter, r *http.Request) {
+	var request internal.BookSlotRequest
+	if err := decodeV2(r, &request); err != nil {
+		respondV2(w, 0, nil, err)
+		return
+	}
+	resp, err := a.service.BookSlot(r.Context(), request)
+	respondV2(w, http.StatusCreated, resp, err)
+}
+
+func (a *api) createWebhookV2Handler(w http.ResponseWriter, r *http.Request) {
+	var request webhook.Subscription
+	if err := decodeV2(r, &request); err != nil {
+		respondV2(w, 0, nil, err)
+		return
+	}
+	resp, err := a.service.CreateWebhook(r.Context(), request)
+	respondV2(w, http.StatusCreated, resp, err)
+}
+
+func (a *api) deleteWebhookV2Handler(w http.ResponseWriter, r *http.Request) {
+	err := a.service.DeleteWebhook(r.Context(), internal.DeleteWebhookRequest{ID: chi.URLParam(r, "id")})
+	respondV2(w, http.StatusOK, nil, err)
+}
+
+func (a *api) getWebhookDeliveriesV2Handler(w http.ResponseWriter, r *http.Request) {
+	resp, err := a.service.GetWebhookDeliveries(r.Context(), internal.DeliveriesRequest{
+		Subscription: r.URL.Query().Get("subscription"),
+		DeadLetters:  r.URL.Query().Get("dead_letters") == "true",
+	})
+	respondV2(w, http.StatusOK, resp, err)
+}
+
+func (a *api) processITIPV2Handler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	requestBody, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		log.Error().Err(err).Stack()
+		respondV2(w, 0, nil, errors.New("wrong query"))
+		return
+	}
+	err = a.service.ProcessITIP(r.Context(), string(requestBody))
+	respondV2(w, http.StatusOK, nil, err)
+}
@@ -0,0 +1,136 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nivanov045/calendar/internal"
+	"github.com/nivanov045/calendar/internal/service"
+	"github.com/nivanov045/calendar/internal/storage"
+)
+
+// call sends the request with the JSON body, if it isn't empty, and the headers given as name and value pairs.
+func call(t *testing.T, method string, url string, body string, headers ...string) (*http.Response, []byte) {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var raw json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&raw); err != nil {
+		t.Fatalf("%s %s response isn't JSON: %v", method, url, err)
+	}
+	return resp, raw
+}
+
+func Test_statusOf(t *testing.T) {
+	tests := []struct {
+		err  string
+		want int
+	}{
+		{err: "wrong query", want: http.StatusBadRequest},
+		{err: "wrong calendar", want: http.StatusBadRequest},
+		{err: "conflict with existing events", want: http.StatusConflict},
+		{err: "idempotency key in use", want: http.StatusConflict},
+		{err: "sync token expired", want: http.StatusGone},
+		{err: "version mismatch", want: http.StatusPreconditionFailed},
+		{err: "version required", want: http.StatusPreconditionRequired},
+		{err: "idempotency key reused", want: http.StatusUnprocessableEntity},
+		{err: "unauthorized", want: http.StatusUnauthorized},
+		{err: "unexisted event", want: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.err, func(t *testing.T) {
+			if got := statusOf(errors.New(tt.err)); got != tt.want {
+				t.Errorf("statusOf() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestV2Routes(t *testing.T) {
+	server := httptest.NewServer(New(service.New(storage.New(), nil, nil)).Router())
+	defer server.Close()
+
+	var ids []string
+	for _, name := range []string{"olga", "ivan"} {
+		resp, body := call(t, http.MethodPost, server.URL+"/v2/users", `{"info": {"name": "`+name+`"}}`)
+		var created internal.IDResponse
+		if err := json.Unmarshal(body, &created); resp.StatusCode != http.StatusCreated || err != nil {
+			t.Fatalf("POST /v2/users = %d %s", resp.StatusCode, body)
+		}
+		ids = append(ids, created.ID)
+	}
+	if resp, body := call(t, http.MethodGet, server.URL+"/v2/users/"+ids[0], ""); resp.StatusCode != http.StatusOK ||
+		!strings.Contains(string(body), `"olga"`) {
+		t.Errorf("GET /v2/users/{id} = %d %s", resp.StatusCode, body)
+	}
+	if resp, body := call(t, http.MethodGet, server.URL+"/v2/users/unknown", ""); resp.StatusCode != http.StatusNotFound ||
+		string(body) != `{"error":"unexisted user"}` {
+		t.Errorf("GET /v2/users/unknown = %d %s", resp.StatusCode, body)
+	}
+
+	start := time.Date(2022, 9, 5, 10, 0, 0, 0, time.UTC)
+	event, _ := json.Marshal(internal.CreateEventRequest{Event: internal.Event{
+		Participants: []string{ids[0]}, Candidates: []string{ids[1]}, Start: start, Finish: start.Add(time.Hour),
+	}})
+	resp, body := call(t, http.MethodPost, server.URL+"/v2/events", string(event))
+	var created internal.CreateEventResponse
+	if err := json.Unmarshal(body, &created); resp.StatusCode != http.StatusCreated || err != nil {
+		t.Fatalf("POST /v2/events = %d %s", resp.StatusCode, body)
+	}
+	eventURL := server.URL + "/v2/events/" + created.ID
+	if resp, _ := call(t, http.MethodGet, eventURL, ""); resp.StatusCode != http.StatusOK || resp.Header.Get("ETag") != `"1"` {
+		t.Errorf("GET /v2/events/{id} = %d with ETag %s, want ETag \"1\"", resp.StatusCode, resp.Header.Get("ETag"))
+	}
+	if resp, body := call(t, http.MethodGet, server.URL+"/v2/users/"+ids[0]+"/events?from=today", ""); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("GET /v2/users/{id}/events with wrong time = %d %s", resp.StatusCode, body)
+	}
+
+	tests := []struct {
+		name    string
+		method  string
+		url     string
+		body    string
+		ifMatch string
+		want    int
+	}{
+		{name: "Missing If-Match", method: http.MethodDelete, url: eventURL, want: http.StatusPreconditionRequired},
+		{name: "Outdated If-Match", method: http.MethodDelete, url: eventURL, ifMatch: `"5"`, want: http.StatusPreconditionFailed},
+		{name: "Malformed If-Match", method: http.MethodDelete, url: eventURL, ifMatch: "1", want: http.StatusBadRequest},
+		{
+			name: "Any version", method: http.MethodPost, url: eventURL + "/responses",
+			body: `{"user": "` + ids[1] + `", "status": "accepted"}`, ifMatch: "*", want: http.StatusOK,
+		},
+		{
+			name: "Unknown response", method: http.MethodPost, url: eventURL + "/responses",
+			body: `{"user": "` + ids[1] + `", "status": "maybe"}`, ifMatch: `"2"`, want: http.StatusBadRequest,
+		},
+		{name: "Current version", method: http.MethodDelete, url: eventURL, ifMatch: `"2"`, want: http.StatusOK},
+		{name: "Cancelled event", method: http.MethodGet, url: eventURL, want: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var headers []string
+			if tt.ifMatch != "" {
+				headers = []string{"If-Match", tt.ifMatch}
+			}
+			if resp, body := call(t, tt.method, tt.url, tt.body, headers...); resp.StatusCode != tt.want {
+				t.Errorf("%s %s = %d %s, want %d", tt.method, tt.url, resp.StatusCode, body, tt.want)
+			}
+		})
+	}
+}
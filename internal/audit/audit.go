@@ -0,0 +1,99 @@
+// Package audit describes who changed what for the audit log.
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"sort"
+
+	"github.com/go-chi/chi/middleware"
+
+	"github.com/nivanov045/calendar/internal"
+)
+
+type claimedActorKey struct{}
+
+// WithClaimedActor returns the context of a request which the client says is made by the user.
+func WithClaimedActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, claimedActorKey{}, actor)
+}
+
+// ClaimedActor returns the user who the client says made the request, empty if the client didn't tell it.
+// Nothing verifies it, so it never replaces the actor of a change.
+func ClaimedActor(ctx context.Context) string {
+	actor, _ := ctx.Value(claimedActorKey{}).(string)
+	return actor
+}
+
+type callerKey struct{}
+
+// WithCaller returns the context of a request authenticated as the caller.
+func WithCaller(ctx context.Context, caller string) context.Context {
+	return context.WithValue(ctx, callerKey{}, caller)
+}
+
+// Caller returns the authenticated client which made the request, empty if requests aren't authenticated.
+func Caller(ctx context.Context) string {
+	caller, _ := ctx.Value(callerKey{}).(string)
+	return caller
+}
+
+// RequestID returns the id of the HTTP request set by chi's middleware.RequestID.
+func RequestID(ctx context.Context) string {
+	return middleware.GetReqID(ctx)
+}
+
+// Diff returns changes of fields between JSON forms of objects, nested objects are compared field by field.
+// before is nil for created objects, after is nil for removed ones.
+func Diff(before interface{}, after interface{}) []internal.FieldChange {
+	beforeFields, afterFields := map[string]json.RawMessage{}, map[string]json.RawMessage{}
+	if err := flatten(before, beforeFields); err != nil {
+		return nil
+	}
+	if err := flatten(after, afterFields); err != nil {
+		return nil
+	}
+	var result []internal.FieldChange
+	for field, value := range beforeFields {
+		if !bytes.Equal(value, afterFields[field]) {
+			result = append(result, internal.FieldChange{Field: field, Before: value, After: afterFields[field]})
+		}
+	}
+	for field, value := range afterFields {
+		if _, ok := beforeFields[field]; !ok {
+			result = append(result, internal.FieldChange{Field: field, After: value})
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Field < result[j].Field
+	})
+	return result
+}
+
+// flatten puts values of fields of the object into fields by paths like info.name.
+func flatten(object interface{}, fields map[string]json.RawMessage) error {
+	if object == nil {
+		return nil
+	}
+	data, err := json.Marshal(object)
+	if err != nil {
+		return err
+	}
+	var add func(prefix string, value json.RawMessage)
+	add = func(prefix string, value json.RawMessage) {
+		var nested map[string]json.RawMessage
+		if json.Unmarshal(value, &nested) != nil || nested == nil {
+			fields[prefix] = value
+			return
+		}
+		for name, nestedValue := range nested {
+			if prefix != "" {
+				name = prefix + "." + name
+			}
+			add(name, nestedValue)
+		}
+	}
+	add("", data)
+	return nil
+}
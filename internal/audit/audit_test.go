@@ -0,0 +1,67 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/nivanov045/calendar/internal"
+)
+
+func TestDiff(t *testing.T) {
+	before := internal.User{ID: "u-1", Info: internal.CustomUserInfo{Name: "Ivan", Email: "ivan@example.com"}}
+	after := internal.User{ID: "u-1", Info: internal.CustomUserInfo{Name: "Ivan", Title: "Engineer"}, Deactivated: true}
+	tests := []struct {
+		name   string
+		before interface{}
+		after  interface{}
+		want   []internal.FieldChange
+	}{
+		{
+			name:   "Changed, added and removed fields",
+			before: before,
+			after:  after,
+			want: []internal.FieldChange{
+				{Field: "deactivated", After: json.RawMessage(`true`)},
+				{Field: "info.email", Before: json.RawMessage(`"ivan@example.com"`)},
+				{Field: "info.title", After: json.RawMessage(`"Engineer"`)},
+			},
+		},
+		{
+			name:   "Created object",
+			before: nil,
+			after:  internal.CustomGroupInfo{Name: "team"},
+			want:   []internal.FieldChange{{Field: "name", After: json.RawMessage(`"team"`)}},
+		},
+		{
+			name:   "Unchanged object",
+			before: before,
+			after:  before,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Diff(tt.before, tt.after); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Diff() = %s, want %s", marshal(got), marshal(tt.want))
+			}
+		})
+	}
+}
+
+func TestClaimedActor(t *testing.T) {
+	if got := ClaimedActor(WithClaimedActor(context.Background(), "u-1")); got != "u-1" {
+		t.Errorf("ClaimedActor() = %q, want %q", got, "u-1")
+	}
+	if got := ClaimedActor(context.Background()); got != "" {
+		t.Errorf("ClaimedActor() of context without actor = %q, want empty", got)
+	}
+	if got := Caller(WithClaimedActor(context.Background(), "u-1")); got != "" {
+		t.Errorf("Caller() of context with claimed actor = %q, want empty", got)
+	}
+}
+
+func marshal(changes []internal.FieldChange) string {
+	data, _ := json.Marshal(changes)
+	return string(data)
+}
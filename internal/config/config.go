@@ -1,25 +1,61 @@
 package config
 
 import (
+	"errors"
 	"flag"
+	"time"
 
 	"github.com/caarlos0/env/v6"
 	"github.com/rs/zerolog/log"
 )
 
 type Config struct {
-	Address string `env:"ADDRESS"`
+	Address              string        `env:"ADDRESS"`
+	GRPCAddress          string        `env:"GRPC_ADDRESS"`
+	ReminderInterval     time.Duration `env:"REMINDER_INTERVAL"`
+	ReminderLookahead    time.Duration `env:"REMINDER_LOOKAHEAD"`
+	WebhookAttempts      int           `env:"WEBHOOK_ATTEMPTS"`
+	WebhookBackoff       time.Duration `env:"WEBHOOK_BACKOFF"`
+	SMTPAddress          string        `env:"SMTP_ADDRESS"`
+	SMTPFrom             string        `env:"SMTP_FROM"`
+	SMTPUsername         string        `env:"SMTP_USERNAME"`
+	SMTPPassword         string        `env:"SMTP_PASSWORD"`
+	StreamHistory        int           `env:"STREAM_HISTORY"`
+	TombstoneRetention   time.Duration `env:"TOMBSTONE_RETENTION"`
+	RevisionRetention    time.Duration `env:"REVISION_RETENTION"`
+	Organizations        string        `env:"ORGANIZATIONS"`
+	IdempotencyRetention time.Duration `env:"IDEMPOTENCY_RETENTION"`
 }
 
 func BuildConfig() (Config, error) {
 	var cfg Config
 	cfg.buildFromFlags()
-	err := cfg.buildFromEnv()
-	return cfg, err
+	if err := cfg.buildFromEnv(); err != nil {
+		return cfg, err
+	}
+	if cfg.ReminderInterval <= 0 || cfg.ReminderLookahead <= 0 {
+		return cfg, errors.New("reminder interval and lookahead must be positive")
+	}
+	if cfg.WebhookAttempts < 1 {
+		return cfg, errors.New("webhook attempts must be positive")
+	}
+	return cfg, nil
 }
 
 func (cfg *Config) buildFromFlags() {
 	flag.StringVar(&cfg.Address, "a", "127.0.0.1:8080", "address")
+	flag.StringVar(&cfg.GRPCAddress, "g", "127.0.0.1:9090", "gRPC address")
+	flag.DurationVar(&cfg.ReminderInterval, "r", time.Minute, "reminders check interval")
+	flag.DurationVar(&cfg.ReminderLookahead, "l", 7*24*time.Hour, "the longest time between reminder and event start")
+	flag.IntVar(&cfg.WebhookAttempts, "w", 5, "webhook delivery attempts")
+	flag.DurationVar(&cfg.WebhookBackoff, "b", time.Second, "delay before the first webhook retry")
+	flag.StringVar(&cfg.SMTPAddress, "m", "", "SMTP server address, emails are disabled if empty")
+	flag.StringVar(&cfg.SMTPFrom, "f", "calendar@localhost", "sender of emails")
+	flag.IntVar(&cfg.StreamHistory, "s", 1000, "number of changes kept for resuming streams")
+	flag.DurationVar(&cfg.TombstoneRetention, "t", 30*24*time.Hour, "how long removed events are kept for sync")
+	flag.DurationVar(&cfg.RevisionRetention, "v", 90*24*time.Hour, "how long revisions of events are kept, forever if zero")
+	flag.StringVar(&cfg.Organizations, "o", "", "JSON file with organizations and their API keys, single organization without authentication if empty")
+	flag.DurationVar(&cfg.IdempotencyRetention, "i", 24*time.Hour, "how long responses to requests with idempotency keys are kept")
 	flag.Parse()
 }
 func (cfg *Config) buildFromEnv() error {
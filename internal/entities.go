@@ -1,24 +1,102 @@
 package internal
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
+
+type Organization struct {
+	ID       string               `json:"id"`                 //id
+	Name     string               `json:"name"`               //organization's name like a department or a customer
+	Settings OrganizationSettings `json:"settings,omitempty"` //settings applied to requests of the organization
+}
+
+type OrganizationSettings struct {
+	TimeZone    string        `json:"time_zone,omitempty"`   // time zone of new users without their own one
+	Granularity time.Duration `json:"granularity,omitempty"` // alignment of slot start if a request doesn't set it
+}
 
 type User struct {
-	Info CustomUserInfo `json:"info"`         // info about user
-	ID   string         `json:"id,omitempty"` //id
+	Info        CustomUserInfo `json:"info"`                  // info about user
+	ID          string         `json:"id,omitempty"`          //id
+	Deactivated bool           `json:"deactivated,omitempty"` //deactivated users can't be invited
 }
 
 type CustomUserInfo struct {
-	Name string `json:"name"` // user's name
+	Name     string `json:"name"`                // user's name
+	Email    string `json:"email,omitempty"`     // user's email for invitations
+	Title    string `json:"title,omitempty"`     // user's job title
+	TimeZone string `json:"time_zone,omitempty"` // IANA time zone like Europe/Berlin
+	Locale   string `json:"locale,omitempty"`    // BCP 47 language tag like en-US
+}
+
+type Group struct {
+	ID      string          `json:"id,omitempty"`      //id
+	Info    CustomGroupInfo `json:"info"`              //info about group
+	Members []string        `json:"members,omitempty"` //ids of users and nested groups
+}
+
+type CustomGroupInfo struct {
+	Name  string `json:"name"`            // group's name
+	Email string `json:"email,omitempty"` // address of distribution list
+}
+
+type Calendar struct {
+	ID    string             `json:"id,omitempty"` //id
+	Owner string             `json:"owner"`        //id of user or group who owns the calendar
+	Info  CustomCalendarInfo `json:"info"`         //info about calendar
+}
+
+type CustomCalendarInfo struct {
+	Name           string     `json:"name"`                       // calendar's name like work or on-call
+	Color          string     `json:"color,omitempty"`            // color like #4285f4
+	Visibility     Visibility `json:"visibility,omitempty"`       // visibility of new events, public if empty
+	Transparent    bool       `json:"transparent,omitempty"`      // events don't count as busy time of the owner
+	Editors        []string   `json:"editors,omitempty"`          // users who can add events besides the owner
+	BusyForMembers bool       `json:"busy_for_members,omitempty"` // events of group's calendar count as busy time of members
 }
 
+type Visibility string
+
+const (
+	Public  Visibility = "public"
+	Private Visibility = "private"
+)
+
 type Event struct {
-	ID           string          `json:"id,omitempty"`          //id
-	Candidates   []string        `json:"candidates,omitempty"`  //list of candidates
-	Participants []string        `json:"participants"`          //list of participants, at list one required
-	Start        time.Time       `json:"start"`                 //start time, required
-	Finish       time.Time       `json:"finish"`                //finish time, required
-	RepeatType   RepeatType      `json:"repeat_type,omitempty"` //type of repeating
-	Info         CustomEventInfo `json:"info,omitempty"`        //info about event
+	ID           string            `json:"id,omitempty"`          //id
+	Organizer    string            `json:"organizer,omitempty"`   //id of user who created the event
+	Candidates   []string          `json:"candidates,omitempty"`  //list of candidates
+	Participants []string          `json:"participants"`          //list of participants, at list one required
+	Start        time.Time         `json:"start"`                 //start time, required
+	Finish       time.Time         `json:"finish"`                //finish time, required
+	RepeatType   RepeatType        `json:"repeat_type,omitempty"` //type of repeating
+	Info         CustomEventInfo   `json:"info,omitempty"`        //info about event
+	Reminders    []Reminder        `json:"reminders,omitempty"`   //reminders of attendees
+	InvitedVia   map[string]string `json:"invited_via,omitempty"` //group through which each attendee was invited
+	Calendar     string            `json:"calendar,omitempty"`    //calendar containing the event, default calendars of attendees if empty
+	Visibility   Visibility        `json:"visibility,omitempty"`  //visibility of details, default of the calendar if empty
+	Version      int               `json:"version,omitempty"`     //number of the last revision, grows with every change
+}
+
+type Reminder struct {
+	User   string        `json:"user"`   //attendee to remind
+	Before time.Duration `json:"before"` //how long before the start to remind
+}
+
+// IsAttendee reports whether the user participates or is invited to the event.
+func (e Event) IsAttendee(user string) bool {
+	for _, participant := range e.Participants {
+		if participant == user {
+			return true
+		}
+	}
+	for _, candidate := range e.Candidates {
+		if candidate == user {
+			return true
+		}
+	}
+	return false
 }
 
 type RepeatType int
@@ -37,3 +115,102 @@ type CustomEventInfo struct {
 	Description string `json:"description,omitempty"` //description of event
 	Name        string `json:"name,omitempty"`        //event's name
 }
+
+type SlotOptions struct {
+	Granularity  time.Duration `json:"granularity,omitempty"`   //alignment of slot start, e.g. 15 or 30 minutes
+	BufferBefore time.Duration `json:"buffer_before,omitempty"` //free time required before existing meetings
+	BufferAfter  time.Duration `json:"buffer_after,omitempty"`  //free time required after existing meetings
+}
+
+type Conflict struct {
+	User   string    `json:"user"`   //busy attendee
+	Event  string    `json:"event"`  //id of overlapping event
+	Start  time.Time `json:"start"`  //start of overlapping occurrence
+	Finish time.Time `json:"finish"` //finish of overlapping occurrence
+}
+
+type ChangeType string
+
+const (
+	EventCreated       ChangeType = "event_created"
+	UserInvited        ChangeType = "user_invited"
+	InvitationAccepted ChangeType = "invitation_accepted"
+	InvitationRejected ChangeType = "invitation_rejected"
+	EventCancelled     ChangeType = "event_cancelled"
+	EventRestored      ChangeType = "event_restored"
+)
+
+type Change struct {
+	Type  ChangeType `json:"type"`           //what happened
+	User  string     `json:"user,omitempty"` //user affected by the change
+	Event Event      `json:"event"`          //event after the change
+	Time  time.Time  `json:"time"`           //moment of the change
+}
+
+// Concerns reports whether the change is addressed to the user or the user is invited to the changed event.
+func (c Change) Concerns(user string) bool {
+	return c.User == user || c.Event.IsAttendee(user)
+}
+
+type CounterProposal struct {
+	ID      string    `json:"id"`                //id
+	Event   string    `json:"event"`             //event id
+	User    string    `json:"user"`              //id of proposing attendee
+	Start   time.Time `json:"start"`             //proposed start
+	Finish  time.Time `json:"finish"`            //proposed finish
+	Comment string    `json:"comment,omitempty"` //message of attendee
+	Time    time.Time `json:"time"`              //moment of receiving
+}
+
+type EventRevision struct {
+	Number    int           `json:"number"`              //number of the revision, the first one is 1
+	Time      time.Time     `json:"time"`                //moment of the change
+	Event     Event         `json:"event"`               //event after the change, the last state for cancellation
+	Cancelled bool          `json:"cancelled,omitempty"` //the change cancelled the event
+	Changes   []FieldChange `json:"changes,omitempty"`   //fields changed since the previous revision
+}
+
+type SyncChanges struct {
+	Created  []Event  `json:"created"`  //events which appeared for the user
+	Modified []Event  `json:"modified"` //events which changed
+	Deleted  []string `json:"deleted"`  //ids of events which disappeared for the user
+	Sequence uint64   `json:"-"`        //number of the last included change
+}
+
+type AuditAction string
+
+const (
+	ActionCreateUser       AuditAction = "create_user"
+	ActionUpdateUser       AuditAction = "update_user"
+	ActionDeactivateUser   AuditAction = "deactivate_user"
+	ActionCreateGroup      AuditAction = "create_group"
+	ActionUpdateGroup      AuditAction = "update_group"
+	ActionDeleteGroup      AuditAction = "delete_group"
+	ActionCreateCalendar   AuditAction = "create_calendar"
+	ActionUpdateCalendar   AuditAction = "update_calendar"
+	ActionDeleteCalendar   AuditAction = "delete_calendar"
+	ActionCreateEvent      AuditAction = "create_event"
+	ActionCancelEvent      AuditAction = "cancel_event"
+	ActionAcceptInvitation AuditAction = "accept_invitation"
+	ActionRejectInvitation AuditAction = "reject_invitation"
+	ActionProposeTime      AuditAction = "propose_time"
+	ActionRestoreEvent     AuditAction = "restore_event"
+	ActionCreateWebhook    AuditAction = "create_webhook"
+	ActionDeleteWebhook    AuditAction = "delete_webhook"
+)
+
+type AuditRecord struct {
+	Time         time.Time     `json:"time"`                    //moment of the change
+	Actor        string        `json:"actor,omitempty"`         //API key which made the change, empty without authentication
+	ClaimedActor string        `json:"claimed_actor,omitempty"` //user named by the request or told by the client in X-Actor, not verified
+	Action       AuditAction   `json:"action"`                  //what was done
+	Target       string        `json:"target"`                  //id of changed user, group, calendar, event or webhook
+	RequestID    string        `json:"request_id,omitempty"`    //id of the HTTP request which made the change
+	Changes      []FieldChange `json:"changes,omitempty"`       //changed fields of the target
+}
+
+type FieldChange struct {
+	Field  string          `json:"field"`            //path of the field like info.name
+	Before json.RawMessage `json:"before,omitempty"` //value before the change, absent for new fields
+	After  json.RawMessage `json:"after,omitempty"`  //value after the change, absent for removed fields
+}
@@ -0,0 +1,87 @@
+// Package idempotency remembers responses to requests with idempotency keys, so retries of the requests
+// get the original response instead of repeating the change.
+package idempotency
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type Response struct {
+	Status int         //HTTP status
+	Header http.Header //headers set by the handler
+	Body   []byte      //body as it was written
+}
+
+type entry struct {
+	key         string
+	fingerprint string    //hash of the request, retries must have the same one
+	response    *Response //nil while the first request is processed
+	time        time.Time //moment of the first request
+}
+
+type store struct {
+	retention time.Duration     //how long responses are kept
+	entries   map[string]*entry //entries by key
+	order     []*entry          //entries in order of first requests
+	mutex     sync.Mutex
+}
+
+func New(retention time.Duration) *store {
+	return &store{
+		retention: retention,
+		entries:   map[string]*entry{},
+	}
+}
+
+// Begin returns the saved response of the key or reserves the key for the request if it is new, then the caller
+// must Finish or Abort it. Requests with another fingerprint and retries of requests in progress are refused.
+func (s *store) Begin(key string, fingerprint string) (*Response, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	now := time.Now()
+	s.purge(now)
+	if saved, ok := s.entries[key]; ok {
+		if saved.fingerprint != fingerprint {
+			return nil, errors.New("idempotency key reused")
+		}
+		if saved.response == nil {
+			return nil, errors.New("idempotency key in use")
+		}
+		return saved.response, nil
+	}
+	newEntry := &entry{key: key, fingerprint: fingerprint, time: now}
+	s.entries[key] = newEntry
+	s.order = append(s.order, newEntry)
+	return nil, nil
+}
+
+// Finish saves the response of the reserved key for retries.
+func (s *store) Finish(key string, response Response) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if saved, ok := s.entries[key]; ok {
+		saved.response = &response
+	}
+}
+
+// Abort releases the reserved key, so the request may be retried with another result.
+func (s *store) Abort(key string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.entries, key)
+}
+
+// purge forgets entries older than retention. Must be called under mutex.
+func (s *store) purge(now time.Time) {
+	idx := 0
+	for idx < len(s.order) && now.Sub(s.order[idx].time) > s.retention {
+		if s.entries[s.order[idx].key] == s.order[idx] {
+			delete(s.entries, s.order[idx].key)
+		}
+		idx++
+	}
+	s.order = s.order[idx:]
+}
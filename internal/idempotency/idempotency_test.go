@@ -0,0 +1,44 @@
+package idempotency
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func Test_store_Begin(t *testing.T) {
+	s := New(time.Hour)
+	if saved, err := s.Begin("k-1", "f-1"); saved != nil || err != nil {
+		t.Fatalf("Begin() of new key = %v, %v, want nil", saved, err)
+	}
+	if _, err := s.Begin("k-1", "f-1"); err == nil || err.Error() != "idempotency key in use" {
+		t.Errorf("Begin() of key in progress error = %v, want idempotency key in use", err)
+	}
+	s.Finish("k-1", Response{Status: http.StatusCreated, Body: []byte(`{"id":"e-1"}`)})
+	if saved, err := s.Begin("k-1", "f-1"); err != nil || saved == nil || saved.Status != http.StatusCreated || string(saved.Body) != `{"id":"e-1"}` {
+		t.Errorf("Begin() of finished key = %v, %v, want saved response", saved, err)
+	}
+	if _, err := s.Begin("k-1", "f-2"); err == nil || err.Error() != "idempotency key reused" {
+		t.Errorf("Begin() with another fingerprint error = %v, want idempotency key reused", err)
+	}
+
+	if _, err := s.Begin("k-2", "f-1"); err != nil {
+		t.Fatal(err)
+	}
+	s.Abort("k-2")
+	if saved, err := s.Begin("k-2", "f-2"); saved != nil || err != nil {
+		t.Errorf("Begin() of aborted key = %v, %v, want nil", saved, err)
+	}
+}
+
+func Test_store_purge(t *testing.T) {
+	s := New(time.Hour)
+	if _, err := s.Begin("k-1", "f-1"); err != nil {
+		t.Fatal(err)
+	}
+	s.Finish("k-1", Response{Status: http.StatusOK})
+	s.purge(time.Now().Add(2 * time.Hour))
+	if saved, err := s.Begin("k-1", "f-2"); saved != nil || err != nil {
+		t.Errorf("Begin() of expired key = %v, %v, want nil", saved, err)
+	}
+}
@@ -0,0 +1,138 @@
+package imip
+
+import (
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/nivanov045/calendar/internal"
+)
+
+type Method string
+
+const (
+	Request Method = "REQUEST"
+	Reply   Method = "REPLY"
+	Cancel  Method = "CANCEL"
+	Counter Method = "COUNTER"
+)
+
+type PartStat string
+
+const (
+	NeedsAction PartStat = "NEEDS-ACTION"
+	Accepted    PartStat = "ACCEPTED"
+	Declined    PartStat = "DECLINED"
+)
+
+type Attendee struct {
+	Name     string   //common name
+	Email    string   //address used as calendar user
+	PartStat PartStat //participation status
+}
+
+// dateTimeFormat is the UTC form of iCalendar DATE-TIME.
+const dateTimeFormat = "20060102T150405Z"
+
+// maxLineLength is the limit of octets in a content line before folding.
+const maxLineLength = 75
+
+// Build returns iCalendar object of the event for the iTIP method.
+func Build(method Method, event internal.Event, organizer string, attendees []Attendee, stamp time.Time) string {
+	var lines []string
+	lines = append(lines,
+		"BEGIN:VCALENDAR",
+		"PRODID:-//nivanov045//calendar//EN",
+		"VERSION:2.0",
+		"METHOD:"+string(method),
+		"BEGIN:VEVENT",
+		"UID:"+event.ID,
+		"DTSTAMP:"+stamp.UTC().Format(dateTimeFormat),
+		"DTSTART:"+event.Start.UTC().Format(dateTimeFormat),
+		"DTEND:"+event.Finish.UTC().Format(dateTimeFormat),
+		"SEQUENCE:"+strconv.Itoa(event.Version),
+	)
+	if event.Info.Name != "" {
+		lines = append(lines, "SUMMARY:"+escapeText(event.Info.Name))
+	}
+	if event.Info.Description != "" {
+		lines = append(lines, "DESCRIPTION:"+escapeText(event.Info.Description))
+	}
+	if event.Visibility == internal.Private {
+		lines = append(lines, "CLASS:PRIVATE")
+	}
+	if rule := recurrenceRule(event.RepeatType); rule != "" {
+		lines = append(lines, "RRULE:"+rule)
+	}
+	if organizer != "" {
+		lines = append(lines, "ORGANIZER:mailto:"+organizer)
+	}
+	for _, attendee := range attendees {
+		line := "ATTENDEE;PARTSTAT=" + string(attendee.PartStat)
+		if attendee.PartStat == NeedsAction {
+			line += ";RSVP=TRUE"
+		}
+		if attendee.Name != "" {
+			line += ";CN=\"" + paramValue(attendee.Name) + "\""
+		}
+		lines = append(lines, line+":mailto:"+attendee.Email)
+	}
+	if method == Cancel {
+		lines = append(lines, "STATUS:CANCELLED")
+	}
+	lines = append(lines, "END:VEVENT", "END:VCALENDAR")
+	var builder strings.Builder
+	for _, line := range lines {
+		builder.WriteString(fold(line))
+		builder.WriteString("\r\n")
+	}
+	return builder.String()
+}
+
+func recurrenceRule(repeatType internal.RepeatType) string {
+	switch repeatType {
+	case internal.Daily:
+		return "FREQ=DAILY"
+	case internal.Weekly:
+		return "FREQ=WEEKLY"
+	case internal.Yearly:
+		return "FREQ=YEARLY"
+	case internal.Workdays:
+		return "FREQ=DAILY;BYDAY=MO,TU,WE,TH,FR"
+	}
+	return ""
+}
+
+// paramValue makes the text a quoted parameter value, which can't contain quotes and control characters.
+func paramValue(text string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '"' {
+			return '\''
+		}
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, text)
+}
+
+func escapeText(text string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(text)
+}
+
+// fold splits the content line into lines of at most maxLineLength octets without breaking UTF-8 characters.
+func fold(line string) string {
+	var builder strings.Builder
+	length := 0
+	for _, char := range line {
+		size := len(string(char))
+		if length+size > maxLineLength {
+			builder.WriteString("\r\n ")
+			length = 1
+		}
+		builder.WriteRune(char)
+		length += size
+	}
+	return builder.String()
+}
@@ -0,0 +1,7 @@
+package imip
+
+import "github.com/nivanov045/calendar/internal"
+
+type Users interface {
+	GetUser(id string) (internal.User, error)
+}
@@ -0,0 +1,137 @@
+package imip
+
+import (
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/nivanov045/calendar/internal"
+)
+
+type notifier struct {
+	users   Users
+	address string //SMTP server host:port
+	from    string //sender address, organizer of events without one
+	auth    smtp.Auth
+	wg      sync.WaitGroup
+}
+
+// New returns notifier which sends iMIP messages about changes through the SMTP server.
+// Authentication is used only if username isn't empty.
+func New(users Users, address string, from string, username string, password string) *notifier {
+	n := &notifier{
+		users:   users,
+		address: address,
+		from:    from,
+	}
+	if username != "" {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			host = address
+		}
+		n.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return n
+}
+
+// Notify sends messages about the change in background.
+func (n *notifier) Notify(change internal.Change) {
+	n.wg.Add(1)
+	go func() {
+		defer n.wg.Done()
+		if err := n.send(change); err != nil {
+			log.Error().Err(err).Stack()
+		}
+	}()
+}
+
+func (n *notifier) send(change internal.Change) error {
+	switch change.Type {
+	case internal.EventCreated:
+		return n.sendToAttendees(Request, "Invitation", change.Event)
+	case internal.EventCancelled:
+		return n.sendToAttendees(Cancel, "Cancelled", change.Event)
+	case internal.InvitationAccepted:
+		return n.sendReply(Accepted, "Accepted", change)
+	case internal.InvitationRejected:
+		return n.sendReply(Declined, "Declined", change)
+	}
+	return nil
+}
+
+func (n *notifier) sendToAttendees(method Method, subject string, event internal.Event) error {
+	organizer := n.organizer(event)
+	attendees := n.attendees(event)
+	body := Build(method, event, organizer, attendees, time.Now())
+	for _, attendee := range attendees {
+		if attendee.Email == organizer {
+			continue
+		}
+		if err := n.sendMessage(attendee.Email, subject+": "+event.Info.Name, method, body); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (n *notifier) sendReply(partStat PartStat, subject string, change internal.Change) error {
+	if change.Event.Organizer == "" {
+		return nil
+	}
+	organizer := n.organizer(change.Event)
+	user, err := n.users.GetUser(change.User)
+	if err != nil || user.Info.Email == "" || organizer == n.from {
+		return err
+	}
+	attendee := Attendee{Name: user.Info.Name, Email: user.Info.Email, PartStat: partStat}
+	body := Build(Reply, change.Event, organizer, []Attendee{attendee}, time.Now())
+	return n.sendMessage(organizer, subject+": "+change.Event.Info.Name, Reply, body)
+}
+
+// organizer returns email of the event organizer or the sender address if it is unknown.
+func (n *notifier) organizer(event internal.Event) string {
+	if event.Organizer == "" {
+		return n.from
+	}
+	user, err := n.users.GetUser(event.Organizer)
+	if err != nil || user.Info.Email == "" {
+		return n.from
+	}
+	return user.Info.Email
+}
+
+// attendees returns participants and candidates of the event which have emails.
+func (n *notifier) attendees(event internal.Event) []Attendee {
+	var result []Attendee
+	add := func(ids []string, partStat PartStat) {
+		for _, id := range ids {
+			user, err := n.users.GetUser(id)
+			if err != nil || user.Info.Email == "" {
+				continue
+			}
+			result = append(result, Attendee{Name: user.Info.Name, Email: user.Info.Email, PartStat: partStat})
+		}
+	}
+	add(event.Participants, Accepted)
+	add(event.Candidates, NeedsAction)
+	return result
+}
+
+func (n *notifier) sendMessage(to string, subject string, method Method, body string) error {
+	var message strings.Builder
+	fmt.Fprintf(&message, "From: %s\r\n", (&mail.Address{Address: n.from}).String())
+	fmt.Fprintf(&message, "To: %s\r\n", (&mail.Address{Address: to}).String())
+	fmt.Fprintf(&message, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	message.WriteString("MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&message, "Content-Type: text/calendar; charset=UTF-8; method=%s\r\n", method)
+	message.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	message.WriteString(body)
+	return smtp.SendMail(n.address, n.auth, n.from, []string{to}, []byte(message.String()))
+}
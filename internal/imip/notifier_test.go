@@ -0,0 +1,257 @@
+package imip
+
+import (
+	"mime"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nivanov045/calendar/internal"
+	"github.com/nivanov045/calendar/internal/storage"
+)
+
+type message struct {
+	to   string
+	data string
+}
+
+// smtpServer is a minimal in-process SMTP stand-in which stores received messages.
+type smtpServer struct {
+	listener net.Listener
+	messages []message
+	mutex    sync.Mutex
+}
+
+func newSMTPServer(t *testing.T) *smtpServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	server := &smtpServer{listener: listener}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn)
+		}
+	}()
+	return server
+}
+
+func (s *smtpServer) serve(conn net.Conn) {
+	defer conn.Close()
+	text := textproto.NewConn(conn)
+	text.PrintfLine("220 localhost ESMTP")
+	var to string
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		command := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch command {
+		case "EHLO", "HELO":
+			text.PrintfLine("250 localhost")
+		case "MAIL":
+			text.PrintfLine("250 OK")
+		case "RCPT":
+			to = strings.Trim(strings.TrimPrefix(line[len("RCPT TO:"):], " "), "<>")
+			text.PrintfLine("250 OK")
+		case "DATA":
+			text.PrintfLine("354 Go ahead")
+			data, err := text.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			s.mutex.Lock()
+			s.messages = append(s.messages, message{to: to, data: string(data)})
+			s.mutex.Unlock()
+			text.PrintfLine("250 OK")
+		case "QUIT":
+			text.PrintfLine("221 Bye")
+			return
+		default:
+			text.PrintfLine("250 OK")
+		}
+	}
+}
+
+func first(t time.Time, _ error) time.Time {
+	return t
+}
+
+func Test_notifier_Notify(t *testing.T) {
+	server := newSMTPServer(t)
+	defer server.listener.Close()
+	myStorage := storage.New()
+	for _, user := range []internal.User{
+		{ID: "org", Info: internal.CustomUserInfo{Name: "Olga", Email: "olga@example.com"}},
+		{ID: "u-1", Info: internal.CustomUserInfo{Name: "Ivan", Email: "ivan@example.com"}},
+		{ID: "u-2", Info: internal.CustomUserInfo{Name: "Petr"}},
+	} {
+		if err := myStorage.AddUser(user); err != nil {
+			t.Fatalf("AddUser() error = %v", err)
+		}
+	}
+	n := New(myStorage, server.listener.Addr().String(), "calendar@example.com", "", "")
+	event := internal.Event{
+		ID:           "e-1",
+		Organizer:    "org",
+		Participants: []string{"org"},
+		Candidates:   []string{"u-1", "u-2"},
+		Start:        first(time.Parse(time.RFC3339, "2022-09-02T10:00:00Z")),
+		Finish:       first(time.Parse(time.RFC3339, "2022-09-02T11:00:00Z")),
+		RepeatType:   internal.Workdays,
+		Info:         internal.CustomEventInfo{Name: "Planning, weekly"},
+	}
+	private := event
+	private.Visibility = internal.Private
+	updated := event
+	updated.Version = 3
+	tests := []struct {
+		name     string
+		change   internal.Change
+		wantTo   []string
+		contains []string
+	}{
+		{
+			name:   "Invitation to attendees with email",
+			change: internal.Change{Type: internal.EventCreated, Event: event},
+			wantTo: []string{"ivan@example.com"},
+			contains: []string{
+				"Content-Type: text/calendar; charset=UTF-8; method=REQUEST",
+				"METHOD:REQUEST",
+				"UID:e-1",
+				"DTSTART:20220902T100000Z",
+				"RRULE:FREQ=DAILY;BYDAY=MO,TU,WE,TH,FR",
+				`SUMMARY:Planning\, weekly`,
+				"ORGANIZER:mailto:olga@example.com",
+				"ATTENDEE;PARTSTAT=NEEDS-ACTION;RSVP=TRUE;CN=\"Ivan\":mailto:ivan@example.com",
+				"SEQUENCE:0",
+			},
+		},
+		{
+			name:   "Invitation to updated event",
+			change: internal.Change{Type: internal.EventCreated, Event: updated},
+			wantTo: []string{"ivan@example.com"},
+			contains: []string{
+				"METHOD:REQUEST",
+				"SEQUENCE:3",
+			},
+		},
+		{
+			name:   "Reply to organizer",
+			change: internal.Change{Type: internal.InvitationAccepted, User: "u-1", Event: event},
+			wantTo: []string{"olga@example.com"},
+			contains: []string{
+				"METHOD:REPLY",
+				"ATTENDEE;PARTSTAT=ACCEPTED;CN=\"Ivan\":mailto:ivan@example.com",
+			},
+		},
+		{
+			name:   "Decline of user without email",
+			change: internal.Change{Type: internal.InvitationRejected, User: "u-2", Event: event},
+		},
+		{
+			name:   "Private event",
+			change: internal.Change{Type: internal.EventCreated, Event: private},
+			wantTo: []string{"ivan@example.com"},
+			contains: []string{
+				"METHOD:REQUEST",
+				"CLASS:PRIVATE",
+			},
+		},
+		{
+			name:   "Cancellation",
+			change: internal.Change{Type: internal.EventCancelled, Event: event},
+			wantTo: []string{"ivan@example.com"},
+			contains: []string{
+				"METHOD:CANCEL",
+				"STATUS:CANCELLED",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server.mutex.Lock()
+			server.messages = nil
+			server.mutex.Unlock()
+			n.Notify(tt.change)
+			n.wg.Wait()
+			server.mutex.Lock()
+			defer server.mutex.Unlock()
+			if len(server.messages) != len(tt.wantTo) {
+				t.Fatalf("Notify() sent %v messages, want %v", len(server.messages), len(tt.wantTo))
+			}
+			for idx, curMessage := range server.messages {
+				if curMessage.to != tt.wantTo[idx] {
+					t.Errorf("Notify() sent to %v, want %v", curMessage.to, tt.wantTo[idx])
+				}
+				unfolded := strings.ReplaceAll(curMessage.data, "\r\n ", "")
+				for _, part := range tt.contains {
+					if !strings.Contains(unfolded, part) {
+						t.Errorf("Notify() message doesn't contain %q:\n%v", part, curMessage.data)
+					}
+				}
+			}
+		})
+	}
+}
+
+func Test_notifier_sendMessage(t *testing.T) {
+	server := newSMTPServer(t)
+	defer server.listener.Close()
+	n := New(storage.New(), server.listener.Addr().String(), "calendar@example.com", "", "")
+	subject := "Invitation: Планёрка\r\nBcc: eve@example.com\r\n\r\nInjected body"
+	if err := n.sendMessage("ivan@example.com", subject, Request, "BEGIN:VCALENDAR\r\n"); err != nil {
+		t.Fatalf("sendMessage() error = %v", err)
+	}
+	if len(server.messages) != 1 {
+		t.Fatalf("sendMessage() sent %v messages, want 1", len(server.messages))
+	}
+	parsed, err := mail.ReadMessage(strings.NewReader(server.messages[0].data))
+	if err != nil {
+		t.Fatalf("ReadMessage() error = %v", err)
+	}
+	if bcc := parsed.Header.Get("Bcc"); bcc != "" {
+		t.Errorf("sendMessage() message has Bcc header %q", bcc)
+	}
+	if got := parsed.Header.Get("Subject"); strings.ContainsAny(got, "\r\n") || !isASCII(got) {
+		t.Errorf("sendMessage() Subject header = %q, want encoded word", got)
+	}
+	decoded, err := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+	if err != nil || decoded != subject {
+		t.Errorf("sendMessage() decoded Subject = %q, %v, want %q", decoded, err, subject)
+	}
+	if got := parsed.Header.Get("To"); got != "<ivan@example.com>" {
+		t.Errorf("sendMessage() To header = %q, want <ivan@example.com>", got)
+	}
+}
+
+func isASCII(text string) bool {
+	for _, char := range text {
+		if char > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+func Test_fold(t *testing.T) {
+	line := "DESCRIPTION:" + strings.Repeat("ы", 100)
+	folded := fold(line)
+	for _, part := range strings.Split(folded, "\r\n") {
+		if len(part) > maxLineLength {
+			t.Errorf("fold() line length = %v, want at most %v", len(part), maxLineLength)
+		}
+	}
+	if got := strings.ReplaceAll(folded, "\r\n ", ""); got != line {
+		t.Errorf("fold() unfolded = %v, want %v", got, line)
+	}
+}
@@ -0,0 +1,130 @@
+package imip
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+type Message struct {
+	Method    Method
+	UID       string     //id of the event
+	Attendees []Attendee //replying attendees
+	Start     time.Time  //proposed start for COUNTER
+	Finish    time.Time  //proposed finish for COUNTER
+	Comment   string
+}
+
+// Parse reads iTIP message from the iCalendar object. Only the first VEVENT is taken into account.
+func Parse(raw string) (Message, error) {
+	var message Message
+	inEvent := false
+	eventFound := false
+	for _, line := range unfold(raw) {
+		name, params, value, ok := splitLine(line)
+		if !ok {
+			continue
+		}
+		switch {
+		case name == "BEGIN" && strings.EqualFold(value, "VEVENT"):
+			inEvent = !eventFound
+		case name == "END" && strings.EqualFold(value, "VEVENT"):
+			if inEvent {
+				eventFound = true
+			}
+			inEvent = false
+		case name == "METHOD":
+			message.Method = Method(strings.ToUpper(value))
+		case !inEvent:
+			continue
+		case name == "UID":
+			message.UID = value
+		case name == "ATTENDEE":
+			message.Attendees = append(message.Attendees, Attendee{
+				Name:     strings.Trim(params["CN"], "\""),
+				Email:    mailAddress(value),
+				PartStat: PartStat(strings.ToUpper(params["PARTSTAT"])),
+			})
+		case name == "DTSTART":
+			start, err := parseDateTime(value, params["TZID"])
+			if err != nil {
+				return Message{}, err
+			}
+			message.Start = start
+		case name == "DTEND":
+			finish, err := parseDateTime(value, params["TZID"])
+			if err != nil {
+				return Message{}, err
+			}
+			message.Finish = finish
+		case name == "COMMENT":
+			message.Comment = unescapeText(value)
+		}
+	}
+	if message.Method == "" || message.UID == "" {
+		return Message{}, errors.New("not an iTIP message")
+	}
+	return message, nil
+}
+
+// unfold joins folded content lines.
+func unfold(raw string) []string {
+	raw = strings.ReplaceAll(raw, "\r\n", "\n")
+	raw = strings.ReplaceAll(raw, "\n ", "")
+	raw = strings.ReplaceAll(raw, "\n\t", "")
+	return strings.Split(raw, "\n")
+}
+
+// splitLine parses content line "NAME;PARAM=value:VALUE".
+func splitLine(line string) (string, map[string]string, string, bool) {
+	quoted := false
+	colon := -1
+	for idx, char := range line {
+		if char == '"' {
+			quoted = !quoted
+		} else if char == ':' && !quoted {
+			colon = idx
+			break
+		}
+	}
+	if colon < 0 {
+		return "", nil, "", false
+	}
+	parts := strings.Split(line[:colon], ";")
+	params := map[string]string{}
+	for _, param := range parts[1:] {
+		if keyValue := strings.SplitN(param, "=", 2); len(keyValue) == 2 {
+			params[strings.ToUpper(keyValue[0])] = keyValue[1]
+		}
+	}
+	return strings.ToUpper(parts[0]), params, line[colon+1:], true
+}
+
+func mailAddress(value string) string {
+	if len(value) > len("mailto:") && strings.EqualFold(value[:len("mailto:")], "mailto:") {
+		value = value[len("mailto:"):]
+	}
+	return strings.ToLower(value)
+}
+
+func parseDateTime(value string, tzid string) (time.Time, error) {
+	if strings.HasSuffix(value, "Z") {
+		return time.Parse(dateTimeFormat, value)
+	}
+	location := time.UTC
+	if tzid != "" {
+		var err error
+		location, err = time.LoadLocation(strings.Trim(tzid, "\""))
+		if err != nil {
+			return time.Time{}, err
+		}
+	}
+	if len(value) == len("20060102") {
+		return time.ParseInLocation("20060102", value, location)
+	}
+	return time.ParseInLocation("20060102T150405", value, location)
+}
+
+func unescapeText(text string) string {
+	return strings.NewReplacer(`\\`, `\`, `\;`, ";", `\,`, ",", `\n`, "\n", `\N`, "\n").Replace(text)
+}
@@ -0,0 +1,115 @@
+package imip
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nivanov045/calendar/internal"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		want    Message
+		wantErr bool
+	}{
+		{
+			name: "Reply from mail client",
+			raw: "BEGIN:VCALENDAR\r\n" +
+				"METHOD:REPLY\r\n" +
+				"BEGIN:VTIMEZONE\r\nTZID:Europe/Moscow\r\nEND:VTIMEZONE\r\n" +
+				"BEGIN:VEVENT\r\n" +
+				"UID:788dfa05-0f5d-4799-899a-c3b0e9eb3044\r\n" +
+				"ATTENDEE;PARTSTAT=ACCEPTED;CN=\"Ivanov: Ivan\":MAILTO:Ivan@Example.com\r\n" +
+				"END:VEVENT\r\n" +
+				"END:VCALENDAR\r\n",
+			want: Message{
+				Method: Reply,
+				UID:    "788dfa05-0f5d-4799-899a-c3b0e9eb3044",
+				Attendees: []Attendee{{
+					Name:     "Ivanov: Ivan",
+					Email:    "ivan@example.com",
+					PartStat: Accepted,
+				}},
+			},
+		},
+		{
+			name: "Counter with folded comment and time zone",
+			raw: "BEGIN:VCALENDAR\n" +
+				"METHOD:COUNTER\n" +
+				"BEGIN:VEVENT\n" +
+				"UID:e-1\n" +
+				"DTSTART;TZID=Europe/Moscow:20220902T130000\n" +
+				"DTEND:20220902T110000Z\n" +
+				"COMMENT:Can we move it\\, please?\n  I'm busy\n" +
+				"ATTENDEE;PARTSTAT=NEEDS-ACTION:mailto:ivan@example.com\n" +
+				"END:VEVENT\n" +
+				"END:VCALENDAR\n",
+			want: Message{
+				Method: Counter,
+				UID:    "e-1",
+				Attendees: []Attendee{{
+					Email:    "ivan@example.com",
+					PartStat: NeedsAction,
+				}},
+				Start:   first(time.Parse(time.RFC3339, "2022-09-02T10:00:00Z")),
+				Finish:  first(time.Parse(time.RFC3339, "2022-09-02T11:00:00Z")),
+				Comment: "Can we move it, please? I'm busy",
+			},
+		},
+		{
+			name:    "Not a calendar",
+			raw:     "hello",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.raw)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !got.Start.Equal(tt.want.Start) || !got.Finish.Equal(tt.want.Finish) {
+				t.Errorf("Parse() times = %v - %v, want %v - %v", got.Start, got.Finish, tt.want.Start, tt.want.Finish)
+			}
+			got.Start, got.Finish, tt.want.Start, tt.want.Finish = time.Time{}, time.Time{}, time.Time{}, time.Time{}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuild_attendeeName(t *testing.T) {
+	event := internal.Event{
+		ID:     "e-1",
+		Start:  first(time.Parse(time.RFC3339, "2022-09-02T10:00:00Z")),
+		Finish: first(time.Parse(time.RFC3339, "2022-09-02T11:00:00Z")),
+	}
+	attendee := Attendee{Name: "Eve\"\r\nMETHOD:CANCEL", Email: "eve@example.com", PartStat: Accepted}
+	got := Build(Request, event, "olga@example.com", []Attendee{attendee}, time.Now())
+	if strings.Contains(got, "\r\nMETHOD:CANCEL") || !strings.Contains(got, `CN="Eve'METHOD:CANCEL":mailto:eve@example.com`) {
+		t.Errorf("Build() = %q, want the name without line breaks and quotes", got)
+	}
+}
+
+func TestParse_Build(t *testing.T) {
+	event := internal.Event{
+		ID:     "e-1",
+		Start:  first(time.Parse(time.RFC3339, "2022-09-02T10:00:00Z")),
+		Finish: first(time.Parse(time.RFC3339, "2022-09-02T11:00:00Z")),
+	}
+	attendee := Attendee{Name: "Ivan", Email: "ivan@example.com", PartStat: Declined}
+	got, err := Parse(Build(Reply, event, "olga@example.com", []Attendee{attendee}, time.Now()))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	want := Message{Method: Reply, UID: "e-1", Attendees: []Attendee{attendee}, Start: event.Start, Finish: event.Finish}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Parse() = %v, want %v", got, want)
+	}
+}
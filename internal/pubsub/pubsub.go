@@ -0,0 +1,101 @@
+package pubsub
+
+import (
+	"sync"
+
+	"github.com/nivanov045/calendar/internal"
+)
+
+// subscriberBuffer is the number of messages a subscriber may lag behind before it is disconnected.
+const subscriberBuffer = 64
+
+type Message struct {
+	ID     uint64          `json:"id"`              //sequential number of the change
+	Change internal.Change `json:"change"`          //published change
+	Reset  bool            `json:"reset,omitempty"` //changes after requested id are lost, state has to be fetched again
+}
+
+type subscriber struct {
+	user     string
+	messages chan Message
+}
+
+type broker struct {
+	lastID      uint64
+	history     []Message //last published messages for resuming
+	historySize int
+	subscribers map[*subscriber]struct{}
+	mutex       sync.Mutex
+}
+
+func New(historySize int) *broker {
+	return &broker{
+		historySize: historySize,
+		subscribers: map[*subscriber]struct{}{},
+	}
+}
+
+// Notify publishes the change to subscribers of concerned users. Subscribers which can't keep up are disconnected.
+func (b *broker) Notify(change internal.Change) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.lastID++
+	message := Message{ID: b.lastID, Change: change}
+	b.history = append(b.history, message)
+	if len(b.history) > b.historySize {
+		b.history = b.history[len(b.history)-b.historySize:]
+	}
+	for curSubscriber := range b.subscribers {
+		if !change.Concerns(curSubscriber.user) {
+			continue
+		}
+		select {
+		case curSubscriber.messages <- message:
+		default:
+			b.unsubscribe(curSubscriber)
+		}
+	}
+}
+
+// Subscribe returns channel of the user's changes published after lastID and function to stop the subscription.
+// The channel is closed when the subscription stops.
+func (b *broker) Subscribe(user string, lastID uint64) (<-chan Message, func()) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	var backlog []Message
+	if lastID > b.lastID {
+		//ids started again from zero after a restart
+		backlog = append(backlog, Message{ID: b.lastID, Reset: true})
+	} else if lastID != 0 && lastID < b.lastID {
+		if len(b.history) == 0 || b.history[0].ID > lastID+1 {
+			backlog = append(backlog, Message{ID: b.lastID, Reset: true})
+		} else {
+			for _, message := range b.history {
+				if message.ID > lastID && message.Change.Concerns(user) {
+					backlog = append(backlog, message)
+				}
+			}
+		}
+	}
+	curSubscriber := &subscriber{
+		user:     user,
+		messages: make(chan Message, len(backlog)+subscriberBuffer),
+	}
+	for _, message := range backlog {
+		curSubscriber.messages <- message
+	}
+	b.subscribers[curSubscriber] = struct{}{}
+	return curSubscriber.messages, func() {
+		b.mutex.Lock()
+		defer b.mutex.Unlock()
+		b.unsubscribe(curSubscriber)
+	}
+}
+
+func (b *broker) unsubscribe(curSubscriber *subscriber) {
+	if _, ok := b.subscribers[curSubscriber]; !ok {
+		return
+	}
+	delete(b.subscribers, curSubscriber)
+	close(curSubscriber.messages)
+}
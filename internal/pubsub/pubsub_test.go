@@ -0,0 +1,100 @@
+package pubsub
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/nivanov045/calendar/internal"
+)
+
+func receive(messages <-chan Message) []uint64 {
+	var result []uint64
+	for {
+		select {
+		case message, ok := <-messages:
+			if !ok {
+				return result
+			}
+			if message.Reset {
+				result = append(result, 0)
+			}
+			result = append(result, message.ID)
+		default:
+			return result
+		}
+	}
+}
+
+func Test_broker_Subscribe(t *testing.T) {
+	b := New(3)
+	forUser := internal.Change{Type: internal.UserInvited, User: "u-1"}
+	forOther := internal.Change{Type: internal.UserInvited, User: "u-2"}
+	forAttendee := internal.Change{Type: internal.EventCreated, Event: internal.Event{Participants: []string{"u-1"}}}
+	b.Notify(forUser)     //1
+	b.Notify(forOther)    //2
+	b.Notify(forAttendee) //3
+	b.Notify(forOther)    //4
+	tests := []struct {
+		name   string
+		lastID uint64
+		want   []uint64
+	}{
+		{
+			name:   "New subscription without history",
+			lastID: 0,
+		},
+		{
+			name:   "Resume from history",
+			lastID: 1,
+			want:   []uint64{3},
+		},
+		{
+			name:   "Resume from the last id",
+			lastID: 4,
+		},
+		{
+			name:   "Resume from id of before a restart",
+			lastID: 10,
+			want:   []uint64{0, 4},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			messages, cancel := b.Subscribe("u-1", tt.lastID)
+			defer cancel()
+			if got := receive(messages); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Subscribe() backlog = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	b.Notify(forOther) //5, history keeps 3-5
+	messages, cancel := b.Subscribe("u-1", 1)
+	if got, want := receive(messages), []uint64{0, 5}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Subscribe() after lost history = %v, want %v", got, want)
+	}
+	b.Notify(forUser)
+	b.Notify(forOther)
+	if got, want := receive(messages), []uint64{6}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Notify() delivered = %v, want %v", got, want)
+	}
+	cancel()
+	if _, ok := <-messages; ok {
+		t.Errorf("channel is open after cancel")
+	}
+}
+
+func Test_broker_Notify_slowSubscriber(t *testing.T) {
+	b := New(10)
+	messages, cancel := b.Subscribe("u-1", 0)
+	defer cancel()
+	for i := 0; i < subscriberBuffer+1; i++ {
+		b.Notify(internal.Change{User: "u-1"})
+	}
+	count := 0
+	for range messages {
+		count++
+	}
+	if count != subscriberBuffer {
+		t.Errorf("slow subscriber received %v messages, want %v and disconnect", count, subscriberBuffer)
+	}
+}
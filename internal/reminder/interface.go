@@ -0,0 +1,18 @@
+package reminder
+
+import (
+	"time"
+
+	"github.com/nivanov045/calendar/internal"
+)
+
+type Storage interface {
+	GetAllEvents(begin time.Time, end time.Time) ([]internal.Event, error)
+	MarkReminderFired(key string, start time.Time) (bool, error)
+	GetReminderWatermark() (time.Time, error)
+	SetReminderWatermark(watermark time.Time) error
+}
+
+type Notifier interface {
+	Notify(notification Notification) error
+}
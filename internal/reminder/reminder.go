@@ -0,0 +1,113 @@
+package reminder
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/nivanov045/calendar/internal"
+)
+
+const (
+	DefaultInterval  = time.Minute        //how often reminders are checked if the interval isn't positive
+	DefaultLookahead = 7 * 24 * time.Hour //the longest time between reminder and event start if the given one isn't positive
+)
+
+type Notification struct {
+	User   string         `json:"user"`    //user to remind
+	Event  internal.Event `json:"event"`   //occurrence of the event
+	FireAt time.Time      `json:"fire_at"` //planned moment of the reminder
+}
+
+type scheduler struct {
+	storage   Storage
+	notifier  Notifier
+	interval  time.Duration //how often reminders are checked
+	lookahead time.Duration //the longest supported time between reminder and event start
+}
+
+// New returns the scheduler of reminders, non-positive interval and lookahead are replaced with the defaults.
+func New(storage Storage, notifier Notifier, interval time.Duration, lookahead time.Duration) *scheduler {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	if lookahead <= 0 {
+		lookahead = DefaultLookahead
+	}
+	return &scheduler{
+		storage:   storage,
+		notifier:  notifier,
+		interval:  interval,
+		lookahead: lookahead,
+	}
+}
+
+// Run checks reminders every interval until the context is done.
+func (s *scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if err := s.Tick(now); err != nil {
+				log.Error().Err(err).Stack()
+			}
+		}
+	}
+}
+
+// Tick fires all reminders planned after the previous tick and not later than now.
+func (s *scheduler) Tick(now time.Time) error {
+	since, err := s.storage.GetReminderWatermark()
+	if err != nil {
+		return err
+	}
+	if since.IsZero() {
+		since = now.Add(-s.interval)
+	}
+	events, err := s.storage.GetAllEvents(since, now.Add(s.lookahead))
+	if err != nil {
+		return err
+	}
+	for _, occurrence := range events {
+		for _, curReminder := range occurrence.Reminders {
+			fireAt := occurrence.Start.Add(-curReminder.Before)
+			if !fireAt.After(since) || fireAt.After(now) || !occurrence.IsAttendee(curReminder.User) {
+				continue
+			}
+			key := fmt.Sprintf("%s|%s|%s|%d", occurrence.ID, occurrence.Start.UTC().Format(time.RFC3339), curReminder.User, curReminder.Before)
+			first, err := s.storage.MarkReminderFired(key, occurrence.Start)
+			if err != nil {
+				return err
+			}
+			if !first {
+				continue
+			}
+			err = s.notifier.Notify(Notification{User: curReminder.User, Event: occurrence, FireAt: fireAt})
+			if err != nil {
+				log.Error().Err(err).Stack()
+			}
+		}
+	}
+	return s.storage.SetReminderWatermark(now)
+}
+
+type logNotifier struct{}
+
+// NewLogNotifier returns notifier which only writes reminders to the log.
+func NewLogNotifier() *logNotifier {
+	return &logNotifier{}
+}
+
+func (n *logNotifier) Notify(notification Notification) error {
+	log.Info().
+		Str("user", notification.User).
+		Str("event", notification.Event.ID).
+		Time("start", notification.Event.Start).
+		Msg("reminder")
+	return nil
+}
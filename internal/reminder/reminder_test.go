@@ -0,0 +1,97 @@
+package reminder
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/nivanov045/calendar/internal"
+	"github.com/nivanov045/calendar/internal/storage"
+)
+
+type recordingNotifier struct {
+	notifications []Notification
+}
+
+func (n *recordingNotifier) Notify(notification Notification) error {
+	n.notifications = append(n.notifications, notification)
+	return nil
+}
+
+func first(t time.Time, _ error) time.Time {
+	return t
+}
+
+func Test_scheduler_Tick(t *testing.T) {
+	myStorage := storage.New()
+	err := myStorage.AddEvent(internal.Event{
+		ID:           "e-1",
+		Participants: []string{"u-1"},
+		Candidates:   []string{"u-2"},
+		Start:        first(time.Parse(time.RFC3339, "2022-09-02T10:00:00Z")),
+		Finish:       first(time.Parse(time.RFC3339, "2022-09-02T11:00:00Z")),
+		RepeatType:   internal.Daily,
+		Reminders: []internal.Reminder{
+			{User: "u-1", Before: 10 * time.Minute},
+			{User: "u-2", Before: 24 * time.Hour},
+			{User: "u-3", Before: 10 * time.Minute},
+		},
+	})
+	if err != nil {
+		t.Fatalf("AddEvent() error = %v", err)
+	}
+	tests := []struct {
+		name string
+		now  time.Time
+		want []string
+	}{
+		{
+			name: "Nothing to fire",
+			now:  first(time.Parse(time.RFC3339, "2022-09-02T09:00:00Z")),
+		},
+		{
+			name: "Reminder before first occurrence and a day before second one",
+			now:  first(time.Parse(time.RFC3339, "2022-09-02T10:00:00Z")),
+			want: []string{"u-1 2022-09-02T10:00:00Z", "u-2 2022-09-03T10:00:00Z"},
+		},
+		{
+			name: "Same moment again does not duplicate",
+			now:  first(time.Parse(time.RFC3339, "2022-09-02T10:00:00Z")),
+		},
+		{
+			name: "Next day",
+			now:  first(time.Parse(time.RFC3339, "2022-09-03T10:00:00Z")),
+			want: []string{"u-1 2022-09-03T10:00:00Z", "u-2 2022-09-04T10:00:00Z"},
+		},
+	}
+	notifier := &recordingNotifier{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			notifier.notifications = nil
+			//new scheduler on every tick imitates restart of the server
+			s := New(myStorage, notifier, time.Hour, 0)
+			if err := s.Tick(tt.now); err != nil {
+				t.Errorf("Tick() error = %v", err)
+				return
+			}
+			got := map[string]bool{}
+			for _, notification := range notifier.notifications {
+				got[notification.User+" "+notification.Event.Start.Format(time.RFC3339)] = true
+			}
+			want := map[string]bool{}
+			for _, key := range tt.want {
+				want[key] = true
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Tick() notifications = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func Test_New(t *testing.T) {
+	s := New(storage.New(), NewLogNotifier(), 0, -time.Hour)
+	if s.interval != DefaultInterval || s.lookahead != DefaultLookahead {
+		t.Errorf("New() interval = %v, lookahead = %v, want defaults", s.interval, s.lookahead)
+	}
+}
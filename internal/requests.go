@@ -0,0 +1,189 @@
+package internal
+
+import "time"
+
+// Requests and responses of the service, transports encode them in their own formats.
+
+// AnyVersion is the expected version of an event which matches every version. Changes of events require
+// the expected version, so that concurrent editors don't silently overwrite each other.
+const AnyVersion = -1
+
+type CreateUserRequest struct {
+	Info CustomUserInfo `json:"info"` //info about user
+}
+
+type IDResponse struct {
+	ID string `json:"id"` //id of created object
+}
+
+type UserRequest struct {
+	User string `json:"user"` //user id
+}
+
+type UpdateUserRequest struct {
+	User string         `json:"user"` //user id
+	Info CustomUserInfo `json:"info"` //new info about user
+}
+
+type ListUsersRequest struct {
+	Query              string `json:"query,omitempty"`               //prefix of name, word of name or email
+	Limit              int    `json:"limit,omitempty"`               //maximum number of users in the page
+	PageToken          string `json:"page_token,omitempty"`          //token of the page, the first page if empty
+	IncludeDeactivated bool   `json:"include_deactivated,omitempty"` //list deactivated users too
+}
+
+type UsersResponse struct {
+	Users         []User `json:"users"`                     //page of users sorted by name
+	NextPageToken string `json:"next_page_token,omitempty"` //token of the next page, empty for the last page
+}
+
+type CreateGroupRequest struct {
+	Info    CustomGroupInfo `json:"info"`              //info about group
+	Members []string        `json:"members,omitempty"` //ids of users and nested groups
+}
+
+type GroupRequest struct {
+	Group string `json:"group"` //group id
+}
+
+type UpdateGroupRequest struct {
+	Group   string          `json:"group"`             //group id
+	Info    CustomGroupInfo `json:"info"`              //new info about group
+	Members []string        `json:"members,omitempty"` //new ids of users and nested groups
+}
+
+type CreateCalendarRequest struct {
+	Owner string             `json:"owner"` //id of user or group who owns the calendar
+	Info  CustomCalendarInfo `json:"info"`  //info about calendar
+}
+
+type CalendarRequest struct {
+	Calendar string `json:"calendar"` //calendar id
+}
+
+type UpdateCalendarRequest struct {
+	Calendar string             `json:"calendar"` //calendar id
+	Info     CustomCalendarInfo `json:"info"`     //new info about calendar
+}
+
+type CreateEventRequest struct {
+	Event
+	Strict bool `json:"strict,omitempty"` //refuse event if participants are busy
+}
+
+type CreateEventResponse struct {
+	ID       string     `json:"id"`                 //id
+	Warnings []Conflict `json:"warnings,omitempty"` //overlapping events of attendees
+}
+
+type EventRequest struct {
+	Event   string `json:"event"`             //event id
+	Version int    `json:"version,omitempty"` //expected version of the changed event, required
+}
+
+type RestoreEventRequest struct {
+	Event    string `json:"event"`             //event id
+	Revision int    `json:"revision"`          //number of the revision to restore
+	Version  int    `json:"version,omitempty"` //expected version of the event, required
+}
+
+type InvitationRequest struct {
+	User    string `json:"user"`              //user id
+	Event   string `json:"event"`             //event id
+	Strict  bool   `json:"strict,omitempty"`  //refuse if user is busy
+	Version int    `json:"version,omitempty"` //expected version of the event, required
+}
+
+type WarningsResponse struct {
+	Warnings []Conflict `json:"warnings,omitempty"` //overlapping events of user
+}
+
+type EventsRequest struct {
+	User       string         `json:"user"`                  //user id
+	From       time.Time      `json:"from"`                  //from what moment find events
+	To         time.Time      `json:"to"`                    //to what moment find events
+	Calendar   string         `json:"calendar,omitempty"`    //only events of the user's calendar, all events of the user if empty
+	Limit      int            `json:"limit,omitempty"`       //maximum number of occurrences in the page, 50 if empty
+	PageToken  string         `json:"page_token,omitempty"`  //token of the page, the first page if empty
+	Status     ResponseStatus `json:"status,omitempty"`      //only events with the response of the user, accepted ones of the user if empty
+	RepeatType *RepeatType    `json:"repeat_type,omitempty"` //only events with the type of repeating
+	Organized  bool           `json:"organized,omitempty"`   //only events organized by the user
+	Query      string         `json:"query,omitempty"`       //only events whose name or description contains the text
+}
+
+type ResponseStatus string
+
+const (
+	Accepted    ResponseStatus = "accepted"     //the user participates
+	NeedsAction ResponseStatus = "needs_action" //the user hasn't answered the invitation yet
+	AnyStatus   ResponseStatus = "any"          //the user participates or is invited
+)
+
+type EventsResponse struct {
+	Events        []Event `json:"events"`                    //page of occurrences sorted by start
+	NextPageToken string  `json:"next_page_token,omitempty"` //token of the next page, empty for the last page
+}
+
+type FindSlotRequest struct {
+	Users      []string      `json:"users"`       //ids of users or groups
+	Duration   time.Duration `json:"duration"`    //duration of event
+	ValidUntil time.Time     `json:"valid_until"` //last interesting time
+	From       time.Time     `json:"from"`        //start of search, now if empty
+	SlotOptions
+}
+
+type FindSlotResponse struct {
+	Begin time.Time `json:"begin"` //begin of space
+}
+
+type BookSlotRequest struct {
+	Users      []string        `json:"users"`                 //ids of participants or groups
+	Candidates []string        `json:"candidates,omitempty"`  //ids of candidates or groups
+	Duration   time.Duration   `json:"duration"`              //duration of event
+	ValidUntil time.Time       `json:"valid_until"`           //last interesting time
+	From       time.Time       `json:"from"`                  //start of search, now if empty
+	RepeatType RepeatType      `json:"repeat_type,omitempty"` //type of repeating
+	Info       CustomEventInfo `json:"info,omitempty"`        //info about event
+	Organizer  string          `json:"organizer,omitempty"`   //id of user who creates the event
+	Reminders  []Reminder      `json:"reminders,omitempty"`   //reminders of attendees
+	Calendar   string          `json:"calendar,omitempty"`    //calendar containing the event, default calendars of attendees if empty
+	Visibility Visibility      `json:"visibility,omitempty"`  //visibility of details, default of the calendar if empty
+	SlotOptions
+}
+
+type BookSlotResponse struct {
+	ID     string    `json:"id"`     //id of created event
+	Start  time.Time `json:"start"`  //start of booked slot
+	Finish time.Time `json:"finish"` //finish of booked slot
+}
+
+type CreateWebhookResponse struct {
+	ID     string `json:"id"`     //id of created subscription
+	Secret string `json:"secret"` //key of signatures of payloads, not shown again
+}
+
+type DeleteWebhookRequest struct {
+	ID string `json:"id"` //id of subscription
+}
+
+type DeliveriesRequest struct {
+	Subscription string `json:"subscription,omitempty"` //id of subscription, all if empty
+	DeadLetters  bool   `json:"dead_letters,omitempty"` //only deliveries failed after all attempts
+}
+
+type SyncRequest struct {
+	User      string `json:"user"`                 //user id
+	SyncToken string `json:"sync_token,omitempty"` //token of the previous sync, full sync if empty
+}
+
+type SyncResponse struct {
+	SyncChanges
+	SyncToken string `json:"sync_token"` //token for the next sync
+}
+
+type AuditRequest struct {
+	User  string    `json:"user,omitempty"`  //only changes made or claimed to be made by the user or of the user
+	Event string    `json:"event,omitempty"` //only changes of the event
+	From  time.Time `json:"from"`            //from what moment find changes, from the beginning if empty
+	To    time.Time `json:"to"`              //to what moment find changes, till now if empty
+}
@@ -0,0 +1,116 @@
+package rpc
+
+import (
+	"time"
+
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/nivanov045/calendar/calendarpb"
+	"github.com/nivanov045/calendar/internal"
+)
+
+// timeFromProto returns zero time for absent timestamps, like omitted JSON fields.
+func timeFromProto(ts *timestamppb.Timestamp) time.Time {
+	if ts == nil {
+		return time.Time{}
+	}
+	return ts.AsTime()
+}
+
+// durationFromProto returns zero for absent durations.
+func durationFromProto(d *durationpb.Duration) time.Duration {
+	if d == nil {
+		return 0
+	}
+	return d.AsDuration()
+}
+
+func userInfoFromProto(info *calendarpb.UserInfo) internal.CustomUserInfo {
+	return internal.CustomUserInfo{
+		Name:     info.GetName(),
+		Email:    info.GetEmail(),
+		Title:    info.GetTitle(),
+		TimeZone: info.GetTimeZone(),
+		Locale:   info.GetLocale(),
+	}
+}
+
+func userToProto(user internal.User) *calendarpb.User {
+	return &calendarpb.User{
+		Id: user.ID,
+		Info: &calendarpb.UserInfo{
+			Name:     user.Info.Name,
+			Email:    user.Info.Email,
+			Title:    user.Info.Title,
+			TimeZone: user.Info.TimeZone,
+			Locale:   user.Info.Locale,
+		},
+		Deactivated: user.Deactivated,
+	}
+}
+
+func eventFromProto(event *calendarpb.Event) internal.Event {
+	if event == nil {
+		return internal.Event{}
+	}
+	result := internal.Event{
+		ID:           event.GetId(),
+		Organizer:    event.GetOrganizer(),
+		Candidates:   event.GetCandidates(),
+		Participants: event.GetParticipants(),
+		Start:        timeFromProto(event.GetStart()),
+		Finish:       timeFromProto(event.GetFinish()),
+		RepeatType:   internal.RepeatType(event.GetRepeatType()),
+		Calendar:     event.GetCalendar(),
+		Visibility:   internal.Visibility(event.GetVisibility()),
+		Info: internal.CustomEventInfo{
+			Name:        event.GetInfo().GetName(),
+			Description: event.GetInfo().GetDescription(),
+		},
+	}
+	for _, reminder := range event.GetReminders() {
+		result.Reminders = append(result.Reminders, internal.Reminder{
+			User:   reminder.GetUser(),
+			Before: durationFromProto(reminder.GetBefore()),
+		})
+	}
+	return result
+}
+
+func eventToProto(event internal.Event) *calendarpb.Event {
+	result := &calendarpb.Event{
+		Id:           event.ID,
+		Organizer:    event.Organizer,
+		Candidates:   event.Candidates,
+		Participants: event.Participants,
+		Start:        timestamppb.New(event.Start),
+		Finish:       timestamppb.New(event.Finish),
+		RepeatType:   calendarpb.RepeatType(event.RepeatType),
+		Info:         &calendarpb.EventInfo{Name: event.Info.Name, Description: event.Info.Description},
+		InvitedVia:   event.InvitedVia,
+		Calendar:     event.Calendar,
+		Visibility:   string(event.Visibility),
+		Version:      int64(event.Version),
+	}
+	for _, reminder := range event.Reminders {
+		result.Reminders = append(result.Reminders, &calendarpb.Reminder{
+			User:   reminder.User,
+			Before: durationpb.New(reminder.Before),
+		})
+	}
+	return result
+}
+
+func conflictsToProto(conflicts []internal.Conflict) []*calendarpb.Conflict {
+	var result []*calendarpb.Conflict
+	for _, conflict := range conflicts {
+		result = append(result, &calendarpb.Conflict{
+			User:   conflict.User,
+			Event:  conflict.Event,
+			Start:  timestamppb.New(conflict.Start),
+			Finish: timestamppb.New(conflict.Finish),
+		})
+	}
+	return result
+}
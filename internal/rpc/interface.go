@@ -0,0 +1,23 @@
+package rpc
+
+import (
+	"context"
+
+	"github.com/nivanov045/calendar/internal"
+)
+
+type Service interface {
+	CreateUser(ctx context.Context, request internal.CreateUserRequest) (internal.IDResponse, error)
+	GetUser(ctx context.Context, request internal.UserRequest) (internal.User, error)
+	CreateEventWithUsers(ctx context.Context, request internal.CreateEventRequest) (internal.CreateEventResponse, error)
+	GetEventDetails(ctx context.Context, request internal.EventRequest) (internal.Event, error)
+	CancelEvent(ctx context.Context, request internal.EventRequest) error
+	AcceptInvitation(ctx context.Context, request internal.InvitationRequest) (internal.WarningsResponse, error)
+	RejectInvitation(ctx context.Context, request internal.InvitationRequest) error
+	GetEvents(ctx context.Context, request internal.EventsRequest) (internal.EventsResponse, error)
+	FindSlot(ctx context.Context, request internal.FindSlotRequest) (internal.FindSlotResponse, error)
+}
+
+type Tenants interface {
+	Authenticate(key string) (internal.Organization, error)
+}
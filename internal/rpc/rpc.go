@@ -0,0 +1,245 @@
+// Package rpc serves the calendar over gRPC, sharing the service layer with the HTTP API.
+package rpc
+
+import (
+	"context"
+	"net"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/nivanov045/calendar/calendarpb"
+	"github.com/nivanov045/calendar/internal"
+	"github.com/nivanov045/calendar/internal/audit"
+	"github.com/nivanov045/calendar/internal/tenant"
+)
+
+type server struct {
+	calendarpb.UnimplementedCalendarServer
+	service Service
+	tenants Tenants
+}
+
+type Option func(*server)
+
+// WithTenants makes every call authenticate with the API key of an organization
+// in the metadata "authorization: Bearer <key>".
+func WithTenants(tenants Tenants) Option {
+	return func(s *server) {
+		s.tenants = tenants
+	}
+}
+
+func New(service Service, options ...Option) *server {
+	s := &server{service: service}
+	for _, option := range options {
+		option(s)
+	}
+	return s
+}
+
+// Run serves gRPC requests on the address until the listener fails.
+func (s *server) Run(address string) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	grpcServer := grpc.NewServer(s.ServerOptions()...)
+	s.Register(grpcServer)
+	return grpcServer.Serve(listener)
+}
+
+// Register adds the calendar service to the gRPC server.
+func (s *server) Register(grpcServer *grpc.Server) {
+	calendarpb.RegisterCalendarServer(grpcServer, s)
+}
+
+// ServerOptions returns options of the gRPC server which authenticate calls and pass their actors.
+func (s *server) ServerOptions() []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			ctx, err := s.authenticate(ctx)
+			if err != nil {
+				return nil, err
+			}
+			return handler(withActor(ctx), req)
+		}),
+		grpc.StreamInterceptor(func(srv interface{}, stream grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			ctx, err := s.authenticate(stream.Context())
+			if err != nil {
+				return err
+			}
+			return handler(srv, &authenticatedStream{ServerStream: stream, ctx: withActor(ctx)})
+		}),
+	}
+}
+
+// authenticate returns the context of the call on behalf of the organization of its API key, if organizations are set.
+func (s *server) authenticate(ctx context.Context) (context.Context, error) {
+	if s.tenants == nil {
+		return ctx, nil
+	}
+	var key string
+	if values := metadata.ValueFromIncomingContext(ctx, "authorization"); len(values) > 0 {
+		key = strings.TrimPrefix(values[0], "Bearer ")
+	}
+	organization, err := s.tenants.Authenticate(key)
+	if err != nil {
+		return nil, statusOf(err)
+	}
+	return audit.WithCaller(tenant.NewContext(ctx, organization), tenant.KeyID(key)), nil
+}
+
+// withActor returns the context with the user from the metadata "x-actor" who the client says makes the call,
+// for the audit log.
+func withActor(ctx context.Context) context.Context {
+	if values := metadata.ValueFromIncomingContext(ctx, "x-actor"); len(values) > 0 && values[0] != "" {
+		return audit.WithClaimedActor(ctx, values[0])
+	}
+	return ctx
+}
+
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
+
+// statusOf maps service errors to gRPC statuses.
+func statusOf(err error) error {
+	log.Error().Err(err).Stack()
+	switch err.Error() {
+	case "wrong query", "wrong repeat type", "wrong calendar":
+		return status.Error(codes.InvalidArgument, err.Error())
+	case "conflict with existing events", "deactivated user", "version mismatch", "version required":
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case "unexisted user", "unexisted event", "unexisted user in event", "unexisted calendar", "no such slot":
+		return status.Error(codes.NotFound, err.Error())
+	case "unauthorized":
+		return status.Error(codes.Unauthenticated, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+func (s *server) CreateUser(ctx context.Context, req *calendarpb.CreateUserRequest) (*calendarpb.CreateUserResponse, error) {
+	resp, err := s.service.CreateUser(ctx, internal.CreateUserRequest{Info: userInfoFromProto(req.GetInfo())})
+	if err != nil {
+		return nil, statusOf(err)
+	}
+	return &calendarpb.CreateUserResponse{Id: resp.ID}, nil
+}
+
+func (s *server) GetUser(ctx context.Context, req *calendarpb.GetUserRequest) (*calendarpb.User, error) {
+	user, err := s.service.GetUser(ctx, internal.UserRequest{User: req.GetId()})
+	if err != nil {
+		return nil, statusOf(err)
+	}
+	return userToProto(user), nil
+}
+
+func (s *server) CreateEvent(ctx context.Context, req *calendarpb.CreateEventRequest) (*calendarpb.CreateEventResponse, error) {
+	resp, err := s.service.CreateEventWithUsers(ctx, internal.CreateEventRequest{
+		Event:  eventFromProto(req.GetEvent()),
+		Strict: req.GetStrict(),
+	})
+	if err != nil {
+		return nil, statusOf(err)
+	}
+	return &calendarpb.CreateEventResponse{Id: resp.ID, Warnings: conflictsToProto(resp.Warnings)}, nil
+}
+
+func (s *server) GetEvent(ctx context.Context, req *calendarpb.GetEventRequest) (*calendarpb.Event, error) {
+	event, err := s.service.GetEventDetails(ctx, internal.EventRequest{Event: req.GetId()})
+	if err != nil {
+		return nil, statusOf(err)
+	}
+	return eventToProto(event), nil
+}
+
+func (s *server) CancelEvent(ctx context.Context, req *calendarpb.CancelEventRequest) (*calendarpb.CancelEventResponse, error) {
+	if err := s.service.CancelEvent(ctx, internal.EventRequest{Event: req.GetId(), Version: int(req.GetVersion())}); err != nil {
+		return nil, statusOf(err)
+	}
+	return &calendarpb.CancelEventResponse{}, nil
+}
+
+func invitationRequest(req *calendarpb.InvitationRequest) internal.InvitationRequest {
+	return internal.InvitationRequest{
+		User:    req.GetUser(),
+		Event:   req.GetEvent(),
+		Strict:  req.GetStrict(),
+		Version: int(req.GetVersion()),
+	}
+}
+
+func (s *server) AcceptInvitation(ctx context.Context, req *calendarpb.InvitationRequest) (*calendarpb.AcceptInvitationResponse, error) {
+	resp, err := s.service.AcceptInvitation(ctx, invitationRequest(req))
+	if err != nil {
+		return nil, statusOf(err)
+	}
+	return &calendarpb.AcceptInvitationResponse{Warnings: conflictsToProto(resp.Warnings)}, nil
+}
+
+func (s *server) RejectInvitation(ctx context.Context, req *calendarpb.InvitationRequest) (*calendarpb.RejectInvitationResponse, error) {
+	if err := s.service.RejectInvitation(ctx, invitationRequest(req)); err != nil {
+		return nil, statusOf(err)
+	}
+	return &calendarpb.RejectInvitationResponse{}, nil
+}
+
+func (s *server) ListEvents(req *calendarpb.ListEventsRequest, stream calendarpb.Calendar_ListEventsServer) error {
+	request := internal.EventsRequest{
+		User:      req.GetUser(),
+		From:      timeFromProto(req.GetFrom()),
+		To:        timeFromProto(req.GetTo()),
+		Calendar:  req.GetCalendar(),
+		Limit:     int(req.GetLimit()),
+		PageToken: req.GetPageToken(),
+		Status:    internal.ResponseStatus(req.GetStatus()),
+		Organized: req.GetOrganized(),
+		Query:     req.GetQuery(),
+	}
+	if req.RepeatType != nil {
+		repeatType := internal.RepeatType(req.GetRepeatType())
+		request.RepeatType = &repeatType
+	}
+	resp, err := s.service.GetEvents(stream.Context(), request)
+	if err != nil {
+		return statusOf(err)
+	}
+	if resp.NextPageToken != "" {
+		stream.SetTrailer(metadata.Pairs("next-page-token", resp.NextPageToken))
+	}
+	for _, event := range resp.Events {
+		if err := stream.Send(eventToProto(event)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *server) FindSlot(ctx context.Context, req *calendarpb.FindSlotRequest) (*calendarpb.FindSlotResponse, error) {
+	resp, err := s.service.FindSlot(ctx, internal.FindSlotRequest{
+		Users:      req.GetUsers(),
+		Duration:   durationFromProto(req.GetDuration()),
+		ValidUntil: timeFromProto(req.GetValidUntil()),
+		From:       timeFromProto(req.GetFrom()),
+		SlotOptions: internal.SlotOptions{
+			Granularity:  durationFromProto(req.GetGranularity()),
+			BufferBefore: durationFromProto(req.GetBufferBefore()),
+			BufferAfter:  durationFromProto(req.GetBufferAfter()),
+		},
+	})
+	if err != nil {
+		return nil, statusOf(err)
+	}
+	return &calendarpb.FindSlotResponse{Begin: timestamppb.New(resp.Begin)}, nil
+}
@@ -0,0 +1,248 @@
+package rpc
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/nivanov045/calendar/calendarpb"
+	"github.com/nivanov045/calendar/internal"
+	"github.com/nivanov045/calendar/internal/service"
+	"github.com/nivanov045/calendar/internal/storage"
+	"github.com/nivanov045/calendar/internal/tenant"
+)
+
+func newClient(t *testing.T) calendarpb.CalendarClient {
+	return newClientOf(t, New(service.New(storage.New(), nil, nil)))
+}
+
+func newClientOf(t *testing.T, s *server) calendarpb.CalendarClient {
+	listener := bufconn.Listen(1 << 20)
+	grpcServer := grpc.NewServer(s.ServerOptions()...)
+	s.Register(grpcServer)
+	go grpcServer.Serve(listener)
+	t.Cleanup(grpcServer.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return calendarpb.NewCalendarClient(conn)
+}
+
+func createUser(t *testing.T, client calendarpb.CalendarClient, name string) string {
+	resp, err := client.CreateUser(context.Background(), &calendarpb.CreateUserRequest{
+		Info: &calendarpb.UserInfo{Name: name},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.GetId()
+}
+
+// listEvents returns the number of streamed occurrences and the token of the next page.
+func listEvents(t *testing.T, client calendarpb.CalendarClient, req *calendarpb.ListEventsRequest) (int, string) {
+	t.Helper()
+	stream, err := client.ListEvents(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var received int
+	for {
+		_, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		received++
+	}
+	var next string
+	if values := stream.Trailer().Get("next-page-token"); len(values) > 0 {
+		next = values[0]
+	}
+	return received, next
+}
+
+func TestServer(t *testing.T) {
+	client := newClient(t)
+	ctx := context.Background()
+	organizer := createUser(t, client, "organizer")
+	guest := createUser(t, client, "guest")
+
+	user, err := client.GetUser(ctx, &calendarpb.GetUserRequest{Id: guest})
+	if err != nil || user.GetInfo().GetName() != "guest" {
+		t.Fatalf("GetUser() = %v, %v", user, err)
+	}
+
+	start := time.Date(2022, 9, 5, 10, 0, 0, 0, time.UTC)
+	created, err := client.CreateEvent(ctx, &calendarpb.CreateEventRequest{Event: &calendarpb.Event{
+		Organizer:    organizer,
+		Participants: []string{organizer},
+		Candidates:   []string{guest},
+		Start:        timestamppb.New(start),
+		Finish:       timestamppb.New(start.Add(time.Hour)),
+		RepeatType:   calendarpb.RepeatType_REPEAT_TYPE_DAILY,
+		Info:         &calendarpb.EventInfo{Name: "standup"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	event, err := client.GetEvent(ctx, &calendarpb.GetEventRequest{Id: created.GetId()})
+	if err != nil || event.GetInfo().GetName() != "standup" || !event.GetStart().AsTime().Equal(start) || event.GetVersion() != 1 {
+		t.Fatalf("GetEvent() = %v, %v", event, err)
+	}
+
+	_, err = client.AcceptInvitation(ctx, &calendarpb.InvitationRequest{User: guest, Event: created.GetId()})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("AcceptInvitation() without version: %v, want FailedPrecondition", err)
+	}
+	if _, err := client.AcceptInvitation(ctx, &calendarpb.InvitationRequest{User: guest, Event: created.GetId(), Version: event.GetVersion()}); err != nil {
+		t.Fatal(err)
+	}
+
+	week := &calendarpb.ListEventsRequest{User: guest, From: timestamppb.New(start), To: timestamppb.New(start.Add(72 * time.Hour))}
+	if received, next := listEvents(t, client, week); received != 3 || next != "" {
+		t.Errorf("ListEvents() streamed %d occurrences with next page %q, want 3 without next page", received, next)
+	}
+	weekly := calendarpb.RepeatType_REPEAT_TYPE_WEEKLY
+	tests := []struct {
+		name string
+		req  *calendarpb.ListEventsRequest
+		want int
+	}{
+		{name: "Invitations", req: &calendarpb.ListEventsRequest{Status: "needs_action"}, want: 0},
+		{name: "Repeat type", req: &calendarpb.ListEventsRequest{RepeatType: &weekly}, want: 0},
+		{name: "Organized", req: &calendarpb.ListEventsRequest{Organized: true}, want: 0},
+		{name: "Query", req: &calendarpb.ListEventsRequest{Query: "STAND"}, want: 3},
+		{name: "Limit", req: &calendarpb.ListEventsRequest{Limit: 2}, want: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.req.User, tt.req.From, tt.req.To = week.User, week.From, week.To
+			if received, _ := listEvents(t, client, tt.req); received != tt.want {
+				t.Errorf("ListEvents() streamed %d occurrences, want %d", received, tt.want)
+			}
+		})
+	}
+	first := &calendarpb.ListEventsRequest{User: week.User, From: week.From, To: week.To, Limit: 2}
+	_, next := listEvents(t, client, first)
+	if received, last := listEvents(t, client, &calendarpb.ListEventsRequest{
+		User: week.User, From: week.From, To: week.To, Limit: 2, PageToken: next,
+	}); next == "" || received != 1 || last != "" {
+		t.Errorf("ListEvents() of the next page %q streamed %d occurrences with next page %q, want 1 without next page", next, received, last)
+	}
+
+	slot, err := client.FindSlot(ctx, &calendarpb.FindSlotRequest{
+		Users:      []string{organizer, guest},
+		Duration:   durationpb.New(30 * time.Minute),
+		From:       timestamppb.New(start),
+		ValidUntil: timestamppb.New(start.Add(24 * time.Hour)),
+	})
+	if err != nil || !slot.GetBegin().AsTime().Equal(start.Add(time.Hour)) {
+		t.Fatalf("FindSlot() = %v, %v", slot, err)
+	}
+
+	_, err = client.CancelEvent(ctx, &calendarpb.CancelEventRequest{Id: created.GetId(), Version: event.GetVersion()})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("CancelEvent() of outdated version: %v, want FailedPrecondition", err)
+	}
+	if _, err := client.CancelEvent(ctx, &calendarpb.CancelEventRequest{Id: created.GetId(), Version: event.GetVersion() + 1}); err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.GetEvent(ctx, &calendarpb.GetEventRequest{Id: created.GetId()})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("GetEvent() of cancelled event: %v, want NotFound", err)
+	}
+}
+
+func TestServerErrors(t *testing.T) {
+	client := newClient(t)
+	ctx := context.Background()
+
+	_, err := client.GetUser(ctx, &calendarpb.GetUserRequest{Id: "unknown"})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("GetUser() error = %v, want NotFound", err)
+	}
+
+	user := createUser(t, client, "user")
+	_, err = client.CreateEvent(ctx, &calendarpb.CreateEventRequest{Event: &calendarpb.Event{
+		Participants: []string{user},
+		RepeatType:   calendarpb.RepeatType(42),
+	}})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("CreateEvent() error = %v, want InvalidArgument", err)
+	}
+
+	stream, err := client.ListEvents(ctx, &calendarpb.ListEventsRequest{User: "unknown"})
+	if err == nil {
+		_, err = stream.Recv()
+	}
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("ListEvents() error = %v, want NotFound", err)
+	}
+	stream, err = client.ListEvents(ctx, &calendarpb.ListEventsRequest{User: "unknown", Status: "maybe"})
+	if err == nil {
+		_, err = stream.Recv()
+	}
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("ListEvents() with unknown status error = %v, want InvalidArgument", err)
+	}
+}
+
+func TestServerOrganizations(t *testing.T) {
+	tenants, err := tenant.New([]tenant.Entry{
+		{Organization: internal.Organization{ID: "sales"}, APIKeys: []string{"sales-key"}},
+		{Organization: internal.Organization{ID: "hr"}, APIKeys: []string{"hr-key"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	serv := service.New(storage.New(), nil, nil, service.WithTenants(func(internal.Organization) service.Scope {
+		return service.Scope{Storage: storage.New()}
+	}))
+	client := newClientOf(t, New(serv, WithTenants(tenants)))
+
+	if _, err := client.CreateUser(context.Background(), &calendarpb.CreateUserRequest{Info: &calendarpb.UserInfo{Name: "user"}}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("CreateUser() without key error = %v, want Unauthenticated", err)
+	}
+	sales := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer sales-key")
+	hr := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer hr-key")
+	resp, err := client.CreateUser(sales, &calendarpb.CreateUserRequest{Info: &calendarpb.UserInfo{Name: "user"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.GetUser(sales, &calendarpb.GetUserRequest{Id: resp.GetId()}); err != nil {
+		t.Errorf("GetUser() error = %v", err)
+	}
+	if _, err := client.GetUser(hr, &calendarpb.GetUserRequest{Id: resp.GetId()}); status.Code(err) != codes.NotFound {
+		t.Errorf("GetUser() of another organization error = %v, want NotFound", err)
+	}
+
+	stream, err := client.ListEvents(hr, &calendarpb.ListEventsRequest{User: resp.GetId()})
+	if err == nil {
+		_, err = stream.Recv()
+	}
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("ListEvents() of another organization error = %v, want NotFound", err)
+	}
+}
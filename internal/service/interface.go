@@ -4,14 +4,57 @@ import (
 	"time"
 
 	"github.com/nivanov045/calendar/internal"
+	"github.com/nivanov045/calendar/internal/pubsub"
+	"github.com/nivanov045/calendar/internal/webhook"
 )
 
 type Storage interface {
 	AddUser(user internal.User) error
+	GetUser(id string) (internal.User, error)
+	FindUserByEmail(email string) (internal.User, error)
+	UpdateUser(id string, info internal.CustomUserInfo) (internal.User, error)
+	DeactivateUser(id string, now time.Time) error
+	ListUsers(query string, includeDeactivated bool) []internal.User
+	AddGroup(group internal.Group) error
+	GetGroup(id string) (internal.Group, error)
+	UpdateGroup(group internal.Group) error
+	DeleteGroup(id string) error
+	ExpandGroup(id string) ([]string, error)
+	AddCalendar(calendar internal.Calendar) error
+	GetCalendar(id string) (internal.Calendar, error)
+	UpdateCalendar(id string, info internal.CustomCalendarInfo) (internal.Calendar, error)
+	DeleteCalendar(id string) error
+	ListCalendars(owners ...string) []internal.Calendar
+	MemberGroups(user string) []string
+	GetCalendarEvents(calendar string, begin time.Time, end time.Time) ([]internal.Event, error)
 	AddEvent(event internal.Event) error
+	AddEventStrict(event internal.Event, horizon time.Time) error
 	GetEvent(id string) (internal.Event, error)
-	Accept(user string, event string) error
-	Reject(user string, event string) error
+	CancelEvent(id string, version int) error
+	Accept(user string, event string, version int) error
+	AcceptStrict(user string, event string, version int, horizon time.Time) error
+	FindConflicts(event internal.Event, users []string, horizon time.Time) ([]internal.Conflict, error)
+	Reject(user string, event string, version int) error
 	GetEvents(user string, begin time.Time, end time.Time) ([]internal.Event, error)
-	FindFreeSlot(users []string, begin time.Time, duration time.Duration, validUntil time.Time) (from time.Time, err error)
+	GetInvitations(user string, begin time.Time, end time.Time) ([]internal.Event, error)
+	FindFreeSlot(users []string, begin time.Time, duration time.Duration, validUntil time.Time, options internal.SlotOptions) (from time.Time, err error)
+	AddCounterProposal(proposal internal.CounterProposal) error
+	GetCounterProposals(event string) ([]internal.CounterProposal, error)
+	GetChanges(user string, since uint64) (internal.SyncChanges, error)
+	AddAuditRecord(record internal.AuditRecord)
+	GetAuditRecords(user string, target string, begin time.Time, end time.Time) []internal.AuditRecord
+	GetEventRevisions(id string) ([]internal.EventRevision, error)
+	RestoreEvent(id string, number int, version int) (internal.Event, error)
+	BookFreeSlot(event internal.Event, begin time.Time, duration time.Duration, validUntil time.Time, options internal.SlotOptions) (internal.Event, error)
+}
+
+type Webhooks interface {
+	Subscribe(subscription webhook.Subscription) (webhook.Subscription, error)
+	Unsubscribe(id string) error
+	Deliveries(subscription string) []webhook.Delivery
+	DeadLetters(subscription string) []webhook.Delivery
+}
+
+type Changes interface {
+	Subscribe(user string, lastID uint64) (<-chan pubsub.Message, func())
 }
@@ -1,217 +1,1212 @@
 package service
 
 import (
-	"encoding/json"
+	"context"
+	"encoding/base64"
 	"errors"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/rs/zerolog/log"
 
 	"github.com/nivanov045/calendar/internal"
+	"github.com/nivanov045/calendar/internal/audit"
+	"github.com/nivanov045/calendar/internal/imip"
+	"github.com/nivanov045/calendar/internal/pubsub"
+	"github.com/nivanov045/calendar/internal/tenant"
+	"github.com/nivanov045/calendar/internal/webhook"
+)
+
+// conflictHorizon limits how far repetitions of events are checked for conflicts.
+const conflictHorizon = 365 * 24 * time.Hour
+
+const (
+	defaultPageSize = 50  //page size if the limit isn't set
+	maxPageSize     = 500 //the largest allowed page
 )
 
 type service struct {
-	storage Storage
+	storage  Storage
+	webhooks Webhooks
+	changes  Changes
+	newScope func(organization internal.Organization) Scope //creates data of an organization, nil for a single organization
+	scopes   map[string]*service                            //services of organizations by id
+	stops    []func()                                       //stop background work of created scopes
+	mutex    sync.Mutex
+
+	reminderLookahead time.Duration //the longest time between reminder and event start, unlimited if zero
 }
 
-func New(storage Storage) *service {
-	return &service{storage: storage}
+// Scope holds the data of one organization, requests of the organization never reach data of others.
+type Scope struct {
+	Storage  Storage
+	Webhooks Webhooks
+	Changes  Changes
+	Stop     func() //stops background work of the scope like reminders, nil if there is none
 }
 
-func (s *service) CreateUser(body []byte) ([]byte, error) {
-	var userInfo internal.CustomUserInfo
-	err := json.Unmarshal(body, &userInfo)
-	if err != nil {
-		log.Error().Err(err).Stack()
-		return nil, errors.New("wrong query")
+type Option func(*service)
+
+// WithTenants makes the service keep the data of every organization in its own scope created on the first
+// request of the organization. Requests without an organization use the scope passed to New. Scopes live
+// until Close, their number is limited by the organizations allowed to authenticate.
+func WithTenants(newScope func(organization internal.Organization) Scope) Option {
+	return func(s *service) {
+		s.newScope = newScope
+	}
+}
+
+// WithReminderLookahead makes the service refuse reminders earlier than lookahead before the event start,
+// the scheduler doesn't look further for them.
+func WithReminderLookahead(lookahead time.Duration) Option {
+	return func(s *service) {
+		s.reminderLookahead = lookahead
+	}
+}
+
+func New(storage Storage, webhooks Webhooks, changes Changes, options ...Option) *service {
+	s := &service{storage: storage, webhooks: webhooks, changes: changes, scopes: map[string]*service{}}
+	for _, option := range options {
+		option(s)
+	}
+	return s
+}
+
+// scoped returns the service working with the data of the organization of the request.
+func (s *service) scoped(ctx context.Context) *service {
+	organization, ok := tenant.FromContext(ctx)
+	if !ok || s.newScope == nil {
+		return s
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	scoped, ok := s.scopes[organization.ID]
+	if !ok {
+		scope := s.newScope(organization)
+		scoped = &service{storage: scope.Storage, webhooks: scope.Webhooks, changes: scope.Changes,
+			reminderLookahead: s.reminderLookahead}
+		s.scopes[organization.ID] = scoped
+		if scope.Stop != nil {
+			s.stops = append(s.stops, scope.Stop)
+		}
+	}
+	return scoped
+}
+
+// Close stops background work of scopes of organizations and forgets them.
+func (s *service) Close() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, stop := range s.stops {
+		stop()
+	}
+	s.stops = nil
+	s.scopes = map[string]*service{}
+}
+
+// settings returns the settings of the organization of the request.
+func settings(ctx context.Context) internal.OrganizationSettings {
+	organization, _ := tenant.FromContext(ctx)
+	return organization.Settings
+}
+
+// record appends the change of the target to the audit log. The actor is always the authenticated caller.
+// claimed is the user the client says acts, like the user accepting an invitation, and is empty if the request
+// doesn't name one; as nothing verifies it, it is kept apart like the user of the header X-Actor, which is used
+// when claimed is empty. before is nil for created objects and after is nil for removed ones.
+func (s *service) record(ctx context.Context, claimed string, action internal.AuditAction, target string, before interface{}, after interface{}) {
+	if claimed == "" {
+		claimed = audit.ClaimedActor(ctx)
+	}
+	s.storage.AddAuditRecord(internal.AuditRecord{
+		Time:         time.Now(),
+		Actor:        audit.Caller(ctx),
+		ClaimedActor: claimed,
+		Action:       action,
+		Target:       target,
+		RequestID:    audit.RequestID(ctx),
+		Changes:      audit.Diff(before, after),
+	})
+}
+
+func (s *service) CreateUser(ctx context.Context, request internal.CreateUserRequest) (internal.IDResponse, error) {
+	s = s.scoped(ctx)
+	if !isValidUserInfo(request.Info) {
+		return internal.IDResponse{}, errors.New("wrong query")
+	}
+	if request.Info.TimeZone == "" {
+		request.Info.TimeZone = settings(ctx).TimeZone
 	}
 	id := uuid.New().String()
 	newUser := internal.User{
-		Info: internal.CustomUserInfo{},
+		Info: request.Info,
 		ID:   id,
 	}
-	err = s.storage.AddUser(newUser)
+	err := s.storage.AddUser(newUser)
 	if err != nil {
 		log.Error().Err(err).Stack()
-		return nil, err
+		return internal.IDResponse{}, err
 	}
-	type response struct {
-		ID string `json:"id"`
+	s.record(ctx, "", internal.ActionCreateUser, id, nil, newUser)
+	return internal.IDResponse{ID: id}, nil
+}
+
+func (s *service) GetUser(ctx context.Context, request internal.UserRequest) (internal.User, error) {
+	s = s.scoped(ctx)
+	user, err := s.storage.GetUser(request.User)
+	if err != nil {
+		log.Error().Err(err).Stack()
+		if err.Error() == "unexisted user" {
+			return internal.User{}, err
+		}
+		return internal.User{}, errors.New("unable to get user")
+	}
+	return user, nil
+}
+
+// isValidUserInfo checks that the time zone is known and the email can't break headers of messages.
+func isValidUserInfo(info internal.CustomUserInfo) bool {
+	if strings.ContainsAny(info.Email, "\r\n") || strings.ContainsAny(info.Name, "\r\n") {
+		return false
 	}
-	currentResponse := response{ID: id}
-	marshal, err := json.Marshal(currentResponse)
+	if info.TimeZone == "" {
+		return true
+	}
+	_, err := time.LoadLocation(info.TimeZone)
+	return err == nil
+}
+
+func (s *service) UpdateUser(ctx context.Context, request internal.UpdateUserRequest) (internal.User, error) {
+	s = s.scoped(ctx)
+	if !isValidUserInfo(request.Info) {
+		return internal.User{}, errors.New("wrong query")
+	}
+	before, _ := s.storage.GetUser(request.User)
+	user, err := s.storage.UpdateUser(request.User, request.Info)
 	if err != nil {
 		log.Error().Err(err).Stack()
-		return nil, err
+		if err.Error() == "unexisted user" {
+			return internal.User{}, err
+		}
+		return internal.User{}, errors.New("unable to update user")
 	}
-	return marshal, nil
+	s.record(ctx, request.User, internal.ActionUpdateUser, user.ID, before, user)
+	return user, nil
 }
 
-func (s *service) CreateEventWithUsers(body []byte) ([]byte, error) {
-	var curEvent internal.Event
-	err := json.Unmarshal(body, &curEvent)
+// DeactivateUser forbids inviting the user and removes it from events which aren't finished yet.
+func (s *service) DeactivateUser(ctx context.Context, request internal.UserRequest) error {
+	s = s.scoped(ctx)
+	before, _ := s.storage.GetUser(request.User)
+	err := s.storage.DeactivateUser(request.User, time.Now())
 	if err != nil {
 		log.Error().Err(err).Stack()
-		return nil, errors.New("wrong query")
+		if err.Error() == "unexisted user" {
+			return err
+		}
+		return errors.New("unable to deactivate user")
 	}
-	if curEvent.RepeatType < internal.MinRepeatType || internal.MaxRepeatType < curEvent.RepeatType {
-		return nil, errors.New("wrong repeat type")
+	after, _ := s.storage.GetUser(request.User)
+	s.record(ctx, "", internal.ActionDeactivateUser, request.User, before, after)
+	return nil
+}
+
+func (s *service) ListUsers(ctx context.Context, request internal.ListUsersRequest) (internal.UsersResponse, error) {
+	s = s.scoped(ctx)
+	limit := request.Limit
+	if limit == 0 {
+		limit = defaultPageSize
 	}
-	//TODO: add validation of begin earlier then end
+	if limit < 0 || limit > maxPageSize {
+		return internal.UsersResponse{}, errors.New("wrong query")
+	}
+	var offset int
+	if request.PageToken != "" {
+		var err error
+		offset, err = decodePageToken(request.PageToken)
+		if err != nil {
+			log.Error().Err(err).Stack()
+			return internal.UsersResponse{}, errors.New("wrong query")
+		}
+	}
+	users := s.storage.ListUsers(request.Query, request.IncludeDeactivated)
+	if offset > len(users) {
+		offset = len(users)
+	}
+	response := internal.UsersResponse{Users: users[offset:]}
+	if len(response.Users) > limit {
+		response.Users = response.Users[:limit]
+		response.NextPageToken = encodePageToken(offset + limit)
+	}
+	return response, nil
+}
+
+func (s *service) CreateGroup(ctx context.Context, request internal.CreateGroupRequest) (internal.IDResponse, error) {
+	s = s.scoped(ctx)
 	id := uuid.New().String()
-	curEvent.ID = id
-	err = s.storage.AddEvent(curEvent)
+	err := s.storage.AddGroup(internal.Group{ID: id, Info: request.Info, Members: request.Members})
 	if err != nil {
 		log.Error().Err(err).Stack()
-		if err.Error() == "event with this id already existed" {
-			return nil, err
+		if err.Error() == "unexisted member" {
+			return internal.IDResponse{}, err
 		}
-		return nil, errors.New("unable to create event")
+		return internal.IDResponse{}, errors.New("unable to create group")
 	}
-	type response struct {
-		ID string `json:"id"` //id
+	s.record(ctx, "", internal.ActionCreateGroup, id, nil, internal.Group{ID: id, Info: request.Info, Members: request.Members})
+	return internal.IDResponse{ID: id}, nil
+}
+
+func (s *service) GetGroup(ctx context.Context, request internal.GroupRequest) (internal.Group, error) {
+	s = s.scoped(ctx)
+	group, err := s.storage.GetGroup(request.Group)
+	if err != nil {
+		log.Error().Err(err).Stack()
+		if err.Error() == "unexisted group" {
+			return internal.Group{}, err
+		}
+		return internal.Group{}, errors.New("unable to get group")
 	}
-	currentResponse := response{ID: id}
-	marshal, err := json.Marshal(currentResponse)
+	return group, nil
+}
+
+func (s *service) UpdateGroup(ctx context.Context, request internal.UpdateGroupRequest) (internal.Group, error) {
+	s = s.scoped(ctx)
+	before, _ := s.storage.GetGroup(request.Group)
+	group := internal.Group{ID: request.Group, Info: request.Info, Members: request.Members}
+	err := s.storage.UpdateGroup(group)
 	if err != nil {
 		log.Error().Err(err).Stack()
-		return nil, err
+		if err.Error() == "unexisted group" || err.Error() == "unexisted member" || err.Error() == "group cycle" {
+			return internal.Group{}, err
+		}
+		return internal.Group{}, errors.New("unable to update group")
+	}
+	s.record(ctx, "", internal.ActionUpdateGroup, group.ID, before, group)
+	return group, nil
+}
+
+func (s *service) DeleteGroup(ctx context.Context, request internal.GroupRequest) error {
+	s = s.scoped(ctx)
+	before, _ := s.storage.GetGroup(request.Group)
+	err := s.storage.DeleteGroup(request.Group)
+	if err != nil {
+		log.Error().Err(err).Stack()
+		if err.Error() == "unexisted group" {
+			return err
+		}
+		return errors.New("unable to delete group")
+	}
+	s.record(ctx, "", internal.ActionDeleteGroup, request.Group, before, nil)
+	return nil
+}
+
+// colorPattern matches colors like #4285f4.
+var colorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// isValidVisibility checks that the visibility is known, empty means the default one.
+func isValidVisibility(visibility internal.Visibility) bool {
+	return visibility == "" || visibility == internal.Public || visibility == internal.Private
+}
+
+// isValidCalendarInfo checks that the calendar has a name, a known visibility and a color like #4285f4.
+func isValidCalendarInfo(info internal.CustomCalendarInfo) bool {
+	return info.Name != "" && isValidVisibility(info.Visibility) && (info.Color == "" || colorPattern.MatchString(info.Color))
+}
+
+// checkEditors returns an error if any of editors of the calendar isn't an existing user.
+func (s *service) checkEditors(info internal.CustomCalendarInfo) error {
+	for _, editor := range info.Editors {
+		if _, err := s.storage.GetUser(editor); err != nil {
+			log.Error().Err(err).Stack()
+			return errors.New("unexisted user")
+		}
 	}
-	return marshal, nil
+	return nil
 }
 
-func (s *service) GetEventDetails(body []byte) ([]byte, error) {
-	type request struct {
-		Event string `json:"event"` //event id
+// CreateCalendar creates a calendar of a user or of a group. Calendars of groups are readable by members
+// of the group and writable by editors.
+func (s *service) CreateCalendar(ctx context.Context, request internal.CreateCalendarRequest) (internal.IDResponse, error) {
+	s = s.scoped(ctx)
+	if !isValidCalendarInfo(request.Info) {
+		return internal.IDResponse{}, errors.New("wrong query")
+	}
+	if err := s.checkEditors(request.Info); err != nil {
+		return internal.IDResponse{}, err
 	}
-	var curRequest request
-	err := json.Unmarshal(body, &curRequest)
+	id := uuid.New().String()
+	err := s.storage.AddCalendar(internal.Calendar{ID: id, Owner: request.Owner, Info: request.Info})
 	if err != nil {
 		log.Error().Err(err).Stack()
-		return nil, errors.New("wrong query")
+		if err.Error() == "unexisted owner" {
+			return internal.IDResponse{}, err
+		}
+		return internal.IDResponse{}, errors.New("unable to create calendar")
 	}
-	myEvent, err := s.storage.GetEvent(curRequest.Event)
+	s.record(ctx, "", internal.ActionCreateCalendar, id, nil, internal.Calendar{ID: id, Owner: request.Owner, Info: request.Info})
+	return internal.IDResponse{ID: id}, nil
+}
+
+func (s *service) GetCalendar(ctx context.Context, request internal.CalendarRequest) (internal.Calendar, error) {
+	s = s.scoped(ctx)
+	calendar, err := s.storage.GetCalendar(request.Calendar)
 	if err != nil {
 		log.Error().Err(err).Stack()
-		if err.Error() == "unexisted event" {
+		if err.Error() == "unexisted calendar" {
+			return internal.Calendar{}, err
+		}
+		return internal.Calendar{}, errors.New("unable to get calendar")
+	}
+	return calendar, nil
+}
+
+func (s *service) UpdateCalendar(ctx context.Context, request internal.UpdateCalendarRequest) (internal.Calendar, error) {
+	s = s.scoped(ctx)
+	if !isValidCalendarInfo(request.Info) {
+		return internal.Calendar{}, errors.New("wrong query")
+	}
+	if err := s.checkEditors(request.Info); err != nil {
+		return internal.Calendar{}, err
+	}
+	before, _ := s.storage.GetCalendar(request.Calendar)
+	calendar, err := s.storage.UpdateCalendar(request.Calendar, request.Info)
+	if err != nil {
+		log.Error().Err(err).Stack()
+		if err.Error() == "unexisted calendar" {
+			return internal.Calendar{}, err
+		}
+		return internal.Calendar{}, errors.New("unable to update calendar")
+	}
+	s.record(ctx, "", internal.ActionUpdateCalendar, calendar.ID, before, calendar)
+	return calendar, nil
+}
+
+// DeleteCalendar removes the calendar, its events stay in default calendars of attendees.
+func (s *service) DeleteCalendar(ctx context.Context, request internal.CalendarRequest) error {
+	s = s.scoped(ctx)
+	before, _ := s.storage.GetCalendar(request.Calendar)
+	err := s.storage.DeleteCalendar(request.Calendar)
+	if err != nil {
+		log.Error().Err(err).Stack()
+		if err.Error() == "unexisted calendar" {
+			return err
+		}
+		return errors.New("unable to delete calendar")
+	}
+	s.record(ctx, "", internal.ActionDeleteCalendar, request.Calendar, before, nil)
+	return nil
+}
+
+func (s *service) ListCalendars(ctx context.Context, request internal.UserRequest) ([]internal.Calendar, error) {
+	s = s.scoped(ctx)
+	if _, err := s.storage.GetUser(request.User); err != nil {
+		log.Error().Err(err).Stack()
+		if err.Error() == "unexisted user" {
 			return nil, err
 		}
-		return nil, errors.New("unable to get event")
+		return nil, errors.New("unable to list calendars")
 	}
-	marshal, err := json.Marshal(myEvent)
+	owners := append([]string{request.User}, s.storage.MemberGroups(request.User)...)
+	return s.storage.ListCalendars(owners...), nil
+}
+
+func (s *service) ListGroupCalendars(ctx context.Context, request internal.GroupRequest) ([]internal.Calendar, error) {
+	s = s.scoped(ctx)
+	if _, err := s.storage.GetGroup(request.Group); err != nil {
+		log.Error().Err(err).Stack()
+		if err.Error() == "unexisted group" {
+			return nil, err
+		}
+		return nil, errors.New("unable to list calendars")
+	}
+	return s.storage.ListCalendars(request.Group), nil
+}
+
+// canRead reports whether the user owns the calendar, edits it or is a member of the group which owns it.
+func (s *service) canRead(calendar internal.Calendar, user string) bool {
+	return calendar.Owner == user || contains(calendar.Info.Editors, user) ||
+		contains(s.storage.MemberGroups(user), calendar.Owner)
+}
+
+// placeEvent checks that the calendar of the event belongs to its organizer or a participant,
+// or the organizer is an editor of the calendar, and sets the default visibility of the calendar.
+func (s *service) placeEvent(event *internal.Event) error {
+	if !isValidVisibility(event.Visibility) {
+		return errors.New("wrong query")
+	}
+	if event.Calendar == "" {
+		return nil
+	}
+	calendar, err := s.storage.GetCalendar(event.Calendar)
 	if err != nil {
 		log.Error().Err(err).Stack()
-		return nil, err
+		return err
+	}
+	if calendar.Owner != event.Organizer && !contains(event.Participants, calendar.Owner) &&
+		!contains(calendar.Info.Editors, event.Organizer) {
+		return errors.New("wrong calendar")
 	}
-	return marshal, nil
+	if event.Visibility == "" {
+		event.Visibility = calendar.Info.Visibility
+	}
+	return nil
+}
+
+// contains reports whether the id is in the list.
+func contains(ids []string, id string) bool {
+	for _, value := range ids {
+		if value == id {
+			return true
+		}
+	}
+	return false
 }
 
-func (s *service) AcceptInvitation(body []byte) error {
-	type request struct {
-		User  string `json:"user"`  //user id
-		Event string `json:"event"` //event id
+// expandGroups replaces groups in the lists of invitees by their active members and returns the group
+// through which every member was added. Users listed directly or by an earlier group are not repeated.
+func (s *service) expandGroups(lists ...[]string) ([][]string, map[string]string) {
+	members := map[string][]string{}
+	listed := map[string]bool{}
+	for _, list := range lists {
+		for _, id := range list {
+			users, err := s.storage.ExpandGroup(id)
+			if err != nil {
+				listed[id] = true
+				continue
+			}
+			members[id] = users
+		}
+	}
+	if len(members) == 0 {
+		return lists, nil
+	}
+	invitedVia := map[string]string{}
+	result := make([][]string, len(lists))
+	for i, list := range lists {
+		for _, id := range list {
+			users, ok := members[id]
+			if !ok {
+				result[i] = append(result[i], id)
+				continue
+			}
+			for _, user := range users {
+				if !listed[user] {
+					listed[user] = true
+					invitedVia[user] = id
+					result[i] = append(result[i], user)
+				}
+			}
+		}
 	}
-	var currentRequest request
-	err := json.Unmarshal(body, &currentRequest)
+	return result, invitedVia
+}
+
+// checkInvitees returns an error if any of existing users is deactivated, unknown users are checked by storage.
+func (s *service) checkInvitees(users ...[]string) error {
+	for _, group := range users {
+		for _, id := range group {
+			user, err := s.storage.GetUser(id)
+			if err == nil && user.Deactivated {
+				return errors.New("deactivated user")
+			}
+		}
+	}
+	return nil
+}
+
+func (s *service) CreateEventWithUsers(ctx context.Context, request internal.CreateEventRequest) (internal.CreateEventResponse, error) {
+	s = s.scoped(ctx)
+	curEvent := request.Event
+	invitees, invitedVia := s.expandGroups(curEvent.Participants, curEvent.Candidates)
+	curEvent.Participants, curEvent.Candidates, curEvent.InvitedVia = invitees[0], invitees[1], invitedVia
+	if curEvent.RepeatType < internal.MinRepeatType || internal.MaxRepeatType < curEvent.RepeatType {
+		return internal.CreateEventResponse{}, errors.New("wrong repeat type")
+	}
+	if !isValidReminders(curEvent, s.reminderLookahead) {
+		return internal.CreateEventResponse{}, errors.New("wrong query")
+	}
+	if err := s.checkInvitees(curEvent.Participants, curEvent.Candidates); err != nil {
+		return internal.CreateEventResponse{}, err
+	}
+	if err := s.placeEvent(&curEvent); err != nil {
+		return internal.CreateEventResponse{}, err
+	}
+	//TODO: add validation of begin earlier then end
+	id := uuid.New().String()
+	curEvent.ID = id
+	horizon := curEvent.Start.Add(conflictHorizon)
+	var err error
+	if request.Strict {
+		err = s.storage.AddEventStrict(curEvent, horizon)
+	} else {
+		err = s.storage.AddEvent(curEvent)
+	}
+	if err != nil {
+		log.Error().Err(err).Stack()
+		if err.Error() == "event with this id already existed" || err.Error() == "conflict with existing events" {
+			return internal.CreateEventResponse{}, err
+		}
+		return internal.CreateEventResponse{}, errors.New("unable to create event")
+	}
+	s.record(ctx, curEvent.Organizer, internal.ActionCreateEvent, id, nil, curEvent)
+	attendees := append(append([]string{}, curEvent.Participants...), curEvent.Candidates...)
+	conflicts, err := s.storage.FindConflicts(curEvent, attendees, horizon)
+	if err != nil {
+		log.Error().Err(err).Stack()
+	}
+	return internal.CreateEventResponse{ID: id, Warnings: conflicts}, nil
+}
+
+// isValidReminders checks that reminders are set for attendees of the event, before its start and not earlier
+// than lookahead, unless it is zero.
+func isValidReminders(event internal.Event, lookahead time.Duration) bool {
+	for _, reminder := range event.Reminders {
+		if reminder.Before < 0 || lookahead > 0 && reminder.Before > lookahead || !event.IsAttendee(reminder.User) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *service) GetEventDetails(ctx context.Context, request internal.EventRequest) (internal.Event, error) {
+	s = s.scoped(ctx)
+	myEvent, err := s.storage.GetEvent(request.Event)
 	if err != nil {
 		log.Error().Err(err).Stack()
+		if err.Error() == "unexisted event" {
+			return internal.Event{}, err
+		}
+		return internal.Event{}, errors.New("unable to get event")
+	}
+	return myEvent, nil
+}
+
+// checkVersion returns an error if the expected version of the changed event isn't told.
+func checkVersion(version int) error {
+	if version == 0 {
+		return errors.New("version required")
+	}
+	if version < internal.AnyVersion {
 		return errors.New("wrong query")
 	}
-	err = s.storage.Accept(currentRequest.User, currentRequest.Event)
+	return nil
+}
+
+func (s *service) CancelEvent(ctx context.Context, request internal.EventRequest) error {
+	s = s.scoped(ctx)
+	if err := checkVersion(request.Version); err != nil {
+		return err
+	}
+	before, _ := s.storage.GetEvent(request.Event)
+	err := s.storage.CancelEvent(request.Event, request.Version)
 	if err != nil {
 		log.Error().Err(err).Stack()
-		if err.Error() == "unexisted event" || err.Error() == "unexisted user in event" {
+		if err.Error() == "unexisted event" || err.Error() == "version mismatch" {
 			return err
 		}
-		return errors.New("unable to accept invitation")
+		return errors.New("unable to cancel event")
 	}
+	s.record(ctx, "", internal.ActionCancelEvent, request.Event, before, nil)
 	return nil
 }
 
-func (s *service) RejectInvitation(body []byte) error {
-	type request struct {
-		User  string `json:"user"`  //user id
-		Event string `json:"event"` //event id
+func (s *service) AcceptInvitation(ctx context.Context, request internal.InvitationRequest) (internal.WarningsResponse, error) {
+	s = s.scoped(ctx)
+	if err := checkVersion(request.Version); err != nil {
+		return internal.WarningsResponse{}, err
 	}
-	var currentRequest request
-	err := json.Unmarshal(body, &currentRequest)
+	myEvent, err := s.storage.GetEvent(request.Event)
 	if err != nil {
 		log.Error().Err(err).Stack()
-		return errors.New("wrong query")
+		if err.Error() == "unexisted event" {
+			return internal.WarningsResponse{}, err
+		}
+		return internal.WarningsResponse{}, errors.New("unable to accept invitation")
+	}
+	horizon := myEvent.Start.Add(conflictHorizon)
+	if request.Strict {
+		err = s.storage.AcceptStrict(request.User, request.Event, request.Version, horizon)
+	} else {
+		err = s.storage.Accept(request.User, request.Event, request.Version)
+	}
+	if err != nil {
+		log.Error().Err(err).Stack()
+		if err.Error() == "unexisted event" || err.Error() == "unexisted user in event" ||
+			err.Error() == "conflict with existing events" || err.Error() == "version mismatch" {
+			return internal.WarningsResponse{}, err
+		}
+		return internal.WarningsResponse{}, errors.New("unable to accept invitation")
 	}
-	err = s.storage.Reject(currentRequest.User, currentRequest.Event)
+	after, _ := s.storage.GetEvent(request.Event)
+	s.record(ctx, request.User, internal.ActionAcceptInvitation, request.Event, myEvent, after)
+	conflicts, err := s.storage.FindConflicts(myEvent, []string{request.User}, horizon)
 	if err != nil {
 		log.Error().Err(err).Stack()
-		if err.Error() == "unexisted event" || err.Error() == "unexisted user in event" {
+	}
+	return internal.WarningsResponse{Warnings: conflicts}, nil
+}
+
+func (s *service) RejectInvitation(ctx context.Context, request internal.InvitationRequest) error {
+	s = s.scoped(ctx)
+	if err := checkVersion(request.Version); err != nil {
+		return err
+	}
+	before, _ := s.storage.GetEvent(request.Event)
+	err := s.storage.Reject(request.User, request.Event, request.Version)
+	if err != nil {
+		log.Error().Err(err).Stack()
+		if err.Error() == "unexisted event" || err.Error() == "unexisted user in event" || err.Error() == "version mismatch" {
 			return err
 		}
 		return errors.New("unable to reject invitation")
 	}
+	after, _ := s.storage.GetEvent(request.Event)
+	s.record(ctx, request.User, internal.ActionRejectInvitation, request.Event, before, after)
 	return nil
 }
 
-func (s *service) GetEvents(body []byte) ([]byte, error) {
-	type request struct {
-		User string    `json:"user"` //user id
-		From time.Time `json:"from"` //from what moment find events
-		To   time.Time `json:"to"`   //to what moment find events
+// GetEvents returns occurrences of events of the user or of the calendar within the interval which match filters
+// of the request, sorted by start and id. Occurrences are split into pages of the limit, 50 if it isn't set.
+func (s *service) GetEvents(ctx context.Context, request internal.EventsRequest) (internal.EventsResponse, error) {
+	s = s.scoped(ctx)
+	if request.Limit < 0 || request.Limit > maxPageSize || !isValidEventsFilter(request) {
+		return internal.EventsResponse{}, errors.New("wrong query")
+	}
+	if request.Limit == 0 {
+		request.Limit = defaultPageSize
+	}
+	var afterStart time.Time
+	var afterID string
+	if request.PageToken != "" {
+		var err error
+		afterStart, afterID, err = decodeEventCursor(request.PageToken)
+		if err != nil {
+			log.Error().Err(err).Stack()
+			return internal.EventsResponse{}, errors.New("wrong query")
+		}
+	}
+	var res []internal.Event
+	var err error
+	if request.Calendar != "" {
+		res, err = s.getCalendarEvents(request)
+	} else {
+		res, err = s.getUserEvents(request)
 	}
-	var currentRequest request
-	err := json.Unmarshal(body, &currentRequest)
+	if err != nil {
+		return internal.EventsResponse{}, err
+	}
+	response := internal.EventsResponse{Events: []internal.Event{}}
+	for _, event := range res {
+		if matchesEventsFilter(event, request) &&
+			(request.PageToken == "" || isEventAfter(event, afterStart, afterID)) {
+			response.Events = append(response.Events, event)
+		}
+	}
+	sort.Slice(response.Events, func(i, j int) bool {
+		return isEventAfter(response.Events[j], response.Events[i].Start, response.Events[i].ID)
+	})
+	if len(response.Events) > request.Limit {
+		response.Events = response.Events[:request.Limit]
+		last := response.Events[request.Limit-1]
+		response.NextPageToken = encodeEventCursor(last.Start, last.ID)
+	}
+	return response, nil
+}
+
+// getUserEvents returns occurrences of events in which the user participates, is invited or both by the status.
+func (s *service) getUserEvents(request internal.EventsRequest) ([]internal.Event, error) {
+	var res []internal.Event
+	if request.Status != internal.NeedsAction {
+		events, err := s.storage.GetEvents(request.User, request.From, request.To)
+		if err != nil {
+			log.Error().Err(err).Stack()
+			if err.Error() == "unexisted user" {
+				return nil, err
+			}
+			return nil, errors.New("unable to find events")
+		}
+		res = append(res, events...)
+	}
+	if request.Status == internal.NeedsAction || request.Status == internal.AnyStatus {
+		invitations, err := s.storage.GetInvitations(request.User, request.From, request.To)
+		if err != nil {
+			log.Error().Err(err).Stack()
+			if err.Error() == "unexisted user" {
+				return nil, err
+			}
+			return nil, errors.New("unable to find events")
+		}
+		res = append(res, invitations...)
+	}
+	return res, nil
+}
+
+func isValidEventsFilter(request internal.EventsRequest) bool {
+	switch request.Status {
+	case "", internal.Accepted, internal.NeedsAction, internal.AnyStatus:
+	default:
+		return false
+	}
+	return request.RepeatType == nil ||
+		internal.MinRepeatType <= *request.RepeatType && *request.RepeatType <= internal.MaxRepeatType
+}
+
+// matchesEventsFilter checks the event against filters of the request, the text is matched case-insensitively.
+func matchesEventsFilter(event internal.Event, request internal.EventsRequest) bool {
+	switch request.Status {
+	case internal.Accepted:
+		if !contains(event.Participants, request.User) {
+			return false
+		}
+	case internal.NeedsAction:
+		if !contains(event.Candidates, request.User) {
+			return false
+		}
+	}
+	if request.RepeatType != nil && event.RepeatType != *request.RepeatType {
+		return false
+	}
+	if request.Organized && event.Organizer != request.User {
+		return false
+	}
+	query := strings.ToLower(request.Query)
+	return strings.Contains(strings.ToLower(event.Info.Name), query) ||
+		strings.Contains(strings.ToLower(event.Info.Description), query)
+}
+
+// isEventAfter reports whether the occurrence goes after the position in the order of start and id.
+func isEventAfter(event internal.Event, start time.Time, id string) bool {
+	if !event.Start.Equal(start) {
+		return event.Start.After(start)
+	}
+	return event.ID > id
+}
+
+// getCalendarEvents returns events of the calendar if the user can read it. Details of private events
+// are hidden from members who neither edit the calendar nor are invited.
+func (s *service) getCalendarEvents(request internal.EventsRequest) ([]internal.Event, error) {
+	calendar, err := s.storage.GetCalendar(request.Calendar)
 	if err != nil {
 		log.Error().Err(err).Stack()
-		return nil, errors.New("wrong query")
+		return nil, err
+	}
+	if !s.canRead(calendar, request.User) {
+		return nil, errors.New("wrong calendar")
 	}
-	res, err := s.storage.GetEvents(currentRequest.User, currentRequest.From, currentRequest.To)
+	res, err := s.storage.GetCalendarEvents(request.Calendar, request.From, request.To)
 	if err != nil {
 		log.Error().Err(err).Stack()
-		if err.Error() == "unexisted user" {
+		if err.Error() == "unexisted calendar" {
 			return nil, err
 		}
 		return nil, errors.New("unable to find events")
 	}
-	marshal, err := json.Marshal(res)
+	for i, event := range res {
+		if event.Visibility == internal.Private && calendar.Owner != request.User &&
+			!contains(calendar.Info.Editors, request.User) && !event.IsAttendee(request.User) {
+			res[i].Info = internal.CustomEventInfo{}
+			res[i].Reminders = nil
+		}
+	}
+	return res, nil
+}
+
+func (s *service) FindSlot(ctx context.Context, request internal.FindSlotRequest) (internal.FindSlotResponse, error) {
+	s = s.scoped(ctx)
+	from := request.From
+	if from.IsZero() {
+		from = time.Now()
+	}
+	if request.Granularity < 0 || request.BufferBefore < 0 || request.BufferAfter < 0 {
+		return internal.FindSlotResponse{}, errors.New("wrong query")
+	}
+	if request.Granularity == 0 {
+		request.Granularity = settings(ctx).Granularity
+	}
+	users, _ := s.expandGroups(request.Users)
+	begin, err := s.storage.FindFreeSlot(users[0], from, request.Duration, request.ValidUntil, request.SlotOptions)
 	if err != nil {
 		log.Error().Err(err).Stack()
-		return nil, err
+		if err.Error() == "unexisted user" {
+			return internal.FindSlotResponse{}, err
+		} else if err.Error() == "no such slot" {
+			return internal.FindSlotResponse{}, err
+		}
+		return internal.FindSlotResponse{}, errors.New("unable to find space")
+	}
+	return internal.FindSlotResponse{Begin: begin}, nil
+}
+
+func (s *service) BookSlot(ctx context.Context, request internal.BookSlotRequest) (internal.BookSlotResponse, error) {
+	s = s.scoped(ctx)
+	if len(request.Users) == 0 || request.Duration <= 0 ||
+		request.Granularity < 0 || request.BufferBefore < 0 || request.BufferAfter < 0 {
+		return internal.BookSlotResponse{}, errors.New("wrong query")
+	}
+	if request.RepeatType < internal.MinRepeatType || internal.MaxRepeatType < request.RepeatType {
+		return internal.BookSlotResponse{}, errors.New("wrong repeat type")
+	}
+	if request.Granularity == 0 {
+		request.Granularity = settings(ctx).Granularity
+	}
+	invitees, invitedVia := s.expandGroups(request.Users, request.Candidates)
+	curEvent := internal.Event{
+		ID:           uuid.New().String(),
+		Organizer:    request.Organizer,
+		Candidates:   invitees[1],
+		Participants: invitees[0],
+		RepeatType:   request.RepeatType,
+		Info:         request.Info,
+		Reminders:    request.Reminders,
+		InvitedVia:   invitedVia,
+		Calendar:     request.Calendar,
+		Visibility:   request.Visibility,
+	}
+	if !isValidReminders(curEvent, s.reminderLookahead) {
+		return internal.BookSlotResponse{}, errors.New("wrong query")
+	}
+	if err := s.checkInvitees(invitees...); err != nil {
+		return internal.BookSlotResponse{}, err
+	}
+	if err := s.placeEvent(&curEvent); err != nil {
+		return internal.BookSlotResponse{}, err
+	}
+	from := request.From
+	if from.IsZero() {
+		from = time.Now()
+	}
+	curEvent, err := s.storage.BookFreeSlot(curEvent, from, request.Duration, request.ValidUntil, request.SlotOptions)
+	if err != nil {
+		log.Error().Err(err).Stack()
+		if err.Error() == "unexisted user" || err.Error() == "no such slot" {
+			return internal.BookSlotResponse{}, err
+		}
+		return internal.BookSlotResponse{}, errors.New("unable to book slot")
+	}
+	s.record(ctx, curEvent.Organizer, internal.ActionCreateEvent, curEvent.ID, nil, curEvent)
+	return internal.BookSlotResponse{ID: curEvent.ID, Start: curEvent.Start, Finish: curEvent.Finish}, nil
+}
+
+func (s *service) CreateWebhook(ctx context.Context, subscription webhook.Subscription) (internal.CreateWebhookResponse, error) {
+	s = s.scoped(ctx)
+	if subscription.URL == "" {
+		return internal.CreateWebhookResponse{}, errors.New("wrong query")
+	}
+	subscription, err := s.webhooks.Subscribe(subscription)
+	if err != nil {
+		log.Error().Err(err).Stack()
+		return internal.CreateWebhookResponse{}, errors.New("unable to create webhook")
+	}
+	logged := subscription
+	logged.Secret = ""
+	s.record(ctx, subscription.User, internal.ActionCreateWebhook, subscription.ID, nil, logged)
+	return internal.CreateWebhookResponse{ID: subscription.ID, Secret: subscription.Secret}, nil
+}
+
+func (s *service) DeleteWebhook(ctx context.Context, request internal.DeleteWebhookRequest) error {
+	s = s.scoped(ctx)
+	err := s.webhooks.Unsubscribe(request.ID)
+	if err != nil {
+		log.Error().Err(err).Stack()
+		return err
+	}
+	s.record(ctx, "", internal.ActionDeleteWebhook, request.ID, nil, nil)
+	return nil
+}
+
+func (s *service) GetWebhookDeliveries(ctx context.Context, request internal.DeliveriesRequest) ([]webhook.Delivery, error) {
+	s = s.scoped(ctx)
+	if request.DeadLetters {
+		return s.webhooks.DeadLetters(request.Subscription), nil
 	}
-	return marshal, nil
+	return s.webhooks.Deliveries(request.Subscription), nil
 }
 
-func (s *service) FindSlot(body []byte) ([]byte, error) {
-	type request struct {
-		Users      []string      `json:"users"`       //users id
-		Duration   time.Duration `json:"duration"`    //duration of event
-		ValidUntil time.Time     `json:"valid_until"` //last interesting time
+// ProcessITIP applies the iCalendar REPLY or COUNTER message to the event. Every answer of the message is checked
+// against the current state of the event before any of them is applied: attendees have to be invited, replies
+// have to accept or decline. Answers which match the current status, like a resent acceptance, change nothing.
+func (s *service) ProcessITIP(ctx context.Context, calendar string) error {
+	s = s.scoped(ctx)
+	message, err := imip.Parse(calendar)
+	if err != nil {
+		log.Error().Err(err).Stack()
+		return errors.New("wrong query")
+	}
+	if message.Method != imip.Reply && message.Method != imip.Counter || len(message.Attendees) == 0 {
+		return errors.New("wrong query")
 	}
-	var currentRequest request
-	//TODO: Add custom unmarshall of duration
-	err := json.Unmarshal(body, &currentRequest)
+	before, err := s.storage.GetEvent(message.UID)
 	if err != nil {
 		log.Error().Err(err).Stack()
+		if err.Error() == "unexisted event" {
+			return err
+		}
+		return errors.New("unable to process reply")
+	}
+	type answer struct {
+		user   string
+		action internal.AuditAction
+	}
+	var answers []answer
+	for _, attendee := range message.Attendees {
+		user, err := s.storage.FindUserByEmail(attendee.Email)
+		if err != nil {
+			log.Error().Err(err).Stack()
+			return err
+		}
+		switch {
+		case message.Method == imip.Counter:
+			if !before.IsAttendee(user.ID) {
+				return errors.New("unexisted user in event")
+			}
+			answers = append(answers, answer{user: user.ID, action: internal.ActionProposeTime})
+		case attendee.PartStat == imip.Accepted:
+			if contains(before.Participants, user.ID) {
+				continue
+			}
+			if !contains(before.Candidates, user.ID) {
+				return errors.New("unexisted user in event")
+			}
+			answers = append(answers, answer{user: user.ID, action: internal.ActionAcceptInvitation})
+		case attendee.PartStat == imip.Declined:
+			if before.IsAttendee(user.ID) {
+				answers = append(answers, answer{user: user.ID, action: internal.ActionRejectInvitation})
+				continue
+			}
+			//a resent decline of the user who already declined
+			if !s.wasAttendee(message.UID, user.ID) {
+				return errors.New("unexisted user in event")
+			}
+		default:
+			return errors.New("wrong query")
+		}
+	}
+	for _, curAnswer := range answers {
+		var proposal internal.CounterProposal
+		switch curAnswer.action {
+		case internal.ActionProposeTime:
+			proposal = internal.CounterProposal{
+				ID:      uuid.New().String(),
+				Event:   message.UID,
+				User:    curAnswer.user,
+				Start:   message.Start,
+				Finish:  message.Finish,
+				Comment: message.Comment,
+				Time:    time.Now(),
+			}
+			err = s.storage.AddCounterProposal(proposal)
+		case internal.ActionAcceptInvitation:
+			err = s.storage.Accept(curAnswer.user, message.UID, internal.AnyVersion)
+		case internal.ActionRejectInvitation:
+			err = s.storage.Reject(curAnswer.user, message.UID, internal.AnyVersion)
+		}
+		if err != nil {
+			log.Error().Err(err).Stack()
+			if err.Error() == "unexisted event" || err.Error() == "unexisted user in event" {
+				return err
+			}
+			return errors.New("unable to process reply")
+		}
+		if curAnswer.action == internal.ActionProposeTime {
+			s.record(ctx, curAnswer.user, curAnswer.action, message.UID, nil, proposal)
+			continue
+		}
+		after, _ := s.storage.GetEvent(message.UID)
+		s.record(ctx, curAnswer.user, curAnswer.action, message.UID, before, after)
+		before = after
+	}
+	return nil
+}
+
+// wasAttendee reports whether the user was invited to the event in any of its kept revisions.
+func (s *service) wasAttendee(event string, user string) bool {
+	revisions, err := s.storage.GetEventRevisions(event)
+	if err != nil {
+		return false
+	}
+	for _, revision := range revisions {
+		if revision.Event.IsAttendee(user) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetAuditLog returns changes made by or of the user and of the event within the interval in order of changes.
+func (s *service) GetAuditLog(ctx context.Context, request internal.AuditRequest) ([]internal.AuditRecord, error) {
+	s = s.scoped(ctx)
+	if !request.From.IsZero() && !request.To.IsZero() && request.To.Before(request.From) {
 		return nil, errors.New("wrong query")
 	}
-	begin, err := s.storage.FindFreeSlot(currentRequest.Users, time.Now(), currentRequest.Duration, currentRequest.ValidUntil)
+	return s.storage.GetAuditRecords(request.User, request.Event, request.From, request.To), nil
+}
+
+// GetEventHistory returns revisions of the event in order of changes with fields changed by each of them.
+func (s *service) GetEventHistory(ctx context.Context, request internal.EventRequest) ([]internal.EventRevision, error) {
+	s = s.scoped(ctx)
+	revisions, err := s.storage.GetEventRevisions(request.Event)
 	if err != nil {
 		log.Error().Err(err).Stack()
-		if err.Error() == "unexisted user" {
+		if err.Error() == "unexisted event" {
 			return nil, err
-		} else if err.Error() == "no such slot" {
+		}
+		return nil, errors.New("unable to get event history")
+	}
+	var previous interface{}
+	for idx := range revisions {
+		revisions[idx].Changes = audit.Diff(previous, revisions[idx].Event)
+		previous = revisions[idx].Event
+	}
+	return revisions, nil
+}
+
+// RestoreEventRevision makes the event as it was in the revision, the restored state becomes its new revision.
+func (s *service) RestoreEventRevision(ctx context.Context, request internal.RestoreEventRequest) (internal.Event, error) {
+	s = s.scoped(ctx)
+	if err := checkVersion(request.Version); err != nil {
+		return internal.Event{}, err
+	}
+	revisions, err := s.storage.GetEventRevisions(request.Event)
+	if err != nil {
+		log.Error().Err(err).Stack()
+		if err.Error() == "unexisted event" {
+			return internal.Event{}, err
+		}
+		return internal.Event{}, errors.New("unable to restore event")
+	}
+	for _, revision := range revisions {
+		if revision.Number != request.Revision {
+			continue
+		}
+		if err := s.checkInvitees(revision.Event.Participants, revision.Event.Candidates); err != nil {
+			return internal.Event{}, err
+		}
+	}
+	var before interface{}
+	if current, err := s.storage.GetEvent(request.Event); err == nil {
+		before = current
+	}
+	event, err := s.storage.RestoreEvent(request.Event, request.Revision, request.Version)
+	if err != nil {
+		log.Error().Err(err).Stack()
+		if err.Error() == "unexisted event" || err.Error() == "unexisted revision" || err.Error() == "wrong revision" ||
+			err.Error() == "version mismatch" {
+			return internal.Event{}, err
+		}
+		return internal.Event{}, errors.New("unable to restore event")
+	}
+	s.record(ctx, "", internal.ActionRestoreEvent, request.Event, before, event)
+	return event, nil
+}
+
+func (s *service) GetCounterProposals(ctx context.Context, request internal.EventRequest) ([]internal.CounterProposal, error) {
+	s = s.scoped(ctx)
+	proposals, err := s.storage.GetCounterProposals(request.Event)
+	if err != nil {
+		log.Error().Err(err).Stack()
+		if err.Error() == "unexisted event" {
 			return nil, err
 		}
-		return nil, errors.New("unable to find space")
+		return nil, errors.New("unable to get proposals")
 	}
-	type response struct {
-		From time.Time `json:"begin"` //begin of space
+	return proposals, nil
+}
+
+// SubscribeChanges returns stream of the user's changes published after lastID and function to stop it.
+func (s *service) SubscribeChanges(ctx context.Context, user string, lastID uint64) (<-chan pubsub.Message, func(), error) {
+	s = s.scoped(ctx)
+	_, err := s.storage.GetUser(user)
+	if err != nil {
+		log.Error().Err(err).Stack()
+		return nil, nil, err
 	}
-	currentResponse := response{From: begin}
-	marshal, err := json.Marshal(currentResponse)
+	messages, cancel := s.changes.Subscribe(user, lastID)
+	return messages, cancel, nil
+}
+
+func (s *service) Sync(ctx context.Context, request internal.SyncRequest) (internal.SyncResponse, error) {
+	s = s.scoped(ctx)
+	var since uint64
+	if request.SyncToken != "" {
+		var err error
+		since, err = decodeSyncToken(request.SyncToken)
+		if err != nil {
+			log.Error().Err(err).Stack()
+			return internal.SyncResponse{}, errors.New("wrong query")
+		}
+	}
+	changes, err := s.storage.GetChanges(request.User, since)
 	if err != nil {
 		log.Error().Err(err).Stack()
-		return nil, err
+		if err.Error() == "unexisted user" || err.Error() == "sync token expired" {
+			return internal.SyncResponse{}, err
+		}
+		return internal.SyncResponse{}, errors.New("unable to sync")
 	}
-	return marshal, nil
+	return internal.SyncResponse{SyncChanges: changes, SyncToken: encodeSyncToken(changes.Sequence)}, nil
+}
+
+func encodeSyncToken(sequence uint64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte("v1:" + strconv.FormatUint(sequence, 10)))
 }
 
-//TODO: Add tests.
+func decodeSyncToken(token string) (uint64, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return 0, err
+	}
+	if len(decoded) < len("v1:") || string(decoded[:len("v1:")]) != "v1:" {
+		return 0, errors.New("unknown sync token version")
+	}
+	return strconv.ParseUint(string(decoded[len("v1:"):]), 10, 64)
+}
+
+// encodeEventCursor returns the token of the page of occurrences after the occurrence with the start and id,
+// so that pages don't shift when events are added or removed between requests.
+func encodeEventCursor(start time.Time, id string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte("c1:" + strconv.FormatInt(start.UnixNano(), 10) + ":" + id))
+}
+
+func decodeEventCursor(token string) (time.Time, string, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+	if len(decoded) < len("c1:") || string(decoded[:len("c1:")]) != "c1:" {
+		return time.Time{}, "", errors.New("unknown page token version")
+	}
+	parts := strings.SplitN(string(decoded[len("c1:"):]), ":", 2)
+	if len(parts) != 2 {
+		return time.Time{}, "", errors.New("wrong page token")
+	}
+	nanos, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+	return time.Unix(0, nanos), parts[1], nil
+}
+
+// encodePageToken hides the offset of the page so that it can be changed to a cursor later.
+func encodePageToken(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte("p1:" + strconv.Itoa(offset)))
+}
+
+func decodePageToken(token string) (int, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return 0, err
+	}
+	if len(decoded) < len("p1:") || string(decoded[:len("p1:")]) != "p1:" {
+		return 0, errors.New("unknown page token version")
+	}
+	offset, err := strconv.Atoi(string(decoded[len("p1:"):]))
+	if err == nil && offset < 0 {
+		return 0, errors.New("negative page offset")
+	}
+	return offset, err
+}
@@ -0,0 +1,754 @@
+package service
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/nivanov045/calendar/internal"
+	"github.com/nivanov045/calendar/internal/audit"
+	"github.com/nivanov045/calendar/internal/imip"
+	"github.com/nivanov045/calendar/internal/storage"
+	"github.com/nivanov045/calendar/internal/tenant"
+)
+
+func Test_service_CreateEventWithUsers(t *testing.T) {
+	s := New(storage.New(), nil, nil, WithReminderLookahead(24*time.Hour))
+	ctx := context.Background()
+	user, err := s.CreateUser(ctx, internal.CreateUserRequest{Info: internal.CustomUserInfo{Name: "user"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2022, 9, 5, 10, 0, 0, 0, time.UTC)
+	event := internal.Event{Participants: []string{user.ID}, Start: start, Finish: start.Add(time.Hour)}
+
+	tests := []struct {
+		name     string
+		request  internal.CreateEventRequest
+		wantErr  string
+		warnings int
+	}{
+		{
+			name:    "Wrong repeat type",
+			request: internal.CreateEventRequest{Event: withRepeat(event, internal.MaxRepeatType+1)},
+			wantErr: "wrong repeat type",
+		},
+		{
+			name: "Reminder of not attendee",
+			request: internal.CreateEventRequest{Event: withReminders(event, internal.Reminder{
+				User: "someone", Before: time.Minute,
+			})},
+			wantErr: "wrong query",
+		},
+		{
+			name: "Reminder earlier than lookahead",
+			request: internal.CreateEventRequest{Event: withReminders(event, internal.Reminder{
+				User: user.ID, Before: 48 * time.Hour,
+			})},
+			wantErr: "wrong query",
+		},
+		{
+			name:    "Free user",
+			request: internal.CreateEventRequest{Event: event},
+		},
+		{
+			name:    "Busy user in strict mode",
+			request: internal.CreateEventRequest{Event: event, Strict: true},
+			wantErr: "conflict with existing events",
+		},
+		{
+			name:     "Busy user",
+			request:  internal.CreateEventRequest{Event: event},
+			warnings: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.CreateEventWithUsers(ctx, tt.request)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("CreateEventWithUsers() error = %v, want %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.ID == "" || len(got.Warnings) != tt.warnings {
+				t.Errorf("CreateEventWithUsers() = %+v, want %d warnings", got, tt.warnings)
+			}
+		})
+	}
+}
+
+func withRepeat(event internal.Event, repeatType internal.RepeatType) internal.Event {
+	event.RepeatType = repeatType
+	return event
+}
+
+func withReminders(event internal.Event, reminders ...internal.Reminder) internal.Event {
+	event.Reminders = reminders
+	return event
+}
+
+func Test_service_Sync(t *testing.T) {
+	s := New(storage.New(), nil, nil)
+	ctx := context.Background()
+	user, err := s.CreateUser(ctx, internal.CreateUserRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	full, err := s.Sync(ctx, internal.SyncRequest{User: user.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2022, 9, 5, 10, 0, 0, 0, time.UTC)
+	created, err := s.CreateEventWithUsers(ctx, internal.CreateEventRequest{Event: internal.Event{
+		Participants: []string{user.ID}, Start: start, Finish: start.Add(time.Hour),
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	delta, err := s.Sync(ctx, internal.SyncRequest{User: user.ID, SyncToken: full.SyncToken})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(delta.Created) != 1 || delta.Created[0].ID != created.ID || delta.SyncToken == full.SyncToken {
+		t.Errorf("Sync() = %+v, want the created event and a new token", delta)
+	}
+	if _, err := s.Sync(ctx, internal.SyncRequest{User: user.ID, SyncToken: "not a token"}); err == nil || err.Error() != "wrong query" {
+		t.Errorf("Sync() with wrong token error = %v, want wrong query", err)
+	}
+}
+
+func Test_service_CreateUser(t *testing.T) {
+	s := New(storage.New(), nil, nil)
+	_, err := s.CreateUser(context.Background(), internal.CreateUserRequest{Info: internal.CustomUserInfo{
+		Name: "Eve", Email: "eve@example.com\r\nBcc: all@example.com",
+	}})
+	if err == nil || err.Error() != "wrong query" {
+		t.Errorf("CreateUser() with line break in email error = %v, want wrong query", err)
+	}
+	_, err = s.CreateUser(context.Background(), internal.CreateUserRequest{Info: internal.CustomUserInfo{
+		Name: "Eve\r\nMETHOD:CANCEL", Email: "eve@example.com",
+	}})
+	if err == nil || err.Error() != "wrong query" {
+		t.Errorf("CreateUser() with line break in name error = %v, want wrong query", err)
+	}
+}
+
+func Test_service_ListUsers(t *testing.T) {
+	s := New(storage.New(), nil, nil)
+	ctx := context.Background()
+	var ids []string
+	for _, name := range []string{"Carol", "Alice", "Bob"} {
+		user, err := s.CreateUser(ctx, internal.CreateUserRequest{Info: internal.CustomUserInfo{Name: name}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, user.ID)
+	}
+	if err := s.DeactivateUser(ctx, internal.UserRequest{User: ids[0]}); err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	request := internal.ListUsersRequest{Limit: 1, IncludeDeactivated: true}
+	for {
+		page, err := s.ListUsers(ctx, request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, user := range page.Users {
+			names = append(names, user.Info.Name)
+		}
+		if page.NextPageToken == "" {
+			break
+		}
+		request.PageToken = page.NextPageToken
+	}
+	if want := []string{"Alice", "Bob", "Carol"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("ListUsers() = %v, want %v", names, want)
+	}
+	if _, err := s.ListUsers(ctx, internal.ListUsersRequest{PageToken: "not a token"}); err == nil || err.Error() != "wrong query" {
+		t.Errorf("ListUsers() with wrong token error = %v, want wrong query", err)
+	}
+
+	start := time.Date(2022, 9, 5, 10, 0, 0, 0, time.UTC)
+	_, err := s.CreateEventWithUsers(ctx, internal.CreateEventRequest{Event: internal.Event{
+		Participants: []string{ids[1], ids[0]}, Start: start, Finish: start.Add(time.Hour),
+	}})
+	if err == nil || err.Error() != "deactivated user" {
+		t.Errorf("CreateEventWithUsers() with deactivated user error = %v, want deactivated user", err)
+	}
+}
+
+func Test_service_Groups(t *testing.T) {
+	s := New(storage.New(), nil, nil)
+	ctx := context.Background()
+	var ids []string
+	for _, name := range []string{"organizer", "developer", "tester"} {
+		user, err := s.CreateUser(ctx, internal.CreateUserRequest{Info: internal.CustomUserInfo{Name: name}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, user.ID)
+	}
+	qa, err := s.CreateGroup(ctx, internal.CreateGroupRequest{Members: []string{ids[2]}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	team, err := s.CreateGroup(ctx, internal.CreateGroupRequest{Members: []string{ids[0], ids[1], qa.ID}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2022, 9, 5, 10, 0, 0, 0, time.UTC)
+	created, err := s.CreateEventWithUsers(ctx, internal.CreateEventRequest{Event: internal.Event{
+		Participants: []string{ids[0]}, Candidates: []string{team.ID}, Start: start, Finish: start.Add(time.Hour),
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	event, err := s.GetEventDetails(ctx, internal.EventRequest{Event: created.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantVia := map[string]string{ids[1]: team.ID, ids[2]: team.ID}
+	if !reflect.DeepEqual(event.Candidates, ids[1:]) || !reflect.DeepEqual(event.InvitedVia, wantVia) {
+		t.Errorf("CreateEventWithUsers() candidates = %v via %v, want %v via %v", event.Candidates, event.InvitedVia, ids[1:], wantVia)
+	}
+
+	slot, err := s.FindSlot(ctx, internal.FindSlotRequest{
+		Users: []string{qa.ID}, Duration: time.Hour, From: start, ValidUntil: start.Add(24 * time.Hour),
+	})
+	if err != nil || !slot.Begin.Equal(start) {
+		t.Errorf("FindSlot() = %v, %v, want %v", slot.Begin, err, start)
+	}
+	if _, err := s.AcceptInvitation(ctx, internal.InvitationRequest{User: ids[2], Event: created.ID, Version: internal.AnyVersion}); err != nil {
+		t.Fatal(err)
+	}
+	slot, err = s.FindSlot(ctx, internal.FindSlotRequest{
+		Users: []string{qa.ID}, Duration: time.Hour, From: start, ValidUntil: start.Add(24 * time.Hour),
+	})
+	if err != nil || !slot.Begin.Equal(start.Add(time.Hour)) {
+		t.Errorf("FindSlot() = %v, %v, want %v", slot.Begin, err, start.Add(time.Hour))
+	}
+}
+
+func Test_service_Calendars(t *testing.T) {
+	s := New(storage.New(), nil, nil)
+	ctx := context.Background()
+	var ids []string
+	for _, name := range []string{"owner", "guest"} {
+		user, err := s.CreateUser(ctx, internal.CreateUserRequest{Info: internal.CustomUserInfo{Name: name}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, user.ID)
+	}
+	if _, err := s.CreateCalendar(ctx, internal.CreateCalendarRequest{
+		Owner: ids[0], Info: internal.CustomCalendarInfo{Name: "work", Color: "blue"},
+	}); err == nil || err.Error() != "wrong query" {
+		t.Errorf("CreateCalendar() with wrong color error = %v, want wrong query", err)
+	}
+	work, err := s.CreateCalendar(ctx, internal.CreateCalendarRequest{
+		Owner: ids[0], Info: internal.CustomCalendarInfo{Name: "work", Color: "#4285f4", Visibility: internal.Private},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2022, 9, 5, 10, 0, 0, 0, time.UTC)
+	event := internal.Event{Participants: []string{ids[1]}, Start: start, Finish: start.Add(time.Hour), Calendar: work.ID}
+	if _, err := s.CreateEventWithUsers(ctx, internal.CreateEventRequest{Event: event}); err == nil || err.Error() != "wrong calendar" {
+		t.Errorf("CreateEventWithUsers() in calendar of not attendee error = %v, want wrong calendar", err)
+	}
+	event.Organizer = ids[0]
+	created, err := s.CreateEventWithUsers(ctx, internal.CreateEventRequest{Event: event})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.GetEventDetails(ctx, internal.EventRequest{Event: created.ID}); err != nil || got.Visibility != internal.Private {
+		t.Errorf("GetEventDetails() = %+v, %v, want private event", got, err)
+	}
+	if _, err := s.CreateEventWithUsers(ctx, internal.CreateEventRequest{Event: internal.Event{
+		Participants: []string{ids[0]}, Start: start.Add(time.Hour), Finish: start.Add(2 * time.Hour),
+	}}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		request internal.EventsRequest
+		want    int
+		wantErr string
+	}{
+		{name: "All events of the user", request: internal.EventsRequest{User: ids[0]}, want: 1},
+		{name: "Events of the calendar", request: internal.EventsRequest{User: ids[0], Calendar: work.ID}, want: 1},
+		{name: "Calendar of another user", request: internal.EventsRequest{User: ids[1], Calendar: work.ID}, wantErr: "wrong calendar"},
+		{name: "Unexisted calendar", request: internal.EventsRequest{User: ids[0], Calendar: "unknown"}, wantErr: "unexisted calendar"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.request.From, tt.request.To = start, start.Add(24*time.Hour)
+			got, err := s.GetEvents(ctx, tt.request)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("GetEvents() error = %v, want %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || len(got.Events) != tt.want {
+				t.Errorf("GetEvents() = %v, %v, want %d events", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func Test_service_BookSlot(t *testing.T) {
+	s := New(storage.New(), nil, nil, WithReminderLookahead(24*time.Hour))
+	ctx := context.Background()
+	var ids []string
+	for _, name := range []string{"olga", "ivan"} {
+		user, err := s.CreateUser(ctx, internal.CreateUserRequest{Info: internal.CustomUserInfo{Name: name}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, user.ID)
+	}
+	work, err := s.CreateCalendar(ctx, internal.CreateCalendarRequest{
+		Owner: ids[0], Info: internal.CustomCalendarInfo{Name: "work", Visibility: internal.Private},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	from := time.Date(2022, 9, 5, 10, 0, 0, 0, time.UTC)
+	request := internal.BookSlotRequest{
+		Users: []string{ids[0]}, Candidates: []string{ids[1]}, Duration: time.Hour, From: from, ValidUntil: from.AddDate(0, 0, 7),
+		Organizer: ids[0], Calendar: work.ID, Reminders: []internal.Reminder{{User: ids[1], Before: 48 * time.Hour}},
+	}
+	if _, err := s.BookSlot(ctx, request); err == nil || err.Error() != "wrong query" {
+		t.Errorf("BookSlot() with reminder earlier than lookahead error = %v, want wrong query", err)
+	}
+	request.Reminders[0].Before = time.Hour
+	request.Organizer, request.Users = ids[1], []string{ids[1]}
+	if _, err := s.BookSlot(ctx, request); err == nil || err.Error() != "wrong calendar" {
+		t.Errorf("BookSlot() in calendar of other user error = %v, want wrong calendar", err)
+	}
+	request.Organizer, request.Users, request.Candidates = ids[0], []string{ids[0]}, []string{ids[1]}
+	booked, err := s.BookSlot(ctx, request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.GetEventDetails(ctx, internal.EventRequest{Event: booked.ID})
+	if err != nil || got.Organizer != ids[0] || got.Calendar != work.ID || got.Visibility != internal.Private ||
+		!reflect.DeepEqual(got.Reminders, request.Reminders) {
+		t.Errorf("GetEventDetails() of booked event = %+v, %v, want organizer, calendar, visibility and reminders", got, err)
+	}
+}
+
+func Test_service_TeamCalendars(t *testing.T) {
+	s := New(storage.New(), nil, nil)
+	ctx := context.Background()
+	var ids []string
+	for _, name := range []string{"lead", "member", "guest"} {
+		user, err := s.CreateUser(ctx, internal.CreateUserRequest{Info: internal.CustomUserInfo{Name: name}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, user.ID)
+	}
+	team, err := s.CreateGroup(ctx, internal.CreateGroupRequest{Members: []string{ids[0], ids[1]}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.CreateCalendar(ctx, internal.CreateCalendarRequest{
+		Owner: team.ID, Info: internal.CustomCalendarInfo{Name: "releases", Editors: []string{"unknown"}},
+	}); err == nil || err.Error() != "unexisted user" {
+		t.Errorf("CreateCalendar() with unexisted editor error = %v, want unexisted user", err)
+	}
+	releases, err := s.CreateCalendar(ctx, internal.CreateCalendarRequest{
+		Owner: team.ID, Info: internal.CustomCalendarInfo{Name: "releases", Editors: []string{ids[0]}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if records, _ := s.GetAuditLog(ctx, internal.AuditRequest{User: team.ID}); len(records) != 1 || records[0].Action != internal.ActionCreateGroup {
+		t.Errorf("GetAuditLog() of the group = %v, want only its creation, the owner isn't an actor", records)
+	}
+
+	start := time.Date(2022, 9, 5, 10, 0, 0, 0, time.UTC)
+	event := internal.Event{
+		Organizer: ids[1], Participants: []string{ids[2]}, Start: start, Finish: start.Add(time.Hour),
+		Calendar: releases.ID, Visibility: internal.Private, Info: internal.CustomEventInfo{Name: "release"},
+	}
+	if _, err := s.CreateEventWithUsers(ctx, internal.CreateEventRequest{Event: event}); err == nil || err.Error() != "wrong calendar" {
+		t.Errorf("CreateEventWithUsers() by not editor error = %v, want wrong calendar", err)
+	}
+	event.Organizer = ids[0]
+	if _, err := s.CreateEventWithUsers(ctx, internal.CreateEventRequest{Event: event}); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.ListCalendars(ctx, internal.UserRequest{User: ids[1]}); err != nil || len(got) != 1 || got[0].ID != releases.ID {
+		t.Errorf("ListCalendars() = %v, %v, want calendar of the group", got, err)
+	}
+
+	tests := []struct {
+		name     string
+		user     string
+		wantName string
+		wantErr  string
+	}{
+		{name: "Editor sees details", user: ids[0], wantName: "release"},
+		{name: "Member doesn't see details of private event", user: ids[1]},
+		{name: "Not member", user: ids[2], wantErr: "wrong calendar"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.GetEvents(ctx, internal.EventsRequest{
+				User: tt.user, Calendar: releases.ID, From: start, To: start.Add(24 * time.Hour),
+			})
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("GetEvents() error = %v, want %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || len(got.Events) != 1 || got.Events[0].Info.Name != tt.wantName {
+				t.Errorf("GetEvents() = %+v, %v, want 1 event named %q", got, err, tt.wantName)
+			}
+		})
+	}
+}
+
+func Test_service_Organizations(t *testing.T) {
+	var stopped []string
+	s := New(storage.New(), nil, nil, WithTenants(func(organization internal.Organization) Scope {
+		return Scope{Storage: storage.New(), Stop: func() { stopped = append(stopped, organization.ID) }}
+	}))
+	sales := tenant.NewContext(context.Background(), internal.Organization{
+		ID: "sales", Settings: internal.OrganizationSettings{Granularity: 30 * time.Minute},
+	})
+	hr := tenant.NewContext(context.Background(), internal.Organization{ID: "hr"})
+	user, err := s.CreateUser(sales, internal.CreateUserRequest{Info: internal.CustomUserInfo{Name: "seller"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ctx := range []context.Context{hr, context.Background()} {
+		if _, err := s.GetUser(ctx, internal.UserRequest{User: user.ID}); err == nil || err.Error() != "unexisted user" {
+			t.Errorf("GetUser() of another organization error = %v, want unexisted user", err)
+		}
+	}
+
+	start := time.Date(2022, 9, 5, 10, 10, 0, 0, time.UTC)
+	slot, err := s.FindSlot(sales, internal.FindSlotRequest{
+		Users: []string{user.ID}, Duration: time.Hour, From: start, ValidUntil: start.Add(24 * time.Hour),
+	})
+	if want := start.Add(20 * time.Minute); err != nil || !slot.Begin.Equal(want) {
+		t.Errorf("FindSlot() = %v, %v, want %v aligned to granularity of the organization", slot.Begin, err, want)
+	}
+
+	s.Close()
+	sort.Strings(stopped)
+	if want := []string{"hr", "sales"}; !reflect.DeepEqual(stopped, want) {
+		t.Errorf("Close() stopped scopes %v, want %v", stopped, want)
+	}
+}
+
+func Test_service_ProcessITIP(t *testing.T) {
+	s := New(storage.New(), nil, nil)
+	ctx := context.Background()
+	var ids []string
+	for _, name := range []string{"olga", "ivan", "eve"} {
+		user, err := s.CreateUser(ctx, internal.CreateUserRequest{Info: internal.CustomUserInfo{Name: name, Email: name + "@example.com"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, user.ID)
+	}
+	start := time.Date(2022, 9, 5, 10, 0, 0, 0, time.UTC)
+	created, err := s.CreateEventWithUsers(ctx, internal.CreateEventRequest{Event: internal.Event{
+		Organizer: ids[0], Participants: []string{ids[0]}, Candidates: []string{ids[1]}, Start: start, Finish: start.Add(time.Hour),
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	event, err := s.GetEventDetails(ctx, internal.EventRequest{Event: created.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ivan := imip.Attendee{Email: "ivan@example.com", PartStat: imip.Accepted}
+	eve := imip.Attendee{Email: "eve@example.com", PartStat: imip.Declined}
+
+	counter := imip.Build(imip.Counter, event, "olga@example.com", []imip.Attendee{eve}, time.Now())
+	if err := s.ProcessITIP(ctx, counter); err == nil || err.Error() != "unexisted user in event" {
+		t.Errorf("ProcessITIP() of counter by uninvited user error = %v, want unexisted user in event", err)
+	}
+	if proposals, err := s.GetCounterProposals(ctx, internal.EventRequest{Event: created.ID}); err != nil || len(proposals) != 0 {
+		t.Errorf("GetCounterProposals() = %v, %v, want none", proposals, err)
+	}
+
+	reply := imip.Build(imip.Reply, event, "olga@example.com", []imip.Attendee{ivan, eve}, time.Now())
+	if err := s.ProcessITIP(ctx, reply); err == nil || err.Error() != "unexisted user in event" {
+		t.Errorf("ProcessITIP() of reply with uninvited user error = %v, want unexisted user in event", err)
+	}
+	if got, _ := s.GetEventDetails(ctx, internal.EventRequest{Event: created.ID}); got.Version != 1 {
+		t.Errorf("GetEventDetails() after rejected reply = %+v, want unchanged event", got)
+	}
+
+	reply = imip.Build(imip.Reply, event, "olga@example.com", []imip.Attendee{ivan}, time.Now())
+	if err := s.ProcessITIP(ctx, reply); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := s.GetEventDetails(ctx, internal.EventRequest{Event: created.ID}); !reflect.DeepEqual(got.Participants, []string{ids[0], ids[1]}) {
+		t.Errorf("GetEventDetails() participants = %v, want organizer and ivan", got.Participants)
+	}
+	if err := s.ProcessITIP(ctx, reply); err != nil {
+		t.Errorf("ProcessITIP() of resent reply error = %v", err)
+	}
+	if got, _ := s.GetEventDetails(ctx, internal.EventRequest{Event: created.ID}); got.Version != 2 {
+		t.Errorf("GetEventDetails() after resent reply = %+v, want unchanged event", got)
+	}
+
+	tentative := imip.Attendee{Email: "ivan@example.com", PartStat: "TENTATIVE"}
+	reply = imip.Build(imip.Reply, event, "olga@example.com", []imip.Attendee{tentative}, time.Now())
+	if err := s.ProcessITIP(ctx, reply); err == nil || err.Error() != "wrong query" {
+		t.Errorf("ProcessITIP() of tentative reply error = %v, want wrong query", err)
+	}
+	reply = imip.Build(imip.Reply, event, "olga@example.com", nil, time.Now())
+	if err := s.ProcessITIP(ctx, reply); err == nil || err.Error() != "wrong query" {
+		t.Errorf("ProcessITIP() of reply without attendees error = %v, want wrong query", err)
+	}
+
+	ivan.PartStat = imip.Declined
+	reply = imip.Build(imip.Reply, event, "olga@example.com", []imip.Attendee{ivan}, time.Now())
+	for _, name := range []string{"decline of participant", "resent decline"} {
+		if err := s.ProcessITIP(ctx, reply); err != nil {
+			t.Errorf("ProcessITIP() of %s error = %v", name, err)
+		}
+		if got, _ := s.GetEventDetails(ctx, internal.EventRequest{Event: created.ID}); got.IsAttendee(ids[1]) || got.Version != 3 {
+			t.Errorf("GetEventDetails() after %s = %+v, want ivan removed once", name, got)
+		}
+	}
+}
+
+func Test_service_GetAuditLog(t *testing.T) {
+	s := New(storage.New(), nil, nil)
+	ctx := audit.WithCaller(context.Background(), "key:1")
+	var ids []string
+	for _, name := range []string{"organizer", "guest"} {
+		user, err := s.CreateUser(ctx, internal.CreateUserRequest{Info: internal.CustomUserInfo{Name: name}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, user.ID)
+	}
+	start := time.Date(2022, 9, 5, 10, 0, 0, 0, time.UTC)
+	created, err := s.CreateEventWithUsers(ctx, internal.CreateEventRequest{Event: internal.Event{
+		Organizer: ids[0], Participants: []string{ids[0]}, Candidates: []string{ids[1]}, Start: start, Finish: start.Add(time.Hour),
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	claimed := audit.WithClaimedActor(ctx, ids[0])
+	if _, err := s.AcceptInvitation(claimed, internal.InvitationRequest{User: ids[1], Event: created.ID, Version: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CancelEvent(claimed, internal.EventRequest{Event: created.ID, Version: 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := s.GetAuditLog(ctx, internal.AuditRequest{Event: created.ID})
+	if err != nil || len(records) != 3 {
+		t.Fatalf("GetAuditLog() = %v, %v, want 3 records", records, err)
+	}
+	tests := []struct {
+		action  internal.AuditAction
+		actor   string
+		claimed string
+		fields  []string
+	}{
+		{action: internal.ActionCreateEvent, actor: "key:1", claimed: ids[0], fields: []string{"candidates", "finish", "id", "organizer", "participants", "start"}},
+		{action: internal.ActionAcceptInvitation, actor: "key:1", claimed: ids[1], fields: []string{"candidates", "participants", "version"}},
+		{action: internal.ActionCancelEvent, actor: "key:1", claimed: ids[0], fields: []string{"finish", "id", "organizer", "participants", "start", "version"}},
+	}
+	for i, tt := range tests {
+		t.Run(string(tt.action), func(t *testing.T) {
+			var fields []string
+			for _, change := range records[i].Changes {
+				fields = append(fields, change.Field)
+			}
+			if records[i].Action != tt.action || records[i].Actor != tt.actor || records[i].ClaimedActor != tt.claimed ||
+				!reflect.DeepEqual(fields, tt.fields) {
+				t.Errorf("GetAuditLog() record = %v by %v (%v) of %v, want %v by %v (%v) of %v", records[i].Action,
+					records[i].Actor, records[i].ClaimedActor, fields, tt.action, tt.actor, tt.claimed, tt.fields)
+			}
+		})
+	}
+
+	if records, err := s.GetAuditLog(ctx, internal.AuditRequest{User: ids[1]}); err != nil || len(records) != 2 {
+		t.Errorf("GetAuditLog() of the user = %v, %v, want creation of the user and acceptance", records, err)
+	}
+	if _, err := s.GetAuditLog(ctx, internal.AuditRequest{From: start, To: start.Add(-time.Hour)}); err == nil || err.Error() != "wrong query" {
+		t.Errorf("GetAuditLog() with wrong interval error = %v, want wrong query", err)
+	}
+}
+
+func Test_service_EventHistory(t *testing.T) {
+	s := New(storage.New(), nil, nil)
+	ctx := context.Background()
+	var ids []string
+	for _, name := range []string{"organizer", "guest"} {
+		user, err := s.CreateUser(ctx, internal.CreateUserRequest{Info: internal.CustomUserInfo{Name: name}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, user.ID)
+	}
+	start := time.Date(2022, 9, 5, 10, 0, 0, 0, time.UTC)
+	created, err := s.CreateEventWithUsers(ctx, internal.CreateEventRequest{Event: internal.Event{
+		Organizer: ids[0], Participants: []string{ids[0]}, Candidates: []string{ids[1]}, Start: start, Finish: start.Add(time.Hour),
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AcceptInvitation(ctx, internal.InvitationRequest{User: ids[1], Event: created.ID, Version: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CancelEvent(ctx, internal.EventRequest{Event: created.ID}); err == nil || err.Error() != "version required" {
+		t.Errorf("CancelEvent() without version error = %v, want version required", err)
+	}
+	if err := s.CancelEvent(ctx, internal.EventRequest{Event: created.ID, Version: 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	history, err := s.GetEventHistory(ctx, internal.EventRequest{Event: created.ID})
+	if err != nil || len(history) != 3 {
+		t.Fatalf("GetEventHistory() = %v, %v, want 3 revisions", history, err)
+	}
+	var fields []string
+	for _, change := range history[1].Changes {
+		fields = append(fields, change.Field)
+	}
+	if !reflect.DeepEqual(fields, []string{"candidates", "participants", "version"}) || len(history[2].Changes) != 1 || !history[2].Cancelled {
+		t.Errorf("GetEventHistory() changes = %v and %v, want acceptance and cancellation", fields, history[2])
+	}
+
+	if _, err := s.RestoreEventRevision(ctx, internal.RestoreEventRequest{Event: created.ID, Revision: 3, Version: 3}); err == nil || err.Error() != "wrong revision" {
+		t.Errorf("RestoreEventRevision() of cancellation error = %v, want wrong revision", err)
+	}
+	restored, err := s.RestoreEventRevision(audit.WithCaller(ctx, "key:1"), internal.RestoreEventRequest{Event: created.ID, Revision: 2, Version: 3})
+	if err != nil || !reflect.DeepEqual(restored.Participants, []string{ids[0], ids[1]}) {
+		t.Fatalf("RestoreEventRevision() = %v, %v, want accepted event", restored, err)
+	}
+	if events, err := s.GetEvents(ctx, internal.EventsRequest{User: ids[1], From: start, To: start.Add(time.Hour)}); err != nil || len(events.Events) != 1 {
+		t.Errorf("GetEvents() of restored event = %v, %v, want the event", events, err)
+	}
+	if records, _ := s.GetAuditLog(ctx, internal.AuditRequest{Event: created.ID}); len(records) != 4 ||
+		records[3].Action != internal.ActionRestoreEvent || records[3].Actor != "key:1" {
+		t.Errorf("GetAuditLog() = %v, want restoration by the caller", records)
+	}
+
+	if err := s.DeactivateUser(ctx, internal.UserRequest{User: ids[1]}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.RestoreEventRevision(ctx, internal.RestoreEventRequest{Event: created.ID, Revision: 1, Version: internal.AnyVersion}); err == nil || err.Error() != "deactivated user" {
+		t.Errorf("RestoreEventRevision() with deactivated user error = %v, want deactivated user", err)
+	}
+}
+
+func Test_service_EventListing(t *testing.T) {
+	s := New(storage.New(), nil, nil)
+	ctx := context.Background()
+	var ids []string
+	for _, name := range []string{"organizer", "guest"} {
+		user, err := s.CreateUser(ctx, internal.CreateUserRequest{Info: internal.CustomUserInfo{Name: name}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, user.ID)
+	}
+	organizer, guest := ids[0], ids[1]
+	start := time.Date(2022, 9, 5, 10, 0, 0, 0, time.UTC)
+	for _, event := range []internal.Event{
+		{Organizer: organizer, Participants: []string{organizer}, Start: start, Finish: start.Add(time.Hour),
+			RepeatType: internal.Daily, Info: internal.CustomEventInfo{Name: "Standup"}},
+		{Organizer: organizer, Participants: []string{organizer}, Candidates: []string{guest}, Start: start.Add(30 * time.Hour),
+			Finish: start.Add(31 * time.Hour), Info: internal.CustomEventInfo{Name: "Planning", Description: "Quarter goals"}},
+		{Organizer: guest, Participants: []string{guest, organizer}, Start: start.Add(2 * time.Hour), Finish: start.Add(3 * time.Hour),
+			Info: internal.CustomEventInfo{Name: "Review"}},
+	} {
+		if _, err := s.CreateEventWithUsers(ctx, internal.CreateEventRequest{Event: event}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	request := internal.EventsRequest{User: organizer, From: start, To: start.Add(72 * time.Hour)}
+
+	var names []string
+	var pages int
+	for page := withPage(request, 2, ""); ; pages++ {
+		got, err := s.GetEvents(ctx, page)
+		if err != nil || len(got.Events) > 2 {
+			t.Fatalf("GetEvents() = %v, %v, want page of 2 events", got, err)
+		}
+		for _, event := range got.Events {
+			names = append(names, event.Info.Name)
+		}
+		if got.NextPageToken == "" {
+			break
+		}
+		page = withPage(request, 2, got.NextPageToken)
+	}
+	want := []string{"Standup", "Review", "Standup", "Planning", "Standup"}
+	if !reflect.DeepEqual(names, want) || pages != 2 {
+		t.Errorf("GetEvents() pages = %v after %d tokens, want %v after 2", names, pages, want)
+	}
+	if got, err := s.GetEvents(ctx, internal.EventsRequest{User: organizer, From: start, To: start.Add(100 * 24 * time.Hour)}); err != nil ||
+		len(got.Events) != defaultPageSize || got.NextPageToken == "" {
+		t.Errorf("GetEvents() without limit = %d events, %v, want the default page", len(got.Events), err)
+	}
+
+	daily := internal.Daily
+	tests := []struct {
+		name    string
+		request internal.EventsRequest
+		want    int
+		wantErr string
+	}{
+		{name: "Organized", request: internal.EventsRequest{Organized: true}, want: 4},
+		{name: "Repeat type", request: internal.EventsRequest{RepeatType: &daily}, want: 3},
+		{name: "Query", request: internal.EventsRequest{Query: "quarter"}, want: 1},
+		{name: "Needs action", request: internal.EventsRequest{User: guest, Status: internal.NeedsAction}, want: 1},
+		{name: "Any status", request: internal.EventsRequest{User: guest, Status: internal.AnyStatus}, want: 2},
+		{name: "Accepted", request: internal.EventsRequest{User: guest, Status: internal.Accepted}, want: 1},
+		{name: "Wrong status", request: internal.EventsRequest{Status: "maybe"}, wantErr: "wrong query"},
+		{name: "Too large page", request: internal.EventsRequest{Limit: maxPageSize + 1}, wantErr: "wrong query"},
+		{name: "Wrong page token", request: internal.EventsRequest{PageToken: "p1:0"}, wantErr: "wrong query"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.request.From, tt.request.To = request.From, request.To
+			if tt.request.User == "" {
+				tt.request.User = organizer
+			}
+			got, err := s.GetEvents(ctx, tt.request)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("GetEvents() error = %v, want %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || len(got.Events) != tt.want {
+				t.Errorf("GetEvents() = %v, %v, want %d events", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func withPage(request internal.EventsRequest, limit int, token string) internal.EventsRequest {
+	request.Limit, request.PageToken = limit, token
+	return request
+}
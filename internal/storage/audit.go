@@ -0,0 +1,35 @@
+package storage
+
+import (
+	"time"
+
+	"github.com/nivanov045/calendar/internal"
+)
+
+// AddAuditRecord appends the record to the audit log. Records are never changed or removed.
+func (s *storage) AddAuditRecord(record internal.AuditRecord) {
+	s.auditMutex.Lock()
+	defer s.auditMutex.Unlock()
+	s.audit = append(s.audit, record)
+}
+
+// GetAuditRecords returns records in order of adding made or claimed to be made by the user or about it, if the user isn't empty,
+// about the target, if it isn't empty, and made within [begin, end), zero times don't limit the interval.
+func (s *storage) GetAuditRecords(user string, target string, begin time.Time, end time.Time) []internal.AuditRecord {
+	s.auditMutex.RLock()
+	defer s.auditMutex.RUnlock()
+	result := []internal.AuditRecord{}
+	for _, record := range s.audit {
+		if user != "" && record.Actor != user && record.ClaimedActor != user && record.Target != user {
+			continue
+		}
+		if target != "" && record.Target != target {
+			continue
+		}
+		if !begin.IsZero() && record.Time.Before(begin) || !end.IsZero() && !record.Time.Before(end) {
+			continue
+		}
+		result = append(result, record)
+	}
+	return result
+}
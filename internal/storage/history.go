@@ -0,0 +1,134 @@
+package storage
+
+import (
+	"errors"
+	"time"
+
+	"github.com/nivanov045/calendar/internal"
+)
+
+// revise appends a revision with a copy of the event, cancelled revisions keep the last state of the event.
+// The number of the revision becomes the version of the event. Must be called under eventsMutex.
+func (s *storage) revise(event internal.Event, cancelled bool) {
+	if s.revisions == nil {
+		s.revisions = map[string][]internal.EventRevision{}
+	}
+	now := time.Now()
+	event.Version = s.version(event.ID) + 1
+	s.revisions[event.ID] = append(s.purgeRevisions(s.revisions[event.ID], now), internal.EventRevision{
+		Number:    event.Version,
+		Time:      now,
+		Event:     copyEvent(event),
+		Cancelled: cancelled,
+	})
+}
+
+// purgeRevisions returns the revisions without ones older than retention. The last revision is always kept,
+// so numbers of revisions go on after purging.
+func (s *storage) purgeRevisions(revisions []internal.EventRevision, now time.Time) []internal.EventRevision {
+	if s.revisionRetention <= 0 {
+		return revisions
+	}
+	idx := 0
+	for idx < len(revisions)-1 && now.Sub(revisions[idx].Time) > s.revisionRetention {
+		idx++
+	}
+	return revisions[idx:]
+}
+
+// version returns the number of the last revision of the event. Must be called under eventsMutex.
+func (s *storage) version(id string) int {
+	revisions := s.revisions[id]
+	if len(revisions) == 0 {
+		return 0
+	}
+	return revisions[len(revisions)-1].Number
+}
+
+// copyEvent returns the event which doesn't share slices and maps with the original one,
+// so later changes of the event in place don't rewrite its history.
+func copyEvent(event internal.Event) internal.Event {
+	event.Participants = append([]string(nil), event.Participants...)
+	event.Candidates = append([]string(nil), event.Candidates...)
+	event.Reminders = append([]internal.Reminder(nil), event.Reminders...)
+	if event.InvitedVia != nil {
+		invitedVia := make(map[string]string, len(event.InvitedVia))
+		for user, group := range event.InvitedVia {
+			invitedVia[user] = group
+		}
+		event.InvitedVia = invitedVia
+	}
+	return event
+}
+
+// checkVersion returns an error if the event was changed after the version, internal.AnyVersion matches
+// any version. Must be called under eventsMutex.
+func (s *storage) checkVersion(id string, version int) error {
+	if version != internal.AnyVersion && version != s.version(id) {
+		return errors.New("version mismatch")
+	}
+	return nil
+}
+
+// GetEventRevisions returns revisions of the event in order of changes, including revisions of cancelled events.
+func (s *storage) GetEventRevisions(id string) ([]internal.EventRevision, error) {
+	s.eventsMutex.RLock()
+	defer s.eventsMutex.RUnlock()
+	revisions, ok := s.revisions[id]
+	if !ok {
+		return nil, errors.New("unexisted event")
+	}
+	return append([]internal.EventRevision(nil), s.purgeRevisions(revisions, time.Now())...), nil
+}
+
+// RestoreEvent makes the event as it was in the revision again, a cancelled event is created anew.
+// The restored state becomes a new revision, attendees missing in it lose the event.
+// version is the expected version of the event, any if internal.AnyVersion.
+func (s *storage) RestoreEvent(id string, number int, version int) (internal.Event, error) {
+	s.eventsMutex.Lock()
+	defer s.eventsMutex.Unlock()
+	revisions, ok := s.revisions[id]
+	if !ok {
+		return internal.Event{}, errors.New("unexisted event")
+	}
+	revisions = s.purgeRevisions(revisions, time.Now())
+	s.revisions[id] = revisions
+	first := revisions[0].Number
+	if number < first || number > s.version(id) {
+		return internal.Event{}, errors.New("unexisted revision")
+	}
+	if revisions[number-first].Cancelled {
+		return internal.Event{}, errors.New("wrong revision")
+	}
+	if err := s.checkVersion(id, version); err != nil {
+		return internal.Event{}, err
+	}
+	event := copyEvent(revisions[number-first].Event)
+	if event.Calendar != "" {
+		s.calendarsMutex.RLock()
+		if _, ok := s.calendars[event.Calendar]; !ok {
+			event.Calendar = ""
+		}
+		s.calendarsMutex.RUnlock()
+	}
+	current, existed := s.events[id]
+	s.events[id] = event
+	s.touch(id, !existed)
+	var lost []string
+	for _, user := range append(append([]string{}, current.Participants...), current.Candidates...) {
+		if !event.IsAttendee(user) {
+			lost = append(lost, user)
+		}
+	}
+	if len(lost) != 0 {
+		s.bury(event, lost)
+	}
+	event = s.events[id]
+	s.notify(internal.EventRestored, "", event)
+	for _, candidate := range event.Candidates {
+		if !current.IsAttendee(candidate) {
+			s.notify(internal.UserInvited, candidate, event)
+		}
+	}
+	return event, nil
+}
@@ -0,0 +1,9 @@
+package storage
+
+import "github.com/nivanov045/calendar/internal"
+
+// Notifier receives every change written to the storage. It is called under storage locks,
+// so implementations must not block.
+type Notifier interface {
+	Notify(change internal.Change)
+}
@@ -2,25 +2,103 @@ package storage
 
 import (
 	"errors"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/nivanov045/calendar/internal"
 )
 
+// storage keeps everything in memory. Mutexes held together are locked in the order
+// events, calendars, groups, users.
 type storage struct {
-	users       map[string]internal.User //users by id
-	usersMutex  sync.RWMutex
-	events      map[string]internal.Event //events by id
-	eventsMutex sync.RWMutex
+	users              map[string]internal.User //users by id
+	usersMutex         sync.RWMutex
+	groups             map[string]internal.Group //groups by id
+	groupsMutex        sync.RWMutex
+	calendars          map[string]internal.Calendar //calendars by id
+	calendarsMutex     sync.RWMutex
+	events             map[string]internal.Event           //events by id
+	revisions          map[string][]internal.EventRevision //revisions by event id in order of changes
+	revisionRetention  time.Duration                       //how long revisions are kept, forever if zero
+	eventsMutex        sync.RWMutex
+	firedReminders     map[string]time.Time //starts of occurrences by keys of already sent reminders
+	reminderWatermark  time.Time            //moment until which reminders were processed
+	remindersMutex     sync.Mutex
+	notifiers          []Notifier                            //receivers of changes
+	proposals          map[string][]internal.CounterProposal //counter proposals by event id
+	proposalsMutex     sync.RWMutex
+	sequence           uint64                   //number of the last change of events
+	eventSequences     map[string]eventSequence //numbers of changes by event id
+	tombstones         []tombstone              //removed events in order of removing
+	tombstoneRetention time.Duration            //how long tombstones are kept, forever if zero
+	purgedSequence     uint64                   //number of the last purged tombstone
+	audit              []internal.AuditRecord   //audit log in order of changes
+	auditMutex         sync.RWMutex
 }
 
-func New() *storage {
-	return &storage{
-		users:       map[string]internal.User{},
-		usersMutex:  sync.RWMutex{},
-		events:      map[string]internal.Event{},
-		eventsMutex: sync.RWMutex{},
+type Option func(s *storage)
+
+// WithTombstoneRetention sets how long removed events are remembered for incremental sync.
+func WithTombstoneRetention(retention time.Duration) Option {
+	return func(s *storage) {
+		s.tombstoneRetention = retention
+	}
+}
+
+// WithRevisionRetention sets how long revisions of events are kept, the last revision of an event is kept anyway.
+func WithRevisionRetention(retention time.Duration) Option {
+	return func(s *storage) {
+		s.revisionRetention = retention
+	}
+}
+
+// WithNotifier subscribes the notifier to all changes of the storage.
+func WithNotifier(notifier Notifier) Option {
+	return func(s *storage) {
+		s.notifiers = append(s.notifiers, notifier)
+	}
+}
+
+func New(options ...Option) *storage {
+	s := &storage{
+		users:          map[string]internal.User{},
+		usersMutex:     sync.RWMutex{},
+		groups:         map[string]internal.Group{},
+		groupsMutex:    sync.RWMutex{},
+		calendars:      map[string]internal.Calendar{},
+		calendarsMutex: sync.RWMutex{},
+		events:         map[string]internal.Event{},
+		eventsMutex:    sync.RWMutex{},
+		firedReminders: map[string]time.Time{},
+		remindersMutex: sync.Mutex{},
+		proposals:      map[string][]internal.CounterProposal{},
+		proposalsMutex: sync.RWMutex{},
+		eventSequences: map[string]eventSequence{},
+		revisions:      map[string][]internal.EventRevision{},
+	}
+	for _, option := range options {
+		option(s)
+	}
+	return s
+}
+
+// AddNotifier subscribes the notifier to all changes of the storage. It is intended for notifiers
+// which depend on the storage itself and must be called before the storage is used.
+func (s *storage) AddNotifier(notifier Notifier) {
+	s.notifiers = append(s.notifiers, notifier)
+}
+
+func (s *storage) notify(changeType internal.ChangeType, user string, event internal.Event) {
+	change := internal.Change{
+		Type:  changeType,
+		User:  user,
+		Event: event,
+		Time:  time.Now(),
+	}
+	for _, notifier := range s.notifiers {
+		notifier.Notify(change)
 	}
 }
 
@@ -41,6 +119,354 @@ func (s *storage) AddUser(user internal.User) error {
 	return nil
 }
 
+func (s *storage) GetUser(id string) (internal.User, error) {
+	s.usersMutex.RLock()
+	defer s.usersMutex.RUnlock()
+	if !s.isUserExist(id) {
+		return internal.User{}, errors.New("unexisted user")
+	}
+	return s.users[id], nil
+}
+
+func (s *storage) FindUserByEmail(email string) (internal.User, error) {
+	s.usersMutex.RLock()
+	defer s.usersMutex.RUnlock()
+	for _, user := range s.users {
+		if user.Info.Email != "" && strings.EqualFold(user.Info.Email, email) {
+			return user, nil
+		}
+	}
+	return internal.User{}, errors.New("unexisted user")
+}
+
+// UpdateUser replaces info of the user.
+func (s *storage) UpdateUser(id string, info internal.CustomUserInfo) (internal.User, error) {
+	s.usersMutex.Lock()
+	defer s.usersMutex.Unlock()
+	if !s.isUserExist(id) {
+		return internal.User{}, errors.New("unexisted user")
+	}
+	user := s.users[id]
+	user.Info = info
+	s.users[id] = user
+	return user, nil
+}
+
+// DeactivateUser marks the user as deactivated and removes it from events which aren't finished at now.
+// Repeated events are never finished.
+func (s *storage) DeactivateUser(id string, now time.Time) error {
+	s.usersMutex.Lock()
+	if !s.isUserExist(id) {
+		s.usersMutex.Unlock()
+		return errors.New("unexisted user")
+	}
+	user := s.users[id]
+	user.Deactivated = true
+	s.users[id] = user
+	s.usersMutex.Unlock()
+
+	s.eventsMutex.Lock()
+	defer s.eventsMutex.Unlock()
+	for eventID, event := range s.events {
+		if !event.IsAttendee(id) || (event.RepeatType == internal.Once && !event.Finish.After(now)) {
+			continue
+		}
+		event.Participants = without(event.Participants, id)
+		event.Candidates = without(event.Candidates, id)
+		s.events[eventID] = event
+		s.touch(eventID, false)
+		s.bury(event, []string{id})
+	}
+	return nil
+}
+
+// without returns copy of the users without the user.
+func without(users []string, user string) []string {
+	var result []string
+	for _, value := range users {
+		if value != user {
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+// ListUsers returns users sorted by name whose name, any word of name or email starts with the query,
+// ignoring case. Deactivated users are skipped unless includeDeactivated is set.
+func (s *storage) ListUsers(query string, includeDeactivated bool) []internal.User {
+	s.usersMutex.RLock()
+	defer s.usersMutex.RUnlock()
+	query = strings.ToLower(query)
+	result := []internal.User{}
+	for _, user := range s.users {
+		if user.Deactivated && !includeDeactivated {
+			continue
+		}
+		if matchesUser(user, query) {
+			result = append(result, user)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		left, right := strings.ToLower(result[i].Info.Name), strings.ToLower(result[j].Info.Name)
+		if left != right {
+			return left < right
+		}
+		return result[i].ID < result[j].ID
+	})
+	return result
+}
+
+// matchesUser checks the lower case query against the user's name, words of name and email.
+func matchesUser(user internal.User, query string) bool {
+	if query == "" || strings.HasPrefix(strings.ToLower(user.Info.Email), query) ||
+		strings.HasPrefix(strings.ToLower(user.Info.Name), query) {
+		return true
+	}
+	for _, word := range strings.Fields(strings.ToLower(user.Info.Name)) {
+		if strings.HasPrefix(word, query) {
+			return true
+		}
+	}
+	return false
+}
+
+// AddGroup saves the group whose members are existing users and groups.
+func (s *storage) AddGroup(group internal.Group) error {
+	s.groupsMutex.Lock()
+	defer s.groupsMutex.Unlock()
+	if _, ok := s.groups[group.ID]; ok {
+		return errors.New("group with this id already existed")
+	}
+	if err := s.checkMembers(group); err != nil {
+		return err
+	}
+	s.groups[group.ID] = group
+	return nil
+}
+
+func (s *storage) GetGroup(id string) (internal.Group, error) {
+	s.groupsMutex.RLock()
+	defer s.groupsMutex.RUnlock()
+	group, ok := s.groups[id]
+	if !ok {
+		return internal.Group{}, errors.New("unexisted group")
+	}
+	return group, nil
+}
+
+// UpdateGroup replaces info and members of the group. A group can't contain itself, even through nested groups.
+func (s *storage) UpdateGroup(group internal.Group) error {
+	s.groupsMutex.Lock()
+	defer s.groupsMutex.Unlock()
+	if _, ok := s.groups[group.ID]; !ok {
+		return errors.New("unexisted group")
+	}
+	if err := s.checkMembers(group); err != nil {
+		return err
+	}
+	for _, member := range group.Members {
+		if s.containsGroup(member, group.ID, map[string]bool{}) {
+			return errors.New("group cycle")
+		}
+	}
+	s.groups[group.ID] = group
+	return nil
+}
+
+// DeleteGroup removes the group and its membership in other groups. Events keep already invited members.
+func (s *storage) DeleteGroup(id string) error {
+	s.groupsMutex.Lock()
+	defer s.groupsMutex.Unlock()
+	if _, ok := s.groups[id]; !ok {
+		return errors.New("unexisted group")
+	}
+	delete(s.groups, id)
+	for groupID, group := range s.groups {
+		members := without(group.Members, id)
+		if len(members) != len(group.Members) {
+			group.Members = members
+			s.groups[groupID] = group
+		}
+	}
+	return nil
+}
+
+// checkMembers returns an error if any member of the group is neither a user nor a group.
+// groupsMutex must be held.
+func (s *storage) checkMembers(group internal.Group) error {
+	s.usersMutex.RLock()
+	defer s.usersMutex.RUnlock()
+	for _, member := range group.Members {
+		if _, ok := s.groups[member]; !ok && !s.isUserExist(member) {
+			return errors.New("unexisted member")
+		}
+	}
+	return nil
+}
+
+// containsGroup reports whether the member is the target group or contains it through nested groups.
+// groupsMutex must be held.
+func (s *storage) containsGroup(member string, target string, visited map[string]bool) bool {
+	if member == target {
+		return true
+	}
+	group, ok := s.groups[member]
+	if !ok || visited[member] {
+		return false
+	}
+	visited[member] = true
+	for _, nested := range group.Members {
+		if s.containsGroup(nested, target, visited) {
+			return true
+		}
+	}
+	return false
+}
+
+// ExpandGroup returns active users of the group and its nested groups, each once in order of membership.
+func (s *storage) ExpandGroup(id string) ([]string, error) {
+	s.groupsMutex.RLock()
+	defer s.groupsMutex.RUnlock()
+	if _, ok := s.groups[id]; !ok {
+		return nil, errors.New("unexisted group")
+	}
+	s.usersMutex.RLock()
+	defer s.usersMutex.RUnlock()
+	return s.expandGroup(id), nil
+}
+
+// MemberGroups returns groups which contain the active user directly or through nested groups.
+func (s *storage) MemberGroups(user string) []string {
+	s.groupsMutex.RLock()
+	defer s.groupsMutex.RUnlock()
+	s.usersMutex.RLock()
+	defer s.usersMutex.RUnlock()
+	result := []string{}
+	for id := range s.groups {
+		if contains(s.expandGroup(id), user) {
+			result = append(result, id)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// contains reports whether the id is in the list.
+func contains(ids []string, id string) bool {
+	for _, value := range ids {
+		if value == id {
+			return true
+		}
+	}
+	return false
+}
+
+// expandGroup returns active users of the group. groupsMutex and usersMutex must be held.
+func (s *storage) expandGroup(id string) []string {
+	users := []string{}
+	visited := map[string]bool{}
+	var expand func(member string)
+	expand = func(member string) {
+		if visited[member] {
+			return
+		}
+		visited[member] = true
+		if group, ok := s.groups[member]; ok {
+			for _, nested := range group.Members {
+				expand(nested)
+			}
+		} else if user, ok := s.users[member]; ok && !user.Deactivated {
+			users = append(users, member)
+		}
+	}
+	expand(id)
+	return users
+}
+
+// AddCalendar saves the calendar of an existing user or group.
+func (s *storage) AddCalendar(calendar internal.Calendar) error {
+	s.usersMutex.RLock()
+	ownerExists := s.isUserExist(calendar.Owner)
+	s.usersMutex.RUnlock()
+	s.groupsMutex.RLock()
+	_, isGroup := s.groups[calendar.Owner]
+	s.groupsMutex.RUnlock()
+	if !ownerExists && !isGroup {
+		return errors.New("unexisted owner")
+	}
+	s.calendarsMutex.Lock()
+	defer s.calendarsMutex.Unlock()
+	if _, ok := s.calendars[calendar.ID]; ok {
+		return errors.New("calendar with this id already existed")
+	}
+	s.calendars[calendar.ID] = calendar
+	return nil
+}
+
+func (s *storage) GetCalendar(id string) (internal.Calendar, error) {
+	s.calendarsMutex.RLock()
+	defer s.calendarsMutex.RUnlock()
+	calendar, ok := s.calendars[id]
+	if !ok {
+		return internal.Calendar{}, errors.New("unexisted calendar")
+	}
+	return calendar, nil
+}
+
+// UpdateCalendar replaces info of the calendar.
+func (s *storage) UpdateCalendar(id string, info internal.CustomCalendarInfo) (internal.Calendar, error) {
+	s.calendarsMutex.Lock()
+	defer s.calendarsMutex.Unlock()
+	calendar, ok := s.calendars[id]
+	if !ok {
+		return internal.Calendar{}, errors.New("unexisted calendar")
+	}
+	calendar.Info = info
+	s.calendars[id] = calendar
+	return calendar, nil
+}
+
+// DeleteCalendar removes the calendar, its events are moved to default calendars of attendees.
+func (s *storage) DeleteCalendar(id string) error {
+	s.calendarsMutex.Lock()
+	if _, ok := s.calendars[id]; !ok {
+		s.calendarsMutex.Unlock()
+		return errors.New("unexisted calendar")
+	}
+	delete(s.calendars, id)
+	s.calendarsMutex.Unlock()
+
+	s.eventsMutex.Lock()
+	defer s.eventsMutex.Unlock()
+	for eventID, event := range s.events {
+		if event.Calendar == id {
+			event.Calendar = ""
+			s.events[eventID] = event
+			s.touch(eventID, false)
+		}
+	}
+	return nil
+}
+
+// ListCalendars returns calendars of the owners sorted by name.
+func (s *storage) ListCalendars(owners ...string) []internal.Calendar {
+	s.calendarsMutex.RLock()
+	defer s.calendarsMutex.RUnlock()
+	result := []internal.Calendar{}
+	for _, calendar := range s.calendars {
+		if contains(owners, calendar.Owner) {
+			result = append(result, calendar)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Info.Name != result[j].Info.Name {
+			return result[i].Info.Name < result[j].Info.Name
+		}
+		return result[i].ID < result[j].ID
+	})
+	return result
+}
+
 func (s *storage) AddEvent(event internal.Event) error {
 	//TODO: Save in user map info about events to speedup several functions
 	s.eventsMutex.Lock()
@@ -48,7 +474,30 @@ func (s *storage) AddEvent(event internal.Event) error {
 	if _, ok := s.events[event.ID]; ok {
 		return errors.New("event with this id already existed")
 	}
+	s.addEvent(event)
+	return nil
+}
+
+func (s *storage) addEvent(event internal.Event) {
 	s.events[event.ID] = event
+	s.touch(event.ID, true)
+	event = s.events[event.ID]
+	s.notify(internal.EventCreated, "", event)
+	for _, candidate := range event.Candidates {
+		s.notify(internal.UserInvited, candidate, event)
+	}
+}
+
+func (s *storage) AddEventStrict(event internal.Event, horizon time.Time) error {
+	s.eventsMutex.Lock()
+	defer s.eventsMutex.Unlock()
+	if _, ok := s.events[event.ID]; ok {
+		return errors.New("event with this id already existed")
+	}
+	if len(s.findConflicts(event, event.Participants, horizon)) != 0 {
+		return errors.New("conflict with existing events")
+	}
+	s.addEvent(event)
 	return nil
 }
 
@@ -61,12 +510,38 @@ func (s *storage) GetEvent(id string) (internal.Event, error) {
 	return s.events[id], nil
 }
 
-func (s *storage) Accept(user string, event string) error {
+// CancelEvent removes the event, version is the expected version of the event, any if zero.
+func (s *storage) CancelEvent(id string, version int) error {
+	s.eventsMutex.Lock()
+	defer s.eventsMutex.Unlock()
+	if _, ok := s.events[id]; !ok {
+		return errors.New("unexisted event")
+	}
+	if err := s.checkVersion(id, version); err != nil {
+		return err
+	}
+	event := s.events[id]
+	delete(s.events, id)
+	s.bury(event, append(append([]string{}, event.Participants...), event.Candidates...))
+	s.revise(event, true)
+	s.notify(internal.EventCancelled, "", event)
+	return nil
+}
+
+// Accept makes the candidate a participant, version is the expected version of the event, any if zero.
+func (s *storage) Accept(user string, event string, version int) error {
 	s.eventsMutex.Lock()
 	defer s.eventsMutex.Unlock()
 	if _, ok := s.events[event]; !ok {
 		return errors.New("unexisted event")
 	}
+	if err := s.checkVersion(event, version); err != nil {
+		return err
+	}
+	return s.accept(user, event)
+}
+
+func (s *storage) accept(user string, event string) error {
 	for idx, value := range s.events[event].Candidates {
 		if value != user {
 			continue
@@ -75,86 +550,70 @@ func (s *storage) Accept(user string, event string) error {
 		eventTmp.Candidates = append(eventTmp.Candidates[:idx], eventTmp.Candidates[idx+1:]...)
 		eventTmp.Participants = append(eventTmp.Participants, user)
 		s.events[event] = eventTmp
+		s.touch(event, false)
+		s.notify(internal.InvitationAccepted, user, s.events[event])
 		return nil
 	}
 	return errors.New("unexisted user in event")
 }
 
-func (s *storage) Reject(user string, event string) error {
+func (s *storage) AcceptStrict(user string, event string, version int, horizon time.Time) error {
 	s.eventsMutex.Lock()
 	defer s.eventsMutex.Unlock()
 	if _, ok := s.events[event]; !ok {
 		return errors.New("unexisted event")
 	}
-	for idx, value := range s.events[event].Candidates {
-		if value != user {
-			continue
-		}
-		eventTmp := s.events[event]
-		eventTmp.Candidates = append(eventTmp.Candidates[:idx], eventTmp.Candidates[idx+1:]...)
-		s.events[event] = eventTmp
-		return nil
+	if err := s.checkVersion(event, version); err != nil {
+		return err
 	}
-	return errors.New("unexisted user in event")
+	if len(s.findConflicts(s.events[event], []string{user}, horizon)) != 0 {
+		return errors.New("conflict with existing events")
+	}
+	return s.accept(user, event)
+}
+
+// Reject removes the candidate or the participant who accepted the invitation from the event, version is
+// the expected version of the event, any if internal.AnyVersion.
+func (s *storage) Reject(user string, event string, version int) error {
+	s.eventsMutex.Lock()
+	defer s.eventsMutex.Unlock()
+	if _, ok := s.events[event]; !ok {
+		return errors.New("unexisted event")
+	}
+	if err := s.checkVersion(event, version); err != nil {
+		return err
+	}
+	eventTmp := s.events[event]
+	if !eventTmp.IsAttendee(user) {
+		return errors.New("unexisted user in event")
+	}
+	eventTmp.Candidates = without(eventTmp.Candidates, user)
+	eventTmp.Participants = without(eventTmp.Participants, user)
+	s.events[event] = eventTmp
+	s.touch(event, false)
+	s.bury(eventTmp, []string{user})
+	s.notify(internal.InvitationRejected, user, s.events[event])
+	return nil
 }
 
 func (s *storage) GetEvents(user string, begin time.Time, end time.Time) ([]internal.Event, error) {
 	s.eventsMutex.RLock()
 	defer s.eventsMutex.RUnlock()
-	if !s.isUserExist(user) {
+	return s.getEvents(user, begin, end)
+}
+
+func (s *storage) getEvents(user string, begin time.Time, end time.Time) ([]internal.Event, error) {
+	s.usersMutex.RLock()
+	userExists := s.isUserExist(user)
+	s.usersMutex.RUnlock()
+	if !userExists {
 		return nil, errors.New("unexisted user")
 	}
 	var result []internal.Event
 	for _, curEvent := range s.events {
 		for _, participant := range curEvent.Participants {
 			if participant == user {
-				//TODO: Speedup by use first date not from event start but after |begin|
-				switch curEvent.RepeatType {
-				case internal.Daily:
-					for first := curEvent.Start; first.Before(end); first = first.AddDate(0, 0, 1) {
-						curEvent.Finish = curEvent.Finish.Add(first.Sub(curEvent.Start))
-						curEvent.Start = first
-						if (curEvent.Finish.After(begin) && curEvent.Finish.Before(end)) ||
-							(curEvent.Start.After(begin) && curEvent.Start.Before(end)) {
-							result = append(result, curEvent)
-						}
-					}
-				case internal.Weekly:
-					for first := curEvent.Start; first.Before(end); first = first.AddDate(0, 0, 7) {
-						curEvent.Finish = curEvent.Finish.Add(first.Sub(curEvent.Start))
-						curEvent.Start = first
-						if (curEvent.Finish.After(begin) && curEvent.Finish.Before(end)) ||
-							(curEvent.Start.After(begin) && curEvent.Start.Before(end)) {
-							result = append(result, curEvent)
-						}
-					}
-				case internal.Workdays:
-					for first := curEvent.Start; first.Before(end); first = first.AddDate(0, 0, 1) {
-						if first.Weekday() == time.Saturday || first.Weekday() == time.Sunday {
-							continue
-						}
-						curEvent.Finish = curEvent.Finish.Add(first.Sub(curEvent.Start))
-						curEvent.Start = first
-						if (curEvent.Finish.After(begin) && curEvent.Finish.Before(end)) ||
-							(curEvent.Start.After(begin) && curEvent.Start.Before(end)) {
-							result = append(result, curEvent)
-						}
-					}
-				case internal.Yearly:
-					for first := curEvent.Start; first.Before(end); first = first.AddDate(1, 0, 0) {
-						curEvent.Finish = curEvent.Finish.Add(first.Sub(curEvent.Start))
-						curEvent.Start = first
-						if (curEvent.Finish.After(begin) && curEvent.Finish.Before(end)) ||
-							(curEvent.Start.After(begin) && curEvent.Start.Before(end)) {
-							result = append(result, curEvent)
-						}
-					}
-				case internal.Once:
-					if (curEvent.Finish.After(begin) && curEvent.Finish.Before(end)) ||
-						(curEvent.Start.After(begin) && curEvent.Start.Before(end)) {
-						result = append(result, curEvent)
-					}
-				}
+				result = append(result, occurrences(curEvent, begin, end)...)
 				break
 			}
 		}
@@ -162,28 +621,207 @@ func (s *storage) GetEvents(user string, begin time.Time, end time.Time) ([]inte
 	return result, nil
 }
 
-func (s *storage) FindFreeSlot(users []string, begin time.Time, duration time.Duration, validUntil time.Time) (from time.Time, err error) {
+// GetInvitations returns occurrences of events within [begin, end) to which the user is invited but hasn't answered.
+func (s *storage) GetInvitations(user string, begin time.Time, end time.Time) ([]internal.Event, error) {
 	s.eventsMutex.RLock()
 	defer s.eventsMutex.RUnlock()
-	events := map[string][]internal.Event{}
+	s.usersMutex.RLock()
+	userExists := s.isUserExist(user)
+	s.usersMutex.RUnlock()
+	if !userExists {
+		return nil, errors.New("unexisted user")
+	}
+	var result []internal.Event
+	for _, curEvent := range s.events {
+		for _, candidate := range curEvent.Candidates {
+			if candidate == user {
+				result = append(result, occurrences(curEvent, begin, end)...)
+				break
+			}
+		}
+	}
+	return result, nil
+}
+
+// GetCalendarEvents returns occurrences of events of the calendar which overlap with [begin, end).
+func (s *storage) GetCalendarEvents(calendar string, begin time.Time, end time.Time) ([]internal.Event, error) {
+	s.calendarsMutex.RLock()
+	_, ok := s.calendars[calendar]
+	s.calendarsMutex.RUnlock()
+	if !ok {
+		return nil, errors.New("unexisted calendar")
+	}
+	s.eventsMutex.RLock()
+	defer s.eventsMutex.RUnlock()
+	var result []internal.Event
+	for _, curEvent := range s.events {
+		if curEvent.Calendar == calendar {
+			result = append(result, occurrences(curEvent, begin, end)...)
+		}
+	}
+	return result, nil
+}
+
+// getBusy returns occurrences of the user's events which make the user busy in [begin, end).
+// Events of the user's transparent calendars are skipped, events of calendars of the user's groups
+// which are busy for members are added.
+func (s *storage) getBusy(user string, begin time.Time, end time.Time) ([]internal.Event, error) {
+	events, err := s.getEvents(user, begin, end)
+	if err != nil {
+		return nil, err
+	}
+	s.calendarsMutex.RLock()
+	defer s.calendarsMutex.RUnlock()
+	var result []internal.Event
+	for _, event := range events {
+		calendar, ok := s.calendars[event.Calendar]
+		if ok && calendar.Owner == user && calendar.Info.Transparent {
+			continue
+		}
+		result = append(result, event)
+	}
+	teamCalendars := s.busyTeamCalendars(user)
+	for _, event := range s.events {
+		if teamCalendars[event.Calendar] && !contains(event.Participants, user) {
+			result = append(result, occurrences(event, begin, end)...)
+		}
+	}
+	return result, nil
+}
+
+// busyTeamCalendars returns ids of calendars which are busy for members of their groups containing the user.
+// calendarsMutex must be held.
+func (s *storage) busyTeamCalendars(user string) map[string]bool {
+	result := map[string]bool{}
+	s.groupsMutex.RLock()
+	defer s.groupsMutex.RUnlock()
+	s.usersMutex.RLock()
+	defer s.usersMutex.RUnlock()
+	for id, calendar := range s.calendars {
+		if !calendar.Info.BusyForMembers {
+			continue
+		}
+		if _, ok := s.groups[calendar.Owner]; ok && contains(s.expandGroup(calendar.Owner), user) {
+			result[id] = true
+		}
+	}
+	return result
+}
+
+// occurrences returns copies of the event for every repetition which overlaps with [begin, end).
+func occurrences(curEvent internal.Event, begin time.Time, end time.Time) []internal.Event {
+	var result []internal.Event
+	//TODO: Speedup by use first date not from event start but after |begin|
+	switch curEvent.RepeatType {
+	case internal.Daily:
+		for first := curEvent.Start; first.Before(end); first = first.AddDate(0, 0, 1) {
+			curEvent.Finish = curEvent.Finish.Add(first.Sub(curEvent.Start))
+			curEvent.Start = first
+			if isIntersect(curEvent, begin, end) {
+				result = append(result, curEvent)
+			}
+		}
+	case internal.Weekly:
+		for first := curEvent.Start; first.Before(end); first = first.AddDate(0, 0, 7) {
+			curEvent.Finish = curEvent.Finish.Add(first.Sub(curEvent.Start))
+			curEvent.Start = first
+			if isIntersect(curEvent, begin, end) {
+				result = append(result, curEvent)
+			}
+		}
+	case internal.Workdays:
+		for first := curEvent.Start; first.Before(end); first = first.AddDate(0, 0, 1) {
+			if first.Weekday() == time.Saturday || first.Weekday() == time.Sunday {
+				continue
+			}
+			curEvent.Finish = curEvent.Finish.Add(first.Sub(curEvent.Start))
+			curEvent.Start = first
+			if isIntersect(curEvent, begin, end) {
+				result = append(result, curEvent)
+			}
+		}
+	case internal.Yearly:
+		for first := curEvent.Start; first.Before(end); first = first.AddDate(1, 0, 0) {
+			curEvent.Finish = curEvent.Finish.Add(first.Sub(curEvent.Start))
+			curEvent.Start = first
+			if isIntersect(curEvent, begin, end) {
+				result = append(result, curEvent)
+			}
+		}
+	case internal.Once:
+		if isIntersect(curEvent, begin, end) {
+			result = append(result, curEvent)
+		}
+	}
+	return result
+}
+
+func (s *storage) FindConflicts(event internal.Event, users []string, horizon time.Time) ([]internal.Conflict, error) {
+	s.eventsMutex.RLock()
+	defer s.eventsMutex.RUnlock()
+	return s.findConflicts(event, users, horizon), nil
+}
+
+// findConflicts returns occurrences of users' events which overlap with repetitions of the event until horizon.
+// Unknown users are skipped, the event itself is never reported.
+func (s *storage) findConflicts(event internal.Event, users []string, horizon time.Time) []internal.Conflict {
+	var result []internal.Conflict
+	eventOccurrences := occurrences(event, event.Start, horizon)
+	for _, user := range users {
+		busy, err := s.getBusy(user, event.Start, horizon)
+		if err != nil {
+			continue
+		}
+		for _, busyOccurrence := range busy {
+			if busyOccurrence.ID == event.ID {
+				continue
+			}
+			for _, occurrence := range eventOccurrences {
+				if isIntersect(busyOccurrence, occurrence.Start, occurrence.Finish) {
+					result = append(result, internal.Conflict{
+						User:   user,
+						Event:  busyOccurrence.ID,
+						Start:  busyOccurrence.Start,
+						Finish: busyOccurrence.Finish,
+					})
+					break
+				}
+			}
+		}
+	}
+	return result
+}
+
+// isIntersect reports whether the event occurrence overlaps with [begin, end).
+func isIntersect(event internal.Event, begin time.Time, end time.Time) bool {
+	return event.Start.Before(end) && event.Finish.After(begin)
+}
+
+func (s *storage) FindFreeSlot(users []string, begin time.Time, duration time.Duration, validUntil time.Time, options internal.SlotOptions) (from time.Time, err error) {
+	s.eventsMutex.RLock()
+	defer s.eventsMutex.RUnlock()
+	return s.findFreeSlot(users, begin, duration, validUntil, options)
+}
+
+func (s *storage) findFreeSlot(users []string, begin time.Time, duration time.Duration, validUntil time.Time, options internal.SlotOptions) (time.Time, error) {
+	var busy []internal.Event
 	for _, myUser := range users {
-		eventsInner, err := s.GetEvents(myUser, begin, validUntil)
+		eventsInner, err := s.getBusy(myUser, begin.Add(-options.BufferAfter), validUntil.Add(options.BufferBefore))
 		if err != nil {
 			return time.Time{}, err
 		}
-		events[myUser] = eventsInner
+		busy = append(busy, eventsInner...)
 	}
+	begin = alignUp(begin, options.Granularity)
 	for begin.Before(validUntil) {
 		changed := false
-		for _, userEvents := range events {
-			for _, curEvent := range userEvents {
-				finish := begin.Add(duration)
-				if !((curEvent.Start.After(finish) && curEvent.Start.After(begin)) ||
-					(curEvent.Finish.Before(finish) && curEvent.Finish.Before(begin))) {
-					begin = curEvent.Finish
-					changed = true
-					break
-				}
+		finish := begin.Add(duration)
+		for _, curEvent := range busy {
+			//existing meeting with its buffers intersects with the slot
+			if curEvent.Start.Add(-options.BufferBefore).Before(finish) && begin.Before(curEvent.Finish.Add(options.BufferAfter)) {
+				begin = alignUp(curEvent.Finish.Add(options.BufferAfter), options.Granularity)
+				changed = true
+				break
 			}
 		}
 		if !changed {
@@ -192,3 +830,128 @@ func (s *storage) FindFreeSlot(users []string, begin time.Time, duration time.Du
 	}
 	return time.Time{}, errors.New("no such slot")
 }
+
+// alignUp rounds the wall clock time of t up to the nearest multiple of granularity counted from the start
+// of its day in the location of t. Zero granularity leaves t as is.
+func alignUp(t time.Time, granularity time.Duration) time.Time {
+	if granularity <= 0 {
+		return t
+	}
+	day := startOfDay(t)
+	sinceDay := t.Sub(day)
+	aligned := sinceDay.Truncate(granularity)
+	if aligned < sinceDay {
+		aligned += granularity
+	}
+	return day.Add(aligned)
+}
+
+// startOfDay returns the midnight of the day of t in the location of t.
+func startOfDay(t time.Time) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+}
+
+func (s *storage) BookFreeSlot(event internal.Event, begin time.Time, duration time.Duration, validUntil time.Time, options internal.SlotOptions) (internal.Event, error) {
+	s.eventsMutex.Lock()
+	defer s.eventsMutex.Unlock()
+	if _, ok := s.events[event.ID]; ok {
+		return internal.Event{}, errors.New("event with this id already existed")
+	}
+	for {
+		from, err := s.findFreeSlot(event.Participants, begin, duration, validUntil, options)
+		if err != nil {
+			return internal.Event{}, err
+		}
+		event.Start = from
+		event.Finish = from.Add(duration)
+		shift, conflict := s.findBookingConflict(event, validUntil, options)
+		if !conflict {
+			break
+		}
+		//next repetitions of the event are busy, move the whole series
+		begin = from.Add(shift)
+	}
+	s.addEvent(event)
+	return s.events[event.ID], nil
+}
+
+// findBookingConflict checks all repetitions of the event until validUntil against participants' events
+// and returns how far the event has to be moved to pass the first found conflict.
+func (s *storage) findBookingConflict(event internal.Event, validUntil time.Time, options internal.SlotOptions) (time.Duration, bool) {
+	for _, occurrence := range occurrences(event, event.Start, validUntil) {
+		for _, participant := range event.Participants {
+			busy, err := s.getBusy(participant, occurrence.Start.Add(-options.BufferAfter), occurrence.Finish.Add(options.BufferBefore))
+			if err != nil || len(busy) == 0 {
+				continue
+			}
+			return busy[0].Finish.Add(options.BufferAfter).Sub(occurrence.Start), true
+		}
+	}
+	return 0, false
+}
+
+func (s *storage) GetAllEvents(begin time.Time, end time.Time) ([]internal.Event, error) {
+	s.eventsMutex.RLock()
+	defer s.eventsMutex.RUnlock()
+	var result []internal.Event
+	for _, curEvent := range s.events {
+		result = append(result, occurrences(curEvent, begin, end)...)
+	}
+	return result, nil
+}
+
+// MarkReminderFired remembers the reminder of the occurrence starting at start, false if it was already fired.
+func (s *storage) MarkReminderFired(key string, start time.Time) (bool, error) {
+	s.remindersMutex.Lock()
+	defer s.remindersMutex.Unlock()
+	if _, ok := s.firedReminders[key]; ok {
+		return false, nil
+	}
+	s.firedReminders[key] = start
+	return true, nil
+}
+
+func (s *storage) GetReminderWatermark() (time.Time, error) {
+	s.remindersMutex.Lock()
+	defer s.remindersMutex.Unlock()
+	return s.reminderWatermark, nil
+}
+
+func (s *storage) SetReminderWatermark(watermark time.Time) error {
+	s.remindersMutex.Lock()
+	defer s.remindersMutex.Unlock()
+	s.reminderWatermark = watermark
+	//reminders of occurrences started before the watermark can't fire again
+	for key, start := range s.firedReminders {
+		if start.Before(watermark) {
+			delete(s.firedReminders, key)
+		}
+	}
+	return nil
+}
+
+func (s *storage) AddCounterProposal(proposal internal.CounterProposal) error {
+	s.eventsMutex.RLock()
+	_, ok := s.events[proposal.Event]
+	s.eventsMutex.RUnlock()
+	if !ok {
+		return errors.New("unexisted event")
+	}
+	s.proposalsMutex.Lock()
+	defer s.proposalsMutex.Unlock()
+	s.proposals[proposal.Event] = append(s.proposals[proposal.Event], proposal)
+	return nil
+}
+
+func (s *storage) GetCounterProposals(event string) ([]internal.CounterProposal, error) {
+	s.eventsMutex.RLock()
+	_, ok := s.events[event]
+	s.eventsMutex.RUnlock()
+	if !ok {
+		return nil, errors.New("unexisted event")
+	}
+	s.proposalsMutex.RLock()
+	defer s.proposalsMutex.RUnlock()
+	return append([]internal.CounterProposal{}, s.proposals[event]...), nil
+}
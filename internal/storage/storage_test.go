@@ -2,6 +2,8 @@ package storage
 
 import (
 	"reflect"
+	"strconv"
+	"sync"
 	"testing"
 	"time"
 
@@ -295,4 +297,865 @@ func Test_storage_AddEvent(t *testing.T) {
 	}
 }
 
+func Test_alignUp(t *testing.T) {
+	tests := []struct {
+		name        string
+		t           time.Time
+		granularity time.Duration
+		want        time.Time
+	}{
+		{
+			name:        "Zero granularity",
+			t:           first(time.Parse(time.RFC3339Nano, "2022-09-02T10:07:13.5Z")),
+			granularity: 0,
+			want:        first(time.Parse(time.RFC3339Nano, "2022-09-02T10:07:13.5Z")),
+		},
+		{
+			name:        "Round up to 15 minutes",
+			t:           first(time.Parse(time.RFC3339Nano, "2022-09-02T10:07:13.5Z")),
+			granularity: 15 * time.Minute,
+			want:        first(time.Parse(time.RFC3339, "2022-09-02T10:15:00Z")),
+		},
+		{
+			name:        "Already aligned",
+			t:           first(time.Parse(time.RFC3339, "2022-09-02T10:30:00Z")),
+			granularity: 30 * time.Minute,
+			want:        first(time.Parse(time.RFC3339, "2022-09-02T10:30:00Z")),
+		},
+		{
+			name:        "Wall clock of non-UTC location",
+			t:           first(time.Parse(time.RFC3339, "2022-09-02T10:07:00+05:30")),
+			granularity: time.Hour,
+			want:        first(time.Parse(time.RFC3339, "2022-09-02T11:00:00+05:30")),
+		},
+		{
+			name:        "Granularity not dividing an hour",
+			t:           first(time.Parse(time.RFC3339, "2022-09-02T10:07:00+05:30")),
+			granularity: 45 * time.Minute,
+			want:        first(time.Parse(time.RFC3339, "2022-09-02T10:30:00+05:30")),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := alignUp(tt.t, tt.granularity); !got.Equal(tt.want) {
+				t.Errorf("alignUp() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_storage_FindFreeSlot(t *testing.T) {
+	users := map[string]internal.User{
+		"u-1": {ID: "u-1"},
+		"u-2": {ID: "u-2"},
+	}
+	events := map[string]internal.Event{
+		"e-1": {
+			ID:           "e-1",
+			Participants: []string{"u-1"},
+			Start:        first(time.Parse(time.RFC3339, "2022-09-02T10:00:00Z")),
+			Finish:       first(time.Parse(time.RFC3339, "2022-09-02T11:00:00Z")),
+		},
+		"e-2": {
+			ID:           "e-2",
+			Participants: []string{"u-2"},
+			Start:        first(time.Parse(time.RFC3339, "2022-09-02T11:40:00Z")),
+			Finish:       first(time.Parse(time.RFC3339, "2022-09-02T12:00:00Z")),
+		},
+	}
+	type args struct {
+		users      []string
+		begin      time.Time
+		duration   time.Duration
+		validUntil time.Time
+		options    internal.SlotOptions
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    time.Time
+		wantErr bool
+	}{
+		{
+			name: "Slot right after meeting",
+			args: args{
+				users:      []string{"u-1", "u-2"},
+				begin:      first(time.Parse(time.RFC3339, "2022-09-02T09:45:00Z")),
+				duration:   30 * time.Minute,
+				validUntil: first(time.Parse(time.RFC3339, "2022-09-02T18:00:00Z")),
+			},
+			want: first(time.Parse(time.RFC3339, "2022-09-02T11:00:00Z")),
+		},
+		{
+			name: "Buffers move slot after second meeting",
+			args: args{
+				users:      []string{"u-1", "u-2"},
+				begin:      first(time.Parse(time.RFC3339, "2022-09-02T09:30:00Z")),
+				duration:   30 * time.Minute,
+				validUntil: first(time.Parse(time.RFC3339, "2022-09-02T18:00:00Z")),
+				options: internal.SlotOptions{
+					BufferBefore: 10 * time.Minute,
+					BufferAfter:  10 * time.Minute,
+				},
+			},
+			want: first(time.Parse(time.RFC3339, "2022-09-02T12:10:00Z")),
+		},
+		{
+			name: "Start aligned to granularity",
+			args: args{
+				users:      []string{"u-1"},
+				begin:      first(time.Parse(time.RFC3339Nano, "2022-09-02T08:01:02.345Z")),
+				duration:   30 * time.Minute,
+				validUntil: first(time.Parse(time.RFC3339, "2022-09-02T18:00:00Z")),
+				options:    internal.SlotOptions{Granularity: 15 * time.Minute},
+			},
+			want: first(time.Parse(time.RFC3339, "2022-09-02T08:15:00Z")),
+		},
+		{
+			name: "No slot before valid until",
+			args: args{
+				users:      []string{"u-1"},
+				begin:      first(time.Parse(time.RFC3339, "2022-09-02T10:00:00Z")),
+				duration:   30 * time.Minute,
+				validUntil: first(time.Parse(time.RFC3339, "2022-09-02T10:30:00Z")),
+			},
+			wantErr: true,
+		},
+		{
+			name: "Unexisted user",
+			args: args{
+				users:      []string{"u-3"},
+				begin:      first(time.Parse(time.RFC3339, "2022-09-02T10:00:00Z")),
+				duration:   30 * time.Minute,
+				validUntil: first(time.Parse(time.RFC3339, "2022-09-02T18:00:00Z")),
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &storage{
+				users:  users,
+				events: events,
+			}
+			got, err := s.FindFreeSlot(tt.args.users, tt.args.begin, tt.args.duration, tt.args.validUntil, tt.args.options)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("FindFreeSlot() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("FindFreeSlot() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_storage_BookFreeSlot(t *testing.T) {
+	type args struct {
+		event      internal.Event
+		begin      time.Time
+		duration   time.Duration
+		validUntil time.Time
+	}
+	tests := []struct {
+		name       string
+		args       args
+		wantStart  time.Time
+		wantErr    bool
+		wantStored bool
+	}{
+		{
+			name: "Book first free slot",
+			args: args{
+				event:      internal.Event{ID: "new", Participants: []string{"u-1"}},
+				begin:      first(time.Parse(time.RFC3339, "2022-09-02T10:30:00Z")),
+				duration:   time.Hour,
+				validUntil: first(time.Parse(time.RFC3339, "2022-09-09T18:00:00Z")),
+			},
+			wantStart:  first(time.Parse(time.RFC3339, "2022-09-02T11:00:00Z")),
+			wantStored: true,
+		},
+		{
+			name: "Daily event moved after repeating conflict",
+			args: args{
+				event:      internal.Event{ID: "new", Participants: []string{"u-1"}, RepeatType: internal.Daily},
+				begin:      first(time.Parse(time.RFC3339, "2022-09-02T12:00:00Z")),
+				duration:   time.Hour,
+				validUntil: first(time.Parse(time.RFC3339, "2022-09-09T18:00:00Z")),
+			},
+			wantStart:  first(time.Parse(time.RFC3339, "2022-09-02T13:30:00Z")),
+			wantStored: true,
+		},
+		{
+			name: "Existing id",
+			args: args{
+				event:      internal.Event{ID: "e-1", Participants: []string{"u-1"}},
+				begin:      first(time.Parse(time.RFC3339, "2022-09-02T10:30:00Z")),
+				duration:   time.Hour,
+				validUntil: first(time.Parse(time.RFC3339, "2022-09-09T18:00:00Z")),
+			},
+			wantErr: true,
+		},
+		{
+			name: "No slot",
+			args: args{
+				event:      internal.Event{ID: "new", Participants: []string{"u-1"}},
+				begin:      first(time.Parse(time.RFC3339, "2022-09-02T10:30:00Z")),
+				duration:   time.Hour,
+				validUntil: first(time.Parse(time.RFC3339, "2022-09-02T11:00:00Z")),
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &storage{
+				users: map[string]internal.User{"u-1": {ID: "u-1"}},
+				events: map[string]internal.Event{
+					"e-1": {
+						ID:           "e-1",
+						Participants: []string{"u-1"},
+						Start:        first(time.Parse(time.RFC3339, "2022-09-02T10:00:00Z")),
+						Finish:       first(time.Parse(time.RFC3339, "2022-09-02T11:00:00Z")),
+					},
+					"e-2": {
+						ID:           "e-2",
+						Participants: []string{"u-1"},
+						Start:        first(time.Parse(time.RFC3339, "2022-09-03T12:30:00Z")),
+						Finish:       first(time.Parse(time.RFC3339, "2022-09-03T13:30:00Z")),
+					},
+				},
+			}
+			got, err := s.BookFreeSlot(tt.args.event, tt.args.begin, tt.args.duration, tt.args.validUntil, internal.SlotOptions{})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("BookFreeSlot() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			if !got.Start.Equal(tt.wantStart) || got.Finish.Sub(got.Start) != tt.args.duration {
+				t.Errorf("BookFreeSlot() = %v - %v, want start %v", got.Start, got.Finish, tt.wantStart)
+			}
+			if _, ok := s.events[got.ID]; ok != tt.wantStored {
+				t.Errorf("BookFreeSlot() stored = %v, want %v", ok, tt.wantStored)
+			}
+		})
+	}
+}
+
+func Test_storage_FindConflicts(t *testing.T) {
+	s := &storage{
+		users: map[string]internal.User{"u-1": {ID: "u-1"}, "u-2": {ID: "u-2"}},
+		events: map[string]internal.Event{
+			"e-1": {
+				ID:           "e-1",
+				Participants: []string{"u-1"},
+				Start:        first(time.Parse(time.RFC3339, "2022-09-02T10:00:00Z")),
+				Finish:       first(time.Parse(time.RFC3339, "2022-09-02T11:00:00Z")),
+				RepeatType:   internal.Weekly,
+			},
+		},
+	}
+	horizon := first(time.Parse(time.RFC3339, "2022-10-01T00:00:00Z"))
+	tests := []struct {
+		name  string
+		event internal.Event
+		users []string
+		want  []internal.Conflict
+	}{
+		{
+			name: "No conflicts",
+			event: internal.Event{
+				ID:     "new",
+				Start:  first(time.Parse(time.RFC3339, "2022-09-02T11:00:00Z")),
+				Finish: first(time.Parse(time.RFC3339, "2022-09-02T12:00:00Z")),
+			},
+			users: []string{"u-1", "u-2"},
+		},
+		{
+			name: "Other weekday of weekly event",
+			event: internal.Event{
+				ID:     "new",
+				Start:  first(time.Parse(time.RFC3339, "2022-09-05T10:30:00Z")),
+				Finish: first(time.Parse(time.RFC3339, "2022-09-05T11:30:00Z")),
+			},
+			users: []string{"u-1", "u-2"},
+		},
+		{
+			name: "Overlap with later repetition",
+			event: internal.Event{
+				ID:     "new",
+				Start:  first(time.Parse(time.RFC3339, "2022-09-16T10:30:00Z")),
+				Finish: first(time.Parse(time.RFC3339, "2022-09-16T11:30:00Z")),
+			},
+			users: []string{"u-1", "u-2", "u-3"},
+			want: []internal.Conflict{{
+				User:   "u-1",
+				Event:  "e-1",
+				Start:  first(time.Parse(time.RFC3339, "2022-09-16T10:00:00Z")),
+				Finish: first(time.Parse(time.RFC3339, "2022-09-16T11:00:00Z")),
+			}},
+		},
+		{
+			name: "Event itself is not a conflict",
+			event: internal.Event{
+				ID:     "e-1",
+				Start:  first(time.Parse(time.RFC3339, "2022-09-02T10:00:00Z")),
+				Finish: first(time.Parse(time.RFC3339, "2022-09-02T11:00:00Z")),
+			},
+			users: []string{"u-1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.FindConflicts(tt.event, tt.users, horizon)
+			if err != nil {
+				t.Errorf("FindConflicts() error = %v", err)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FindConflicts() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_storage_AddEventStrict(t *testing.T) {
+	s := &storage{
+		users: map[string]internal.User{"u-1": {ID: "u-1"}},
+		events: map[string]internal.Event{
+			"e-1": {
+				ID:           "e-1",
+				Participants: []string{"u-1"},
+				Start:        first(time.Parse(time.RFC3339, "2022-09-02T10:00:00Z")),
+				Finish:       first(time.Parse(time.RFC3339, "2022-09-02T11:00:00Z")),
+			},
+		},
+	}
+	horizon := first(time.Parse(time.RFC3339, "2022-10-01T00:00:00Z"))
+	busy := internal.Event{
+		ID:           "busy",
+		Participants: []string{"u-1"},
+		Start:        first(time.Parse(time.RFC3339, "2022-09-01T10:00:00Z")),
+		Finish:       first(time.Parse(time.RFC3339, "2022-09-01T11:00:00Z")),
+		RepeatType:   internal.Daily,
+	}
+	if err := s.AddEventStrict(busy, horizon); err == nil {
+		t.Errorf("AddEventStrict() error = %v, wantErr %v", err, true)
+	}
+	if _, ok := s.events["busy"]; ok {
+		t.Errorf("AddEventStrict() stored conflicting event")
+	}
+	busy.RepeatType = internal.Once
+	if err := s.AddEventStrict(busy, horizon); err != nil {
+		t.Errorf("AddEventStrict() error = %v, wantErr %v", err, false)
+	}
+}
+
+func Test_storage_DeactivateUser(t *testing.T) {
+	s := New()
+	s.users = map[string]internal.User{"u-1": {ID: "u-1"}, "u-2": {ID: "u-2"}}
+	now := first(time.Parse(time.RFC3339, "2022-09-02T12:00:00Z"))
+	s.events = map[string]internal.Event{
+		"past": {
+			ID:           "past",
+			Participants: []string{"u-1", "u-2"},
+			Start:        first(time.Parse(time.RFC3339, "2022-09-02T10:00:00Z")),
+			Finish:       first(time.Parse(time.RFC3339, "2022-09-02T11:00:00Z")),
+		},
+		"future": {
+			ID:           "future",
+			Participants: []string{"u-2"},
+			Candidates:   []string{"u-1"},
+			Start:        first(time.Parse(time.RFC3339, "2022-09-03T10:00:00Z")),
+			Finish:       first(time.Parse(time.RFC3339, "2022-09-03T11:00:00Z")),
+		},
+		"repeated": {
+			ID:           "repeated",
+			Participants: []string{"u-1", "u-2"},
+			Start:        first(time.Parse(time.RFC3339, "2022-09-01T10:00:00Z")),
+			Finish:       first(time.Parse(time.RFC3339, "2022-09-01T11:00:00Z")),
+			RepeatType:   internal.Daily,
+		},
+	}
+	if err := s.DeactivateUser("u-3", now); err == nil {
+		t.Errorf("DeactivateUser() error = %v, wantErr %v", err, true)
+	}
+	if err := s.DeactivateUser("u-1", now); err != nil {
+		t.Fatalf("DeactivateUser() error = %v, wantErr %v", err, false)
+	}
+	if !s.users["u-1"].Deactivated {
+		t.Errorf("DeactivateUser() user isn't deactivated")
+	}
+	wantAttendees := map[string][]string{
+		"past":     {"u-1", "u-2"},
+		"future":   {"u-2"},
+		"repeated": {"u-2"},
+	}
+	for id, want := range wantAttendees {
+		event := s.events[id]
+		if got := append(event.Participants, event.Candidates...); !reflect.DeepEqual(got, want) {
+			t.Errorf("DeactivateUser() attendees of %s = %v, want %v", id, got, want)
+		}
+	}
+}
+
+func Test_storage_ListUsers(t *testing.T) {
+	s := &storage{users: map[string]internal.User{
+		"u-1": {ID: "u-1", Info: internal.CustomUserInfo{Name: "Ivan Petrov", Email: "ivan@example.com"}},
+		"u-2": {ID: "u-2", Info: internal.CustomUserInfo{Name: "anna Smirnova", Email: "anna@example.com"}},
+		"u-3": {ID: "u-3", Info: internal.CustomUserInfo{Name: "Petr Ivanov", Email: "petr@example.com"}, Deactivated: true},
+		"u-4": {ID: "u-4", Info: internal.CustomUserInfo{Name: "Boris", Email: "director@example.com"}},
+	}}
+	tests := []struct {
+		name               string
+		query              string
+		includeDeactivated bool
+		want               []string
+	}{
+		{name: "All active users sorted by name", want: []string{"u-2", "u-4", "u-1"}},
+		{name: "All users", includeDeactivated: true, want: []string{"u-2", "u-4", "u-1", "u-3"}},
+		{name: "Prefix of name", query: "iv", includeDeactivated: true, want: []string{"u-1", "u-3"}},
+		{name: "Word of name", query: "SMIR", want: []string{"u-2"}},
+		{name: "Email", query: "director@", want: []string{"u-4"}},
+		{name: "Nothing found", query: "xyz", want: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := []string{}
+			for _, user := range s.ListUsers(tt.query, tt.includeDeactivated) {
+				got = append(got, user.ID)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ListUsers() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_storage_Groups(t *testing.T) {
+	s := New()
+	s.users = map[string]internal.User{
+		"u-1": {ID: "u-1"},
+		"u-2": {ID: "u-2"},
+		"u-3": {ID: "u-3", Deactivated: true},
+	}
+	if err := s.AddGroup(internal.Group{ID: "g-1", Members: []string{"u-4"}}); err == nil || err.Error() != "unexisted member" {
+		t.Errorf("AddGroup() error = %v, want unexisted member", err)
+	}
+	if err := s.AddGroup(internal.Group{ID: "g-1", Members: []string{"u-2", "u-3"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddGroup(internal.Group{ID: "g-2", Members: []string{"u-1", "g-1", "u-2"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.UpdateGroup(internal.Group{ID: "g-1", Members: []string{"g-2"}}); err == nil || err.Error() != "group cycle" {
+		t.Errorf("UpdateGroup() error = %v, want group cycle", err)
+	}
+	if err := s.UpdateGroup(internal.Group{ID: "g-1", Members: []string{"g-1"}}); err == nil || err.Error() != "group cycle" {
+		t.Errorf("UpdateGroup() error = %v, want group cycle", err)
+	}
+
+	tests := []struct {
+		name    string
+		group   string
+		want    []string
+		wantErr bool
+	}{
+		{name: "Deactivated users are skipped", group: "g-1", want: []string{"u-2"}},
+		{name: "Nested groups are expanded once", group: "g-2", want: []string{"u-1", "u-2"}},
+		{name: "Unexisted group", group: "u-1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.ExpandGroup(tt.group)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ExpandGroup() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ExpandGroup() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if err := s.DeleteGroup("g-1"); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.groups["g-2"].Members; !reflect.DeepEqual(got, []string{"u-1", "u-2"}) {
+		t.Errorf("DeleteGroup() members of parent = %v, want %v", got, []string{"u-1", "u-2"})
+	}
+}
+
+func Test_storage_Calendars(t *testing.T) {
+	s := New()
+	s.users = map[string]internal.User{"u-1": {ID: "u-1"}, "u-2": {ID: "u-2"}}
+	if err := s.AddCalendar(internal.Calendar{ID: "c-0", Owner: "u-3"}); err == nil || err.Error() != "unexisted owner" {
+		t.Errorf("AddCalendar() error = %v, want unexisted owner", err)
+	}
+	if err := s.AddCalendar(internal.Calendar{ID: "c-1", Owner: "u-1", Info: internal.CustomCalendarInfo{Name: "on-call", Transparent: true}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddCalendar(internal.Calendar{ID: "c-2", Owner: "u-1", Info: internal.CustomCalendarInfo{Name: "home"}}); err != nil {
+		t.Fatal(err)
+	}
+	start := first(time.Parse(time.RFC3339, "2022-09-05T10:00:00Z"))
+	s.events = map[string]internal.Event{
+		"e-1": {
+			ID:           "e-1",
+			Participants: []string{"u-1", "u-2"},
+			Start:        start,
+			Finish:       start.Add(time.Hour),
+			Calendar:     "c-1",
+		},
+	}
+
+	tests := []struct {
+		name  string
+		users []string
+		want  time.Time
+	}{
+		{name: "Event of transparent calendar doesn't make owner busy", users: []string{"u-1"}, want: start},
+		{name: "Event of someone's transparent calendar makes participant busy", users: []string{"u-2"}, want: start.Add(time.Hour)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.FindFreeSlot(tt.users, start, time.Hour, start.Add(24*time.Hour), internal.SlotOptions{})
+			if err != nil || !got.Equal(tt.want) {
+				t.Errorf("FindFreeSlot() = %v, %v, want %v", got, err, tt.want)
+			}
+		})
+	}
+
+	var names []string
+	for _, calendar := range s.ListCalendars("u-1") {
+		names = append(names, calendar.Info.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"home", "on-call"}) {
+		t.Errorf("ListCalendars() = %v, want %v", names, []string{"home", "on-call"})
+	}
+	events, err := s.GetCalendarEvents("c-1", start, start.Add(time.Hour))
+	if err != nil || len(events) != 1 {
+		t.Errorf("GetCalendarEvents() = %v, %v, want 1 event", events, err)
+	}
+	if err := s.DeleteCalendar("c-1"); err != nil {
+		t.Fatal(err)
+	}
+	if s.events["e-1"].Calendar != "" {
+		t.Errorf("DeleteCalendar() left event in calendar %v", s.events["e-1"].Calendar)
+	}
+	if _, err := s.GetCalendarEvents("c-1", start, start.Add(time.Hour)); err == nil {
+		t.Errorf("GetCalendarEvents() of deleted calendar error = %v, wantErr %v", err, true)
+	}
+}
+
+func Test_storage_TeamCalendars(t *testing.T) {
+	s := New()
+	s.users = map[string]internal.User{"u-1": {ID: "u-1"}, "u-2": {ID: "u-2"}, "u-3": {ID: "u-3"}}
+	s.groups = map[string]internal.Group{"g-1": {ID: "g-1", Members: []string{"u-1", "u-2"}}}
+	if err := s.AddCalendar(internal.Calendar{ID: "c-1", Owner: "g-1", Info: internal.CustomCalendarInfo{Name: "on-call", BusyForMembers: true}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddCalendar(internal.Calendar{ID: "c-2", Owner: "u-1", Info: internal.CustomCalendarInfo{Name: "home"}}); err != nil {
+		t.Fatal(err)
+	}
+	start := first(time.Parse(time.RFC3339, "2022-09-05T10:00:00Z"))
+	s.events = map[string]internal.Event{
+		"e-1": {
+			ID:           "e-1",
+			Participants: []string{"u-3"},
+			Start:        start,
+			Finish:       start.Add(time.Hour),
+			Calendar:     "c-1",
+		},
+	}
+
+	tests := []struct {
+		name  string
+		users []string
+		want  time.Time
+	}{
+		{name: "Event of team calendar makes member busy", users: []string{"u-2"}, want: start.Add(time.Hour)},
+		{name: "Participant of event in team calendar is busy", users: []string{"u-3"}, want: start.Add(time.Hour)},
+		{name: "Not member is free", users: []string{"u-4"}, want: start},
+	}
+	s.users["u-4"] = internal.User{ID: "u-4"}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.FindFreeSlot(tt.users, start, time.Hour, start.Add(24*time.Hour), internal.SlotOptions{})
+			if err != nil || !got.Equal(tt.want) {
+				t.Errorf("FindFreeSlot() = %v, %v, want %v", got, err, tt.want)
+			}
+		})
+	}
+
+	if got := s.MemberGroups("u-2"); !reflect.DeepEqual(got, []string{"g-1"}) {
+		t.Errorf("MemberGroups() = %v, want %v", got, []string{"g-1"})
+	}
+	var names []string
+	for _, calendar := range s.ListCalendars("u-1", "g-1") {
+		names = append(names, calendar.Info.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"home", "on-call"}) {
+		t.Errorf("ListCalendars() = %v, want %v", names, []string{"home", "on-call"})
+	}
+}
+
+func Test_storage_GetAuditRecords(t *testing.T) {
+	s := New()
+	start := first(time.Parse(time.RFC3339, "2022-09-05T10:00:00Z"))
+	for i, record := range []internal.AuditRecord{
+		{Actor: "u-1", Action: internal.ActionCreateEvent, Target: "e-1"},
+		{Actor: "u-2", Action: internal.ActionAcceptInvitation, Target: "e-1"},
+		{Action: internal.ActionUpdateUser, Target: "u-1"},
+		{Action: internal.ActionCancelEvent, Target: "e-1"},
+	} {
+		record.Time = start.Add(time.Duration(i) * time.Hour)
+		s.AddAuditRecord(record)
+	}
+
+	tests := []struct {
+		name   string
+		user   string
+		target string
+		begin  time.Time
+		end    time.Time
+		want   []internal.AuditAction
+	}{
+		{
+			name: "All records",
+			want: []internal.AuditAction{internal.ActionCreateEvent, internal.ActionAcceptInvitation, internal.ActionUpdateUser, internal.ActionCancelEvent},
+		},
+		{name: "Made by or of the user", user: "u-1", want: []internal.AuditAction{internal.ActionCreateEvent, internal.ActionUpdateUser}},
+		{name: "Of the event by the user", user: "u-2", target: "e-1", want: []internal.AuditAction{internal.ActionAcceptInvitation}},
+		{
+			name:   "Within the interval",
+			target: "e-1",
+			begin:  start.Add(time.Hour),
+			end:    start.Add(3 * time.Hour),
+			want:   []internal.AuditAction{internal.ActionAcceptInvitation},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []internal.AuditAction
+			for _, record := range s.GetAuditRecords(tt.user, tt.target, tt.begin, tt.end) {
+				got = append(got, record.Action)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetAuditRecords() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_storage_EventRevisions(t *testing.T) {
+	s := New()
+	start := first(time.Parse(time.RFC3339, "2022-09-05T10:00:00Z"))
+	event := internal.Event{ID: "e-1", Participants: []string{"u-1"}, Candidates: []string{"u-2", "u-3"}, Start: start, Finish: start.Add(time.Hour)}
+	if err := s.AddEvent(event); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Accept("u-2", "e-1", internal.AnyVersion); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CancelEvent("e-1", internal.AnyVersion); err != nil {
+		t.Fatal(err)
+	}
+	revisions, err := s.GetEventRevisions("e-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revisions) != 3 || !revisions[2].Cancelled {
+		t.Fatalf("GetEventRevisions() = %v, want created, accepted and cancelled revisions", revisions)
+	}
+	if !reflect.DeepEqual(revisions[0].Event.Candidates, []string{"u-2", "u-3"}) {
+		t.Errorf("candidates of the first revision = %v, want %v", revisions[0].Event.Candidates, []string{"u-2", "u-3"})
+	}
+
+	if _, err := s.RestoreEvent("e-1", 3, internal.AnyVersion); err == nil || err.Error() != "wrong revision" {
+		t.Errorf("RestoreEvent() of cancellation error = %v, want wrong revision", err)
+	}
+	if _, err := s.RestoreEvent("e-1", 4, internal.AnyVersion); err == nil || err.Error() != "unexisted revision" {
+		t.Errorf("RestoreEvent() of unexisted revision error = %v, want unexisted revision", err)
+	}
+	restored, err := s.RestoreEvent("e-1", 1, internal.AnyVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.GetEvent("e-1"); err != nil || !reflect.DeepEqual(got, restored) || !reflect.DeepEqual(got.Candidates, []string{"u-2", "u-3"}) {
+		t.Errorf("GetEvent() after restore = %v, %v, want %v", got, err, restored)
+	}
+	if revisions, _ := s.GetEventRevisions("e-1"); len(revisions) != 4 || revisions[3].Number != 4 {
+		t.Errorf("GetEventRevisions() after restore = %v, want 4 revisions", revisions)
+	}
+	if _, err := s.GetEventRevisions("e-2"); err == nil || err.Error() != "unexisted event" {
+		t.Errorf("GetEventRevisions() of unexisted event error = %v, want unexisted event", err)
+	}
+}
+
+func Test_storage_EventRevisions_retention(t *testing.T) {
+	s := New(WithRevisionRetention(time.Hour))
+	start := first(time.Parse(time.RFC3339, "2022-09-05T10:00:00Z"))
+	event := internal.Event{ID: "e-1", Participants: []string{"u-1"}, Candidates: []string{"u-2", "u-3"}, Start: start, Finish: start.Add(time.Hour)}
+	if err := s.AddEvent(event); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Accept("u-2", "e-1", internal.AnyVersion); err != nil {
+		t.Fatal(err)
+	}
+	for idx := range s.revisions["e-1"] {
+		s.revisions["e-1"][idx].Time = time.Now().Add(-2 * time.Hour)
+	}
+	if revisions, _ := s.GetEventRevisions("e-1"); len(revisions) != 1 || revisions[0].Number != 2 {
+		t.Errorf("GetEventRevisions() after retention = %v, want the last revision only", revisions)
+	}
+	if _, err := s.RestoreEvent("e-1", 1, internal.AnyVersion); err == nil || err.Error() != "unexisted revision" {
+		t.Errorf("RestoreEvent() of purged revision error = %v, want unexisted revision", err)
+	}
+	if err := s.Accept("u-3", "e-1", 2); err != nil {
+		t.Fatalf("Accept() with the version of the last kept revision error = %v", err)
+	}
+	if revisions, _ := s.GetEventRevisions("e-1"); len(revisions) != 1 || revisions[0].Number != 3 {
+		t.Errorf("GetEventRevisions() after change = %v, want revision 3 only", revisions)
+	}
+	if restored, err := s.RestoreEvent("e-1", 3, 3); err != nil || restored.Version != 4 {
+		t.Errorf("RestoreEvent() = %v, %v, want version 4", restored, err)
+	}
+}
+
+func Test_storage_EventVersions(t *testing.T) {
+	s := New()
+	start := first(time.Parse(time.RFC3339, "2022-09-05T10:00:00Z"))
+	event := internal.Event{ID: "e-1", Participants: []string{"u-1"}, Candidates: []string{"u-2", "u-3"}, Start: start, Finish: start.Add(time.Hour)}
+	if err := s.AddEvent(event); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := s.GetEvent("e-1"); got.Version != 1 {
+		t.Errorf("version of new event = %d, want 1", got.Version)
+	}
+	if err := s.Accept("u-2", "e-1", 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Reject("u-3", "e-1", 1); err == nil || err.Error() != "version mismatch" {
+		t.Errorf("Reject() of outdated version error = %v, want version mismatch", err)
+	}
+	if got, _ := s.GetEvent("e-1"); got.Version != 2 || !got.IsAttendee("u-3") {
+		t.Errorf("GetEvent() = %v, want version 2 with u-3 invited", got)
+	}
+	if err := s.CancelEvent("e-1", 2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.RestoreEvent("e-1", 2, 2); err == nil || err.Error() != "version mismatch" {
+		t.Errorf("RestoreEvent() of outdated version error = %v, want version mismatch", err)
+	}
+	if restored, err := s.RestoreEvent("e-1", 2, 3); err != nil || restored.Version != 4 {
+		t.Errorf("RestoreEvent() = %v, %v, want version 4", restored, err)
+	}
+}
+
+func Test_storage_GetInvitations(t *testing.T) {
+	s := New()
+	for _, id := range []string{"u-1", "u-2"} {
+		if err := s.AddUser(internal.User{ID: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	start := first(time.Parse(time.RFC3339, "2022-09-05T10:00:00Z"))
+	event := internal.Event{ID: "e-1", Participants: []string{"u-1"}, Candidates: []string{"u-2"}, Start: start, Finish: start.Add(time.Hour), RepeatType: internal.Daily}
+	if err := s.AddEvent(event); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.GetInvitations("u-2", start, start.Add(48*time.Hour)); err != nil || len(got) != 2 {
+		t.Errorf("GetInvitations() = %v, %v, want 2 occurrences", got, err)
+	}
+	if got, err := s.GetInvitations("u-1", start, start.Add(48*time.Hour)); err != nil || len(got) != 0 {
+		t.Errorf("GetInvitations() of participant = %v, %v, want none", got, err)
+	}
+	if err := s.Accept("u-2", "e-1", internal.AnyVersion); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := s.GetInvitations("u-2", start, start.Add(48*time.Hour)); len(got) != 0 {
+		t.Errorf("GetInvitations() after acceptance = %v, want none", got)
+	}
+	if _, err := s.GetInvitations("u-3", start, start.Add(time.Hour)); err == nil || err.Error() != "unexisted user" {
+		t.Errorf("GetInvitations() of unknown user error = %v, want unexisted user", err)
+	}
+}
+
+// Test_storage_readsWithNewUsers reads events while users are added, it fails under the race detector
+// if users are read without the lock.
+func Test_storage_readsWithNewUsers(t *testing.T) {
+	s := New()
+	if err := s.AddUser(internal.User{ID: "u-0"}); err != nil {
+		t.Fatal(err)
+	}
+	start := first(time.Parse(time.RFC3339, "2022-09-05T10:00:00Z"))
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 1; i <= 100; i++ {
+			if err := s.AddUser(internal.User{ID: "u-" + strconv.Itoa(i)}); err != nil {
+				t.Error(err)
+			}
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		if _, err := s.GetEvents("u-0", start, start.Add(time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.GetInvitations("u-0", start, start.Add(time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.GetChanges("u-0", 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wg.Wait()
+}
+
 //TODO: Add tests.
+
+func Test_storage_MarkReminderFired(t *testing.T) {
+	s := New()
+	start := first(time.Parse(time.RFC3339, "2022-09-05T10:00:00Z"))
+	if fired, _ := s.MarkReminderFired("e-1|past", start); !fired {
+		t.Errorf("MarkReminderFired() of new reminder = false, want true")
+	}
+	if fired, _ := s.MarkReminderFired("e-1|past", start); fired {
+		t.Errorf("MarkReminderFired() of fired reminder = true, want false")
+	}
+	if _, err := s.MarkReminderFired("e-1|future", start.Add(24*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetReminderWatermark(start.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.firedReminders["e-1|past"]; ok {
+		t.Errorf("reminder of past occurrence is kept after the watermark")
+	}
+	if _, ok := s.firedReminders["e-1|future"]; !ok {
+		t.Errorf("reminder of future occurrence is pruned")
+	}
+}
+
+func Test_storage_Reject(t *testing.T) {
+	s := New()
+	start := first(time.Parse(time.RFC3339, "2022-09-05T10:00:00Z"))
+	event := internal.Event{ID: "e-1", Participants: []string{"u-1", "u-2"}, Candidates: []string{"u-3"}, Start: start, Finish: start.Add(time.Hour)}
+	if err := s.AddEvent(event); err != nil {
+		t.Fatal(err)
+	}
+	for _, user := range []string{"u-2", "u-3"} {
+		if err := s.Reject(user, "e-1", internal.AnyVersion); err != nil {
+			t.Errorf("Reject() of %s error = %v", user, err)
+		}
+	}
+	if got, _ := s.GetEvent("e-1"); !reflect.DeepEqual(got.Participants, []string{"u-1"}) || len(got.Candidates) != 0 {
+		t.Errorf("GetEvent() after reject = %v, want u-1 only", got)
+	}
+	if err := s.Reject("u-3", "e-1", internal.AnyVersion); err == nil || err.Error() != "unexisted user in event" {
+		t.Errorf("Reject() of not invited user error = %v, want unexisted user in event", err)
+	}
+}
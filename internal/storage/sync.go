@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"errors"
+	"time"
+
+	"github.com/nivanov045/calendar/internal"
+)
+
+type eventSequence struct {
+	created  uint64 //number of the change which created the event
+	modified uint64 //number of the last change of the event
+}
+
+type tombstone struct {
+	event    string    //id of removed event
+	users    []string  //users who lost the event
+	sequence uint64    //number of the removing change
+	time     time.Time //moment of removing
+}
+
+// touch marks the event as changed by a new change and keeps its new revision. Must be called under eventsMutex.
+func (s *storage) touch(event string, created bool) {
+	if s.eventSequences == nil {
+		s.eventSequences = map[string]eventSequence{}
+	}
+	s.sequence++
+	curSequence := s.eventSequences[event]
+	if created {
+		curSequence.created = s.sequence
+	}
+	curSequence.modified = s.sequence
+	s.eventSequences[event] = curSequence
+	s.revise(s.events[event], false)
+	current := s.events[event]
+	current.Version = s.version(event)
+	s.events[event] = current
+}
+
+// bury remembers that the users lost the event. Must be called under eventsMutex.
+func (s *storage) bury(event internal.Event, users []string) {
+	s.sequence++
+	if _, ok := s.events[event.ID]; !ok {
+		delete(s.eventSequences, event.ID)
+	}
+	s.tombstones = append(s.tombstones, tombstone{
+		event:    event.ID,
+		users:    users,
+		sequence: s.sequence,
+		time:     time.Now(),
+	})
+}
+
+// purgeTombstones forgets tombstones older than retention. Must be called under eventsMutex.
+func (s *storage) purgeTombstones(now time.Time) {
+	if s.tombstoneRetention <= 0 {
+		return
+	}
+	idx := 0
+	for idx < len(s.tombstones) && now.Sub(s.tombstones[idx].time) > s.tombstoneRetention {
+		s.purgedSequence = s.tombstones[idx].sequence
+		idx++
+	}
+	s.tombstones = s.tombstones[idx:]
+}
+
+// GetChanges returns the user's events changed after the change with number since. Zero since returns all events.
+func (s *storage) GetChanges(user string, since uint64) (internal.SyncChanges, error) {
+	s.eventsMutex.Lock()
+	defer s.eventsMutex.Unlock()
+	s.usersMutex.RLock()
+	userExists := s.isUserExist(user)
+	s.usersMutex.RUnlock()
+	if !userExists {
+		return internal.SyncChanges{}, errors.New("unexisted user")
+	}
+	s.purgeTombstones(time.Now())
+	//a token ahead of the sequence was issued before a restart
+	if since > s.sequence || since != 0 && since < s.purgedSequence {
+		return internal.SyncChanges{}, errors.New("sync token expired")
+	}
+	result := internal.SyncChanges{
+		Created:  []internal.Event{},
+		Modified: []internal.Event{},
+		Deleted:  []string{},
+		Sequence: s.sequence,
+	}
+	for id, curEvent := range s.events {
+		if !curEvent.IsAttendee(user) {
+			continue
+		}
+		curSequence := s.eventSequences[id]
+		if curSequence.created > since {
+			result.Created = append(result.Created, curEvent)
+		} else if curSequence.modified > since {
+			result.Modified = append(result.Modified, curEvent)
+		}
+	}
+	if since == 0 {
+		return result, nil
+	}
+	for _, curTombstone := range s.tombstones {
+		if curTombstone.sequence <= since {
+			continue
+		}
+		if _, ok := s.events[curTombstone.event]; ok && s.events[curTombstone.event].IsAttendee(user) {
+			continue
+		}
+		for _, lostUser := range curTombstone.users {
+			if lostUser == user {
+				result.Deleted = append(result.Deleted, curTombstone.event)
+				break
+			}
+		}
+	}
+	return result, nil
+}
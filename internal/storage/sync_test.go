@@ -0,0 +1,137 @@
+package storage
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/nivanov045/calendar/internal"
+)
+
+func ids(events []internal.Event) []string {
+	result := []string{}
+	for _, curEvent := range events {
+		result = append(result, curEvent.ID)
+	}
+	sort.Strings(result)
+	return result
+}
+
+func Test_storage_GetChanges(t *testing.T) {
+	s := New()
+	for _, user := range []string{"u-1", "u-2"} {
+		if err := s.AddUser(internal.User{ID: user}); err != nil {
+			t.Fatalf("AddUser() error = %v", err)
+		}
+	}
+	addEvent := func(id string) {
+		err := s.AddEvent(internal.Event{ID: id, Participants: []string{"u-1"}, Candidates: []string{"u-2"}})
+		if err != nil {
+			t.Fatalf("AddEvent() error = %v", err)
+		}
+	}
+	addEvent("e-1")
+	addEvent("e-2")
+	full, err := s.GetChanges("u-2", 0)
+	if err != nil {
+		t.Fatalf("GetChanges() error = %v", err)
+	}
+	if got, want := ids(full.Created), []string{"e-1", "e-2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("GetChanges() full sync created = %v, want %v", got, want)
+	}
+	addEvent("e-3")
+	if err := s.Accept("u-2", "e-1", internal.AnyVersion); err != nil {
+		t.Fatalf("Accept() error = %v", err)
+	}
+	if err := s.CancelEvent("e-2", internal.AnyVersion); err != nil {
+		t.Fatalf("CancelEvent() error = %v", err)
+	}
+	tests := []struct {
+		name         string
+		user         string
+		since        uint64
+		wantCreated  []string
+		wantModified []string
+		wantDeleted  []string
+		wantErr      bool
+	}{
+		{
+			name:         "Changes after full sync",
+			user:         "u-2",
+			since:        full.Sequence,
+			wantCreated:  []string{"e-3"},
+			wantModified: []string{"e-1"},
+			wantDeleted:  []string{"e-2"},
+		},
+		{
+			name:         "Full sync",
+			user:         "u-1",
+			since:        0,
+			wantCreated:  []string{"e-1", "e-3"},
+			wantModified: []string{},
+			wantDeleted:  []string{},
+		},
+		{
+			name:    "Token from the future",
+			user:    "u-1",
+			since:   100,
+			wantErr: true,
+		},
+		{
+			name:    "Unexisted user",
+			user:    "u-3",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.GetChanges(tt.user, tt.since)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetChanges() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			sort.Strings(got.Deleted)
+			if !reflect.DeepEqual(ids(got.Created), tt.wantCreated) ||
+				!reflect.DeepEqual(ids(got.Modified), tt.wantModified) ||
+				!reflect.DeepEqual(got.Deleted, tt.wantDeleted) {
+				t.Errorf("GetChanges() = %v %v %v, want %v %v %v", ids(got.Created), ids(got.Modified), got.Deleted,
+					tt.wantCreated, tt.wantModified, tt.wantDeleted)
+			}
+		})
+	}
+}
+
+func Test_storage_GetChanges_rejectAndExpire(t *testing.T) {
+	s := New(WithTombstoneRetention(time.Hour))
+	if err := s.AddUser(internal.User{ID: "u-1"}); err != nil {
+		t.Fatalf("AddUser() error = %v", err)
+	}
+	if err := s.AddEvent(internal.Event{ID: "e-1", Candidates: []string{"u-1"}}); err != nil {
+		t.Fatalf("AddEvent() error = %v", err)
+	}
+	before, _ := s.GetChanges("u-1", 0)
+	if err := s.Reject("u-1", "e-1", internal.AnyVersion); err != nil {
+		t.Fatalf("Reject() error = %v", err)
+	}
+	got, err := s.GetChanges("u-1", before.Sequence)
+	if err != nil {
+		t.Fatalf("GetChanges() error = %v", err)
+	}
+	if !reflect.DeepEqual(got.Deleted, []string{"e-1"}) || len(got.Modified) != 0 {
+		t.Errorf("GetChanges() after reject = %v, want e-1 deleted", got)
+	}
+	s.tombstones[0].time = time.Now().Add(-2 * time.Hour)
+	if _, err := s.GetChanges("u-1", before.Sequence); err == nil || err.Error() != "sync token expired" {
+		t.Errorf("GetChanges() with purged tombstone error = %v, want sync token expired", err)
+	}
+	if _, err := s.GetChanges("u-1", got.Sequence); err != nil {
+		t.Errorf("GetChanges() with fresh token error = %v", err)
+	}
+	if _, err := s.GetChanges("u-1", got.Sequence+1); err == nil || err.Error() != "sync token expired" {
+		t.Errorf("GetChanges() with token from before a restart error = %v, want sync token expired", err)
+	}
+}
@@ -0,0 +1,88 @@
+// Package tenant resolves organizations sharing the server from API keys of their clients.
+package tenant
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"time"
+
+	"github.com/nivanov045/calendar/internal"
+)
+
+type Entry struct {
+	internal.Organization
+	APIKeys []string `json:"api_keys"` //keys of clients acting on behalf of the organization
+}
+
+type registry struct {
+	organizations map[string]internal.Organization //organizations by API key
+}
+
+// New returns the registry of organizations. Ids and API keys have to be unique.
+func New(entries []Entry) (*registry, error) {
+	r := &registry{organizations: map[string]internal.Organization{}}
+	ids := map[string]bool{}
+	for _, entry := range entries {
+		if entry.ID == "" || ids[entry.ID] {
+			return nil, errors.New("wrong organization id")
+		}
+		ids[entry.ID] = true
+		if entry.Settings.TimeZone != "" {
+			if _, err := time.LoadLocation(entry.Settings.TimeZone); err != nil {
+				return nil, err
+			}
+		}
+		for _, key := range entry.APIKeys {
+			if _, ok := r.organizations[key]; ok || key == "" {
+				return nil, errors.New("wrong api key")
+			}
+			r.organizations[key] = entry.Organization
+		}
+	}
+	return r, nil
+}
+
+// Load reads the registry from the JSON file with the list of entries.
+func Load(path string) (*registry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var entries []Entry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+	return New(entries)
+}
+
+// Authenticate returns the organization of the API key.
+func (r *registry) Authenticate(key string) (internal.Organization, error) {
+	organization, ok := r.organizations[key]
+	if !ok {
+		return internal.Organization{}, errors.New("unauthorized")
+	}
+	return organization, nil
+}
+
+// KeyID returns the identifier of the API key which can be logged instead of the key itself.
+func KeyID(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return "key:" + hex.EncodeToString(sum[:6])
+}
+
+type contextKey struct{}
+
+// NewContext returns the context of a request made on behalf of the organization.
+func NewContext(ctx context.Context, organization internal.Organization) context.Context {
+	return context.WithValue(ctx, contextKey{}, organization)
+}
+
+// FromContext returns the organization of the request, false for servers with a single organization.
+func FromContext(ctx context.Context) (internal.Organization, bool) {
+	organization, ok := ctx.Value(contextKey{}).(internal.Organization)
+	return organization, ok
+}
@@ -0,0 +1,64 @@
+package tenant
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nivanov045/calendar/internal"
+)
+
+func TestNew(t *testing.T) {
+	sales := internal.Organization{ID: "sales", Name: "Sales"}
+	tests := []struct {
+		name    string
+		entries []Entry
+		wantErr bool
+	}{
+		{name: "Unique ids and keys", entries: []Entry{{sales, []string{"k-1", "k-2"}}, {internal.Organization{ID: "hr"}, []string{"k-3"}}}},
+		{name: "Empty id", entries: []Entry{{internal.Organization{Name: "Sales"}, []string{"k-1"}}}, wantErr: true},
+		{name: "Duplicated id", entries: []Entry{{sales, []string{"k-1"}}, {sales, []string{"k-2"}}}, wantErr: true},
+		{name: "Duplicated key", entries: []Entry{{sales, []string{"k-1"}}, {internal.Organization{ID: "hr"}, []string{"k-1"}}}, wantErr: true},
+		{name: "Empty key", entries: []Entry{{sales, []string{""}}}, wantErr: true},
+		{
+			name:    "Unknown time zone",
+			entries: []Entry{{internal.Organization{ID: "hr", Settings: internal.OrganizationSettings{TimeZone: "Mars/Olympus"}}, nil}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(tt.entries); (err != nil) != tt.wantErr {
+				t.Errorf("New() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "organizations.json")
+	data := `[{"id": "sales", "name": "Sales", "settings": {"time_zone": "Europe/Berlin"}, "api_keys": ["k-1"]}]`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	r, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	organization, err := r.Authenticate("k-1")
+	if err != nil || organization.ID != "sales" || organization.Settings.TimeZone != "Europe/Berlin" {
+		t.Errorf("Authenticate() = %+v, %v", organization, err)
+	}
+	if _, err := r.Authenticate("k-2"); err == nil || err.Error() != "unauthorized" {
+		t.Errorf("Authenticate() of unknown key error = %v, want unauthorized", err)
+	}
+
+	ctx := NewContext(context.Background(), organization)
+	if got, ok := FromContext(ctx); !ok || got.ID != "sales" {
+		t.Errorf("FromContext() = %+v, %v", got, ok)
+	}
+	if _, ok := FromContext(context.Background()); ok {
+		t.Errorf("FromContext() of context without organization = %v, want false", ok)
+	}
+}
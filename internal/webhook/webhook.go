@@ -0,0 +1,207 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+
+	"github.com/nivanov045/calendar/internal"
+)
+
+// maxLogSize limits the number of deliveries kept in the delivery log and in dead letters.
+const maxLogSize = 1000
+
+// secretSize is the number of random bytes of generated secrets.
+const secretSize = 32
+
+type Subscription struct {
+	ID     string `json:"id,omitempty"`     //id
+	User   string `json:"user,omitempty"`   //user whose changes are delivered, all changes if empty
+	URL    string `json:"url"`              //receiver of payloads, required
+	Secret string `json:"secret,omitempty"` //key of HMAC signature of payloads, generated if empty
+}
+
+type Delivery struct {
+	ID           string          `json:"id"`                    //id, sent in X-Calendar-Delivery header
+	Subscription string          `json:"subscription"`          //subscription id
+	Change       internal.Change `json:"change"`                //delivered change
+	Attempts     int             `json:"attempts"`              //number of made attempts
+	Delivered    bool            `json:"delivered"`             //whether receiver accepted the payload
+	StatusCode   int             `json:"status_code,omitempty"` //last response status
+	Error        string          `json:"error,omitempty"`       //last error
+	Time         time.Time       `json:"time"`                  //moment of the last attempt
+}
+
+type dispatcher struct {
+	subscriptions      map[string]Subscription //subscriptions by id
+	subscriptionsMutex sync.RWMutex
+	deliveries         []Delivery //log of finished deliveries
+	deadLetters        []Delivery //last deliveries failed after all attempts
+	deliveriesMutex    sync.RWMutex
+	client             *http.Client
+	maxAttempts        int           //attempts before delivery goes to dead letters
+	backoff            time.Duration //delay before the first retry, doubled after every attempt
+	wg                 sync.WaitGroup
+}
+
+// New returns the dispatcher making up to maxAttempts attempts of every delivery, at least one.
+func New(maxAttempts int, backoff time.Duration) *dispatcher {
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	return &dispatcher{
+		subscriptions: map[string]Subscription{},
+		client:        &http.Client{Timeout: 10 * time.Second},
+		maxAttempts:   maxAttempts,
+		backoff:       backoff,
+	}
+}
+
+// Subscribe adds the subscription and returns it with the id and the secret, which is random if it isn't set.
+func (d *dispatcher) Subscribe(subscription Subscription) (Subscription, error) {
+	if subscription.URL == "" {
+		return Subscription{}, errors.New("empty url")
+	}
+	if subscription.Secret == "" {
+		secret := make([]byte, secretSize)
+		if _, err := rand.Read(secret); err != nil {
+			return Subscription{}, err
+		}
+		subscription.Secret = hex.EncodeToString(secret)
+	}
+	subscription.ID = uuid.New().String()
+	d.subscriptionsMutex.Lock()
+	defer d.subscriptionsMutex.Unlock()
+	d.subscriptions[subscription.ID] = subscription
+	return subscription, nil
+}
+
+func (d *dispatcher) Unsubscribe(id string) error {
+	d.subscriptionsMutex.Lock()
+	defer d.subscriptionsMutex.Unlock()
+	if _, ok := d.subscriptions[id]; !ok {
+		return errors.New("unexisted subscription")
+	}
+	delete(d.subscriptions, id)
+	return nil
+}
+
+// Deliveries returns the delivery log, of the subscription only if it isn't empty.
+func (d *dispatcher) Deliveries(subscription string) []Delivery {
+	d.deliveriesMutex.RLock()
+	defer d.deliveriesMutex.RUnlock()
+	return filterDeliveries(d.deliveries, subscription)
+}
+
+// DeadLetters returns deliveries failed after all attempts, of the subscription only if it isn't empty.
+func (d *dispatcher) DeadLetters(subscription string) []Delivery {
+	d.deliveriesMutex.RLock()
+	defer d.deliveriesMutex.RUnlock()
+	return filterDeliveries(d.deadLetters, subscription)
+}
+
+func filterDeliveries(deliveries []Delivery, subscription string) []Delivery {
+	result := []Delivery{}
+	for _, delivery := range deliveries {
+		if subscription == "" || delivery.Subscription == subscription {
+			result = append(result, delivery)
+		}
+	}
+	return result
+}
+
+// Notify sends the change in background to all matching subscriptions.
+func (d *dispatcher) Notify(change internal.Change) {
+	d.subscriptionsMutex.RLock()
+	defer d.subscriptionsMutex.RUnlock()
+	for _, subscription := range d.subscriptions {
+		if subscription.User != "" && !change.Concerns(subscription.User) {
+			continue
+		}
+		d.wg.Add(1)
+		go func(subscription Subscription) {
+			defer d.wg.Done()
+			d.deliver(subscription, change)
+		}(subscription)
+	}
+}
+
+func (d *dispatcher) deliver(subscription Subscription, change internal.Change) {
+	delivery := Delivery{
+		ID:           uuid.New().String(),
+		Subscription: subscription.ID,
+		Change:       change,
+	}
+	payload, err := json.Marshal(change)
+	if err != nil {
+		log.Error().Err(err).Stack()
+		return
+	}
+	delay := d.backoff
+	for delivery.Attempts < d.maxAttempts {
+		if delivery.Attempts > 0 {
+			time.Sleep(delay)
+			delay *= 2
+		}
+		delivery.Attempts++
+		delivery.Time = time.Now()
+		delivery.StatusCode, err = d.send(subscription, delivery.ID, change.Type, payload)
+		if err == nil {
+			delivery.Delivered = true
+			delivery.Error = ""
+			break
+		}
+		delivery.Error = err.Error()
+	}
+	d.deliveriesMutex.Lock()
+	defer d.deliveriesMutex.Unlock()
+	d.deliveries = append(d.deliveries, delivery)
+	if len(d.deliveries) > maxLogSize {
+		d.deliveries = d.deliveries[len(d.deliveries)-maxLogSize:]
+	}
+	if !delivery.Delivered {
+		log.Error().Str("subscription", subscription.ID).Str("error", delivery.Error).Msg("webhook delivery failed")
+		d.deadLetters = append(d.deadLetters, delivery)
+		if len(d.deadLetters) > maxLogSize {
+			d.deadLetters = d.deadLetters[len(d.deadLetters)-maxLogSize:]
+		}
+	}
+}
+
+func (d *dispatcher) send(subscription Subscription, id string, changeType internal.ChangeType, payload []byte) (int, error) {
+	request, err := http.NewRequest(http.MethodPost, subscription.URL, bytes.NewReader(payload))
+	if err != nil {
+		return 0, err
+	}
+	request.Header.Set("content-type", "application/json")
+	request.Header.Set("X-Calendar-Delivery", id)
+	request.Header.Set("X-Calendar-Event", string(changeType))
+	request.Header.Set("X-Calendar-Signature", "sha256="+Sign(subscription.Secret, payload))
+	response, err := d.client.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return response.StatusCode, fmt.Errorf("unexpected status %d", response.StatusCode)
+	}
+	return response.StatusCode, nil
+}
+
+// Sign returns hex encoded HMAC-SHA256 of the payload. Receivers compare it with X-Calendar-Signature header.
+func Sign(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,182 @@
+package webhook
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nivanov045/calendar/internal"
+)
+
+type receiver struct {
+	failures int //number of requests answered with error before success
+	requests int
+	changes  []internal.Change
+	mutex    sync.Mutex
+	t        *testing.T
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+	rc.requests++
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		rc.t.Errorf("ReadAll() error = %v", err)
+	}
+	if got, want := r.Header.Get("X-Calendar-Signature"), "sha256="+Sign("secret", body); got != want {
+		rc.t.Errorf("X-Calendar-Signature = %v, want %v", got, want)
+	}
+	if rc.requests <= rc.failures {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	var change internal.Change
+	if err := json.Unmarshal(body, &change); err != nil {
+		rc.t.Errorf("Unmarshal() error = %v", err)
+	}
+	rc.changes = append(rc.changes, change)
+	w.WriteHeader(http.StatusOK)
+}
+
+func Test_dispatcher_Notify(t *testing.T) {
+	change := internal.Change{
+		Type:  internal.UserInvited,
+		User:  "u-1",
+		Event: internal.Event{ID: "e-1", Participants: []string{"u-2"}, Candidates: []string{"u-1"}},
+	}
+	tests := []struct {
+		name          string
+		user          string
+		failures      int
+		wantRequests  int
+		wantDelivered bool
+		wantDead      bool
+	}{
+		{
+			name:          "Global subscription",
+			wantRequests:  1,
+			wantDelivered: true,
+		},
+		{
+			name:          "Subscription of attendee",
+			user:          "u-2",
+			wantRequests:  1,
+			wantDelivered: true,
+		},
+		{
+			name:         "Subscription of other user",
+			user:         "u-3",
+			wantRequests: 0,
+		},
+		{
+			name:          "Delivered after retries",
+			failures:      2,
+			wantRequests:  3,
+			wantDelivered: true,
+		},
+		{
+			name:         "Dead letter after all attempts",
+			failures:     5,
+			wantRequests: 3,
+			wantDead:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rc := &receiver{failures: tt.failures, t: t}
+			server := httptest.NewServer(rc)
+			defer server.Close()
+			d := New(3, time.Millisecond)
+			subscription, err := d.Subscribe(Subscription{User: tt.user, URL: server.URL, Secret: "secret"})
+			if err != nil {
+				t.Fatalf("Subscribe() error = %v", err)
+			}
+			d.Notify(change)
+			d.wg.Wait()
+			if rc.requests != tt.wantRequests {
+				t.Errorf("Notify() requests = %v, want %v", rc.requests, tt.wantRequests)
+			}
+			if tt.wantDelivered && (len(rc.changes) != 1 || rc.changes[0].Event.ID != "e-1") {
+				t.Errorf("Notify() received = %v, want change of e-1", rc.changes)
+			}
+			deliveries := d.Deliveries(subscription.ID)
+			if tt.wantRequests != 0 && (len(deliveries) != 1 || deliveries[0].Delivered != tt.wantDelivered) {
+				t.Errorf("Deliveries() = %v, want delivered %v", deliveries, tt.wantDelivered)
+			}
+			if got := len(d.DeadLetters(subscription.ID)) != 0; got != tt.wantDead {
+				t.Errorf("DeadLetters() not empty = %v, want %v", got, tt.wantDead)
+			}
+		})
+	}
+}
+
+func Test_dispatcher_Notify_noAttempts(t *testing.T) {
+	rc := &receiver{t: t}
+	server := httptest.NewServer(rc)
+	defer server.Close()
+	d := New(0, time.Millisecond)
+	subscription, err := d.Subscribe(Subscription{URL: server.URL, Secret: "secret"})
+	if err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+	d.Notify(internal.Change{Type: internal.EventCreated})
+	d.wg.Wait()
+	if deliveries := d.Deliveries(subscription.ID); rc.requests != 1 || len(deliveries) != 1 || !deliveries[0].Delivered {
+		t.Errorf("Notify() made %v requests with deliveries %v, want one delivered attempt", rc.requests, deliveries)
+	}
+}
+
+func Test_dispatcher_Subscribe(t *testing.T) {
+	d := New(1, time.Millisecond)
+	first, err := d.Subscribe(Subscription{URL: "http://127.0.0.1:1"})
+	if err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+	second, err := d.Subscribe(Subscription{URL: "http://127.0.0.1:1"})
+	if err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+	if len(first.Secret) != 2*secretSize || first.Secret == second.Secret {
+		t.Errorf("Subscribe() secrets = %q and %q, want different random ones", first.Secret, second.Secret)
+	}
+	if given, _ := d.Subscribe(Subscription{URL: "http://127.0.0.1:1", Secret: "secret"}); given.Secret != "secret" {
+		t.Errorf("Subscribe() secret = %q, want the given one", given.Secret)
+	}
+}
+
+func Test_dispatcher_DeadLetters(t *testing.T) {
+	d := New(1, time.Millisecond)
+	subscription, err := d.Subscribe(Subscription{URL: "http://127.0.0.1:1"})
+	if err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+	for i := 0; i < maxLogSize+10; i++ {
+		d.Notify(internal.Change{Type: internal.EventCreated})
+	}
+	d.wg.Wait()
+	if got := len(d.DeadLetters(subscription.ID)); got != maxLogSize {
+		t.Errorf("DeadLetters() has %v deliveries, want %v", got, maxLogSize)
+	}
+}
+
+func Test_dispatcher_Unsubscribe(t *testing.T) {
+	d := New(1, time.Millisecond)
+	subscription, err := d.Subscribe(Subscription{URL: "http://127.0.0.1:1"})
+	if err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+	if err := d.Unsubscribe(subscription.ID); err != nil {
+		t.Errorf("Unsubscribe() error = %v", err)
+	}
+	if err := d.Unsubscribe(subscription.ID); err == nil {
+		t.Errorf("Unsubscribe() of removed subscription error = %v, wantErr %v", err, true)
+	}
+	if _, err := d.Subscribe(Subscription{}); err == nil {
+		t.Errorf("Subscribe() without url error = %v, wantErr %v", err, true)
+	}
+}